@@ -158,6 +158,8 @@ func OnBoardingCustomer(c *gin.Context) {
 		return
 	}
 
+	mergeGuestCart(c, newAccount.AccountId)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message":      "User registered successfully",
 		"account_id":   newAccount.AccountId,
@@ -246,6 +248,10 @@ func Login(c *gin.Context) {
 			return
 		}
 
+		if accountWithEmail.RoleID == models.CustomerRole {
+			mergeGuestCart(c, accountWithEmail.AccountId)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"goto":         "continue",
 			"access_token": token,
@@ -284,6 +290,11 @@ func Login(c *gin.Context) {
 				constants.ErrorText(constants.ErrorTokenGenerationFailed), nil))
 			return
 		}
+
+		if existingAccount.RoleID == models.CustomerRole {
+			mergeGuestCart(c, existingAccount.AccountId)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"goto":         "continue",
 			"access_token": token,
@@ -0,0 +1,468 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/middleware"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CartTokenHeader carries the opaque token of a guest cart, both ways
+const CartTokenHeader = "X-Cart-Token"
+
+type CartIssue string
+
+const (
+	CartIssueUnavailable     CartIssue = "UNAVAILABLE"
+	CartIssueOutOfStock      CartIssue = "OUT_OF_STOCK"
+	CartIssueQuantityReduced CartIssue = "QUANTITY_REDUCED"
+	CartIssuePriceChanged    CartIssue = "PRICE_CHANGED"
+)
+
+type AddToCartRequest struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  uint   `json:"quantity"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity *uint `json:"quantity" binding:"required"`
+}
+
+type CartCheckoutRequest struct {
+	CouponCode string `json:"coupon_code"`
+}
+
+type CartItemResponse struct {
+	ProductID     string      `json:"product_id"`
+	Slug          string      `json:"slug,omitempty"`
+	Title         string      `json:"title,omitempty"`
+	ImageURL      string      `json:"image_url,omitempty"`
+	Price         uint        `json:"price"`
+	PreviousPrice *uint       `json:"previous_price,omitempty"`
+	Quantity      uint        `json:"quantity"`
+	Stock         uint        `json:"stock"`
+	LineTotal     uint        `json:"line_total"`
+	Issues        []CartIssue `json:"issues,omitempty"`
+}
+
+type CartResponse struct {
+	UUID        string             `json:"uuid"`
+	Items       []CartItemResponse `json:"items"`
+	ItemCount   uint               `json:"item_count"`
+	TotalAmount uint               `json:"total_amount"`
+	// HasIssues is set when an item changed since the customer last saw the cart
+	// or cannot be bought, in which case the cart cannot be checked out
+	HasIssues bool `json:"has_issues"`
+}
+
+// cartFromContext returns the authenticated customer's cart, creating it on
+// first use, or else the guest cart named by the X-Cart-Token header. With
+// create, a guest without a cart gets a new one whose token is sent back in
+// the X-Cart-Token header; without it the cart is nil when there is none.
+func cartFromContext(c *gin.Context, create bool) (*models.Cart, bool) {
+	var (
+		cartRepo = models.InitCartRepo(database.DB)
+	)
+
+	if accountUUID := c.GetString(middleware.AccountUUIDContextKey); accountUUID != "" {
+		if c.GetString(middleware.AuthorizedUserRoleContextKey) != models.GetRoleName(models.CustomerRole) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return nil, false
+		}
+
+		cart, err := cartRepo.GetOrCreate(accountUUID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cart"})
+			return nil, false
+		}
+		return cart, true
+	}
+
+	if token := c.GetHeader(CartTokenHeader); token != "" {
+		cart, err := cartRepo.GetByToken(token)
+		if err == nil {
+			return cart, true
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cart"})
+			return nil, false
+		}
+	}
+
+	if !create {
+		return nil, true
+	}
+
+	cart, token, err := cartRepo.CreateGuest()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create cart"})
+		return nil, false
+	}
+	c.Header(CartTokenHeader, token)
+	return cart, true
+}
+
+// mergeGuestCart moves the guest cart named by the X-Cart-Token header into
+// the customer's cart. A failed merge is only logged, so it never blocks a login.
+func mergeGuestCart(c *gin.Context, accountUUID string) {
+	var (
+		cartRepo = models.InitCartRepo(database.DB)
+	)
+
+	token := c.GetHeader(CartTokenHeader)
+	if token == "" {
+		return
+	}
+
+	guest, err := cartRepo.GetByToken(token)
+	if err != nil {
+		return
+	}
+	if err := cartRepo.MergeGuest(guest, accountUUID); err == nil {
+		utils.Info("merged guest cart into the cart of ", accountUUID)
+	}
+}
+
+// cartProductFromRequest loads a live product by UUID for adding to a cart
+func cartProductFromRequest(c *gin.Context, productUUID string) (*models.Product, bool) {
+	product, err := models.InitProductsRepo(database.DB).Get(&models.Product{UUID: productUUID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product"})
+		return nil, false
+	}
+	if !product.IsLive(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product is not available"})
+		return nil, false
+	}
+	return product, true
+}
+
+// addProductToCart adds quantity of the product to the cart when the stock
+// covers it together with what is already in the cart
+func addProductToCart(c *gin.Context, cart *models.Cart, product *models.Product, quantity uint) bool {
+	var (
+		cartRepo = models.InitCartRepo(database.DB)
+	)
+
+	items, err := cartRepo.GetItems(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add to cart"})
+		return false
+	}
+	inCart := uint(0)
+	for _, item := range items {
+		if item.ProductID == product.ID {
+			inCart = item.Quantity
+		}
+	}
+	if inCart+quantity > product.Stock {
+		c.JSON(http.StatusConflict, gin.H{"error": "not enough stock", "stock": product.Stock, "in_cart": inCart})
+		return false
+	}
+
+	discounts, err := offerDiscounts(product)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add to cart"})
+		return false
+	}
+
+	if err := cartRepo.AddItem(cart.ID, product.ID, quantity, effectivePrice(product, discounts)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add to cart"})
+		return false
+	}
+	return true
+}
+
+// revalidateCart checks every item against the current product. Quantities
+// above the stock are reduced and new prices recorded, so each change is
+// reported once. Items that cannot be bought stay in the cart, flagged, and
+// are left out of the total. Stock held by the customer's own pending
+// checkouts counts as available, so checking out does not shrink the cart.
+func revalidateCart(cart *models.Cart) (*CartResponse, error) {
+	var (
+		cartRepo = models.InitCartRepo(database.DB)
+		now      = time.Now()
+		reserved = map[uint]uint{}
+	)
+
+	items, err := cartRepo.GetItems(cart.ID)
+	if err != nil {
+		return nil, err
+	}
+	if cart.AccountUUID != nil {
+		if reserved, err = models.InitCheckoutrepo(database.DB).ReservedQuantities(*cart.AccountUUID); err != nil {
+			return nil, err
+		}
+	}
+	products := make([]*models.Product, 0, len(items))
+	for i := range items {
+		products = append(products, &items[i].Product)
+	}
+	discounts, err := offerDiscounts(products...)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &CartResponse{UUID: cart.UUID, Items: make([]CartItemResponse, 0, len(items))}
+	for i := range items {
+		item, product := &items[i], &items[i].Product
+		product.Stock += reserved[product.ID]
+		line := CartItemResponse{
+			ProductID: product.UUID,
+			Slug:      product.Slug,
+			Title:     product.Title,
+			ImageURL:  product.ImageURL,
+			Price:     item.Price,
+			Quantity:  item.Quantity,
+			Stock:     product.Stock,
+		}
+
+		changed := false
+		switch {
+		case product.ID == 0 || !product.IsLive(now):
+			line.Issues = append(line.Issues, CartIssueUnavailable)
+		case product.Stock == 0:
+			line.Issues = append(line.Issues, CartIssueOutOfStock)
+		default:
+			if item.Quantity > product.Stock {
+				item.Quantity, line.Quantity = product.Stock, product.Stock
+				line.Issues = append(line.Issues, CartIssueQuantityReduced)
+				changed = true
+			}
+			if price := effectivePrice(product, discounts); item.Price != price {
+				previous := item.Price
+				item.Price, line.Price, line.PreviousPrice = price, price, &previous
+				line.Issues = append(line.Issues, CartIssuePriceChanged)
+				changed = true
+			}
+			line.LineTotal = line.Price * line.Quantity
+			response.ItemCount += line.Quantity
+			response.TotalAmount += line.LineTotal
+		}
+
+		if changed {
+			if err := cartRepo.UpdateItem(item); err != nil {
+				return nil, err
+			}
+		}
+		response.HasIssues = response.HasIssues || len(line.Issues) > 0
+		response.Items = append(response.Items, line)
+	}
+	return response, nil
+}
+
+// respondWithCart writes the revalidated cart
+func respondWithCart(c *gin.Context, cart *models.Cart) {
+	response, err := revalidateCart(cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cart"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetCart returns the customer's cart, revalidated against current stock and prices
+func GetCart(c *gin.Context) {
+	cart, ok := cartFromContext(c, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		c.JSON(http.StatusOK, CartResponse{Items: []CartItemResponse{}})
+		return
+	}
+
+	response, err := revalidateCart(cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AddToCart adds a quantity of a product to the cart, as long as the stock covers it
+func AddToCart(c *gin.Context) {
+	var (
+		request = AddToCartRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if request.Quantity == 0 {
+		request.Quantity = 1
+	}
+
+	product, ok := cartProductFromRequest(c, request.ProductID)
+	if !ok {
+		return
+	}
+	cart, ok := cartFromContext(c, true)
+	if !ok {
+		return
+	}
+	if !addProductToCart(c, cart, product, request.Quantity) {
+		return
+	}
+
+	respondWithCart(c, cart)
+}
+
+// UpdateCartItem sets the quantity of a product in the cart; zero removes it
+func UpdateCartItem(c *gin.Context) {
+	var (
+		request  = UpdateCartItemRequest{}
+		cartRepo = models.InitCartRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	cart, ok := cartFromContext(c, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+
+	items, err := cartRepo.GetItems(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update cart"})
+		return
+	}
+
+	var item *models.CartItem
+	for i := range items {
+		if items[i].Product.UUID == c.Param("product_id") {
+			item = &items[i]
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+
+	if *request.Quantity == 0 {
+		_, err = cartRepo.RemoveItem(cart.ID, item.ProductID)
+	} else {
+		if *request.Quantity > item.Product.Stock {
+			c.JSON(http.StatusConflict, gin.H{"error": "not enough stock", "stock": item.Product.Stock})
+			return
+		}
+		item.Quantity = *request.Quantity
+		err = cartRepo.UpdateItem(item)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update cart"})
+		return
+	}
+
+	respondWithCart(c, cart)
+}
+
+// RemoveFromCart removes a product from the cart
+func RemoveFromCart(c *gin.Context) {
+	var (
+		cartRepo = models.InitCartRepo(database.DB)
+	)
+
+	cart, ok := cartFromContext(c, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+
+	// Deleted products can still be removed from the cart
+	product, err := models.InitProductsRepo(database.DB).GetWithTx(database.DB.Unscoped(),
+		&models.Product{UUID: c.Param("product_id")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+
+	removed, err := cartRepo.RemoveItem(cart.ID, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update cart"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+
+	respondWithCart(c, cart)
+}
+
+// CheckoutCart creates a checkout from the cart contents, with an optional
+// coupon code. When anything in the cart changed since the customer last saw
+// it, the updated cart is returned for review instead. Items stay in the cart
+// until the checkout completes. Guests have to log in first, which merges
+// their cart.
+func CheckoutCart(c *gin.Context) {
+	var (
+		request = CartCheckoutRequest{}
+	)
+
+	if c.GetString(middleware.AccountUUIDContextKey) == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "log in to check out"})
+		return
+	}
+
+	// The body is optional
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+
+	cart, ok := cartFromContext(c, false)
+	if !ok {
+		return
+	}
+
+	response, err := revalidateCart(cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cart"})
+		return
+	}
+	if len(response.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cart is empty"})
+		return
+	}
+	if response.HasIssues {
+		c.JSON(http.StatusConflict, gin.H{"error": "cart changed, review it before checking out", "cart": response})
+		return
+	}
+
+	items, err := models.InitCartRepo(database.DB).GetItems(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cart"})
+		return
+	}
+
+	requestItems := make([]CheckoutItemRequest, 0, len(items))
+	for _, item := range items {
+		requestItems = append(requestItems, CheckoutItemRequest{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	createCheckout(c, *cart.AccountUUID, requestItems, request.CouponCode)
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"ecom/backend/constants"
+	"ecom/backend/database"
+	"ecom/backend/errResponse"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type CategorySchemaRequest struct {
+	Attributes                []models.SpecificationAttribute `json:"attributes" binding:"required,dive"`
+	AllowAdditionalAttributes bool                            `json:"allow_additional_attributes"`
+	RequiresModeration        bool                            `json:"requires_moderation"`
+}
+
+// specificationValidator validates product specifications against their
+// category schema, caching schemas so bulk uploads query each category once.
+type specificationValidator struct {
+	repo    models.ICategorySchemaRepo
+	schemas map[string]*models.CategorySchema
+}
+
+func newSpecificationValidator() *specificationValidator {
+	return &specificationValidator{
+		repo:    models.InitCategorySchemaRepo(database.DB),
+		schemas: map[string]*models.CategorySchema{},
+	}
+}
+
+// schema returns the category's schema, or nil when it has none
+func (v *specificationValidator) schema(category string) (*models.CategorySchema, error) {
+	schema, ok := v.schemas[category]
+	if !ok {
+		var err error
+		schema, err = v.repo.Find(category)
+		if err != nil {
+			return nil, err
+		}
+		v.schemas[category] = schema
+	}
+	return schema, nil
+}
+
+// RequiresModeration reports whether products of the category need admin review before publishing
+func (v *specificationValidator) RequiresModeration(category string) (bool, error) {
+	schema, err := v.schema(category)
+	if err != nil || schema == nil {
+		return false, err
+	}
+	return schema.RequiresModeration, nil
+}
+
+// Validate returns the normalised specifications, or the field errors when
+// they do not follow the schema. Categories without a schema accept anything.
+func (v *specificationValidator) Validate(category string, specs datatypes.JSON) (datatypes.JSON, []models.SpecificationError, error) {
+	schema, err := v.schema(category)
+	if err != nil {
+		return specs, nil, err
+	}
+
+	if schema == nil {
+		return specs, nil, nil
+	}
+
+	normalized, fieldErrors := schema.ValidateSpecifications(specs)
+	return normalized, fieldErrors, nil
+}
+
+func GetCategorySchema(c *gin.Context) {
+	var (
+		schemaRepo = models.InitCategorySchemaRepo(database.DB)
+	)
+
+	schema, err := schemaRepo.Get(c.Param("category"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category has no specification schema"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errResponse.Generate(constants.ErrorDatabaseQueryFailed,
+			constants.ErrorText(constants.ErrorDatabaseQueryFailed), nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+func ListCategorySchemas(c *gin.Context) {
+	var (
+		schemaRepo = models.InitCategorySchemaRepo(database.DB)
+	)
+
+	schemas, err := schemaRepo.GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errResponse.Generate(constants.ErrorDatabaseQueryFailed,
+			constants.ErrorText(constants.ErrorDatabaseQueryFailed), nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas)
+}
+
+func UpsertCategorySchema(c *gin.Context) {
+	var (
+		request    = CategorySchemaRequest{}
+		schemaRepo = models.InitCategorySchemaRepo(database.DB)
+	)
+
+	category := c.Param("category")
+	if category == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, errResponse.Generate(
+			constants.ErrorBadRequest,
+			"category cannot be empty",
+			constants.ErrorBadRequest,
+		))
+		return
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+
+	schema := models.CategorySchema{
+		Category:             category,
+		Attributes:           request.Attributes,
+		AllowAdditionalAttrs: request.AllowAdditionalAttributes,
+		RequiresModeration:   request.RequiresModeration,
+	}
+
+	if fieldErrors := schema.Validate(); len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schema", "fields": fieldErrors})
+		return
+	}
+
+	if err := schemaRepo.Upsert(&schema); err != nil {
+		c.JSON(http.StatusInternalServerError, errResponse.Generate(constants.ErrorDatabaseCreateFailed,
+			constants.ErrorText(constants.ErrorDatabaseCreateFailed), nil))
+		return
+	}
+
+	utils.Info("specification schema saved for category ", category)
+	c.JSON(http.StatusOK, gin.H{"message": "Schema saved", "category": category})
+}
+
+func DeleteCategorySchema(c *gin.Context) {
+	var (
+		schemaRepo = models.InitCategorySchemaRepo(database.DB)
+	)
+
+	if err := schemaRepo.Delete(c.Param("category")); err != nil {
+		c.JSON(http.StatusInternalServerError, errResponse.Generate(constants.ErrorDatabaseUpdateFailed,
+			constants.ErrorText(constants.ErrorDatabaseUpdateFailed), nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schema deleted"})
+}
@@ -6,19 +6,33 @@ import (
 	"ecom/backend/errResponse"
 	"ecom/backend/middleware"
 	"ecom/backend/models"
+	"ecom/backend/payments"
 	"ecom/backend/utils"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+const (
+	defaultCheckoutReservationTTL = 15 * time.Minute
+	defaultCheckoutSweepInterval  = time.Minute
+	checkoutSweepBatchSize        = 100
+)
+
+type CheckoutItemRequest struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  uint `json:"quantity" binding:"required"`
+}
+
 // CheckoutRequest represents the payload for creating a checkout
 type CheckoutRequest struct {
-	Items []struct {
-		ProductID uint `json:"product_id" binding:"required"`
-		Quantity  uint `json:"quantity" binding:"required"`
-	} `json:"items" binding:"required"`
+	Items      []CheckoutItemRequest `json:"items" binding:"required"`
+	CouponCode string                `json:"coupon_code"`
 }
 
 type CompleteCheckoutRequest struct {
@@ -27,12 +41,78 @@ type CompleteCheckoutRequest struct {
 }
 
 type CheckoutDetailResponse struct {
-	CheckoutID  string                `json:"checkout_id"`
-	CreatedAt   string                `json:"created_at"`
-	UpdatedAt   string                `json:"updated_at"`
-	TotalAmount uint                  `json:"total_amount"`
-	Status      string                `json:"status"`
-	Prouducts   []models.CheckoutItem `json:"products"`
+	CheckoutID     string                `json:"checkout_id"`
+	CreatedAt      string                `json:"created_at"`
+	UpdatedAt      string                `json:"updated_at"`
+	SubtotalAmount uint                  `json:"subtotal_amount"`
+	DiscountAmount uint                  `json:"discount_amount"`
+	CouponCode     string                `json:"coupon_code,omitempty"`
+	TotalAmount    uint                  `json:"total_amount"`
+	Status         string                `json:"status"`
+	Prouducts      []models.CheckoutItem `json:"products"`
+}
+
+// checkoutReservationTTL is how long a pending checkout holds its stock,
+// configurable via CHECKOUT_RESERVATION_TTL (e.g. "15m")
+func checkoutReservationTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CHECKOUT_RESERVATION_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultCheckoutReservationTTL
+}
+
+// StartCheckoutSweeper fails pending checkouts whose reservation expired and
+// returns their stock, and drops expired idempotency keys. The interval is
+// configurable via CHECKOUT_SWEEP_INTERVAL (e.g. "1m").
+func StartCheckoutSweeper() {
+	interval := defaultCheckoutSweepInterval
+	if d, err := time.ParseDuration(os.Getenv("CHECKOUT_SWEEP_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := expireCheckouts(); err != nil {
+				utils.Error("unable to expire checkouts ", err)
+			}
+			models.InitIdempotencyKeyRepo(database.DB).DeleteExpired(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+func expireCheckouts() error {
+	var (
+		checkoutRepo = models.InitCheckoutrepo(database.DB)
+		expired      int
+	)
+
+	for {
+		checkouts, err := checkoutRepo.ListExpired(time.Now(), checkoutSweepBatchSize)
+		if err != nil {
+			return err
+		}
+		for i := range checkouts {
+			ok, err := checkoutRepo.Fail(&checkouts[i])
+			if err != nil {
+				return err
+			}
+			if ok {
+				expired++
+			}
+		}
+		if len(checkouts) < checkoutSweepBatchSize {
+			break
+		}
+	}
+
+	if expired > 0 {
+		utils.Info(fmt.Sprintf("expired %d checkouts and released their stock", expired))
+	}
+	return nil
 }
 
 // CreateCheckout handles checkout creation
@@ -51,44 +131,107 @@ func CreateCheckout(c *gin.Context) {
 		return
 	}
 
+	createCheckout(c, AccountUUIDStr.(string), req.Items, req.CouponCode)
+}
+
+// createCheckout prices the items, applies the coupon code, if any, and
+// creates a pending checkout for the account
+func createCheckout(c *gin.Context, accountUUID string, items []CheckoutItemRequest, couponCode string) {
 	db := database.DB
 	var totalAmount int
 	var checkoutItems []models.CheckoutItem
+	merchantAmounts := map[string]int{}
 
-	// Validate and process each item
-	for _, item := range req.Items {
+	// Validate each item
+	products := make([]*models.Product, 0, len(items))
+	for _, item := range items {
 		var product models.Product
 		if err := db.First(&product, item.ProductID).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found", "product_id": item.ProductID})
 			return
 		}
+		if !product.IsLive(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product is not available", "product_id": item.ProductID})
+			return
+		}
+		products = append(products, &product)
+	}
+
+	// Items sell at their price after the product's offer, if any
+	discounts, err := offerDiscounts(products...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get product offers"})
+		return
+	}
 
-		itemTotal := int(product.Price) * int(item.Quantity)
+	for i, item := range items {
+		product := products[i]
+		price := int(effectivePrice(product, discounts))
+		itemTotal := price * int(item.Quantity)
 		totalAmount += itemTotal
+		merchantAmounts[product.MerchantID] += itemTotal
 
 		checkoutItems = append(checkoutItems, models.CheckoutItem{
 			ProductID:  item.ProductID,
 			Quantity:   item.Quantity,
-			Price:      int(product.Price),
+			Price:      price,
 			TotalPrice: itemTotal,
 		})
 	}
 
-	// Create checkout record (without stock deduction)
+	// Create checkout record, holding the stock until payment or expiry
+	reservedUntil := time.Now().Add(checkoutReservationTTL())
 	checkout := models.Checkout{
-		UserID:        AccountUUIDStr.(string),
-		TotalAmount:   totalAmount,
-		Status:        models.CheckoutStatusPending, // Pending until payment is confirmed
-		CheckoutItems: checkoutItems,
+		UserID:         accountUUID,
+		SubtotalAmount: totalAmount,
+		TotalAmount:    totalAmount,
+		Status:         models.CheckoutStatusPending, // Pending until payment is confirmed
+		ReservedUntil:  &reservedUntil,
+		CheckoutItems:  checkoutItems,
+	}
+
+	var coupon *models.Coupon
+	if couponCode != "" {
+		var ok bool
+		if coupon, ok = applyCoupon(c, &checkout, couponCode, merchantAmounts); !ok {
+			return
+		}
 	}
 
-	if err := db.Create(&checkout).Error; err != nil {
-		utils.Error("unable to create checkout", err)
+	checkoutRepo := models.InitCheckoutrepo(db)
+	if err := checkoutRepo.CreateReservedWithTx(db, &checkout, coupon); err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock", "details": err.Error()})
+			return
+		}
+		if errors.Is(err, models.ErrCouponUsedUp) || errors.Is(err, models.ErrCouponCustomerLimit) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "coupon_code": checkout.CouponCode})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Checkout creation failed", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Checkout created successfully", "checkout_id": checkout.CheckoutID})
+	// Open the payment; without one the checkout cannot be paid, so it is failed right away
+	intent, err := createCheckoutPayment(c.Request.Context(), &checkout)
+	if err == nil {
+		err = checkoutRepo.SetPaymentIntent(&checkout, payments.Provider.Name(), intent.ID)
+	}
+	if err != nil {
+		checkoutRepo.Fail(&checkout)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Payment could not be started"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Checkout created successfully",
+		"checkout_id":     checkout.CheckoutID,
+		"subtotal_amount": checkout.SubtotalAmount,
+		"discount_amount": checkout.DiscountAmount,
+		"total_amount":    checkout.TotalAmount,
+		"reserved_until":  reservedUntil,
+		"payment":         intent,
+	})
 }
 
 func GetCheckoutDetails(c *gin.Context) {
@@ -129,23 +272,28 @@ func GetCheckoutDetails(c *gin.Context) {
 	}
 
 	response := CheckoutDetailResponse{
-		CreatedAt:   checkout.CreatedAt.Local().String(),
-		UpdatedAt:   checkout.UpdatedAt.Local().String(),
-		CheckoutID:  checkoutId,
-		TotalAmount: uint(checkout.TotalAmount),
-		Status:      string(checkout.Status),
-		Prouducts:   checkout.CheckoutItems,
+		CreatedAt:      checkout.CreatedAt.Local().String(),
+		UpdatedAt:      checkout.UpdatedAt.Local().String(),
+		CheckoutID:     checkoutId,
+		SubtotalAmount: uint(checkout.SubtotalAmount),
+		DiscountAmount: uint(checkout.DiscountAmount),
+		CouponCode:     checkout.CouponCode,
+		TotalAmount:    uint(checkout.TotalAmount),
+		Status:         string(checkout.Status),
+		Prouducts:      checkout.CheckoutItems,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-// CompleteCheckout handles checkout completion after successful payment
+// CompleteCheckout handles checkout completion after payment. The payment is
+// verified with the provider against the checkout's total and captured before
+// the order is created. Payment webhooks complete checkouts the same way.
 func CompleteCheckout(c *gin.Context) {
 	var (
 		request      = CompleteCheckoutRequest{}
-		orderRepo    = models.InitOrdersrepo(database.DB)
 		checkoutRepo = models.InitCheckoutrepo(database.DB)
+		ctx          = c.Request.Context()
 	)
 
 	// Bind the request body
@@ -154,76 +302,91 @@ func CompleteCheckout(c *gin.Context) {
 		return
 	}
 
-	// Start a transaction
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
 	// Fetch the checkout record
-	checkout, err := checkoutRepo.GetWithTx(tx, &models.Checkout{CheckoutID: request.CheckoutID})
+	checkout, err := checkoutRepo.Get(&models.Checkout{CheckoutID: request.CheckoutID})
 	if err != nil {
-		tx.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{"error": "Checkout not found"})
 		return
 	}
 
 	// Ensure checkout is still pending
 	if checkout.Status != models.CheckoutStatusPending {
-		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Checkout is not in a valid state for completion"})
 		return
 	}
 
-	// Validate payment reference ID (mock verification here)
-	if request.PaymentReferenceID == "" {
-		tx.Rollback()
+	// The payment reference is the payment intent opened with the checkout
+	if checkout.PaymentIntentID == "" || request.PaymentReferenceID != checkout.PaymentIntentID {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment reference ID"})
 		return
 	}
 
-	// Deduct stock for each product in the checkout
-	for _, item := range checkout.CheckoutItems {
-		if err := tx.Model(&models.Product{}).
-			Where("id = ?", item.ProductID).
-			Update("stock", gorm.Expr("stock - ?", item.Quantity)).Error; err != nil {
-			tx.Rollback()
-			utils.Error("unable to update stock", err)
+	if err := settleCheckout(ctx, checkout); err != nil {
+		switch {
+		case errors.Is(err, errPaymentMismatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payment does not match the checkout"})
+		case errors.Is(err, errPaymentProvider):
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Payment could not be verified or captured"})
+		case errors.Is(err, errPaymentNotPaid):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Checkout has not been paid"})
+		case errors.Is(err, errPaymentFailed):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment failed"})
+		case errors.Is(err, errPaymentProcessing):
+			c.JSON(http.StatusAccepted, gin.H{"message": "Payment is processing", "checkout_id": checkout.CheckoutID,
+				"status": checkout.Status})
+		case errors.Is(err, models.ErrInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock", "details": err.Error()})
+		case errors.Is(err, errCheckoutNotPending):
+			c.JSON(http.StatusConflict, gin.H{"error": "Checkout is no longer pending"})
+		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Checkout completion failed", "details": err.Error()})
-			return
 		}
-	}
-
-	// Update checkout status to completed
-	if err := tx.Model(&checkout).Update("status", models.CheckoutStatusCompleted).Error; err != nil {
-		tx.Rollback()
-		utils.Error("unable to update checkout status", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Checkout completion failed", "details": err.Error()})
 		return
 	}
 
-	// Create order record
-	if err := orderRepo.CreateWithTx(tx, &models.Order{
-		CheckoutID:       checkout.CheckoutID,
-		UserID:           checkout.UserID,
-		TotalOrderAmount: checkout.TotalAmount,
-		PaymentID:        request.PaymentReferenceID,
-	}); err != nil {
-		tx.Rollback()
-		utils.Error("order creation failed", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Checkout completion failed", "details": err.Error()})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{"message": "Checkout completed successfully", "checkout_id": checkout.CheckoutID})
+}
 
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		utils.Error("unable to commit transaction", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Checkout completion failed", "details": err.Error()})
-		return
-	}
+// finishCheckout records the captured payment of a pending checkout: its
+// reserved stock becomes a sale, the products leave the customer's cart and
+// the order is created, with a sub-order for each merchant whose products were
+// bought. It reports false when the checkout is no longer pending.
+func finishCheckout(checkout *models.Checkout, intent *payments.Intent) (bool, error) {
+	var (
+		checkoutRepo = models.InitCheckoutrepo(database.DB)
+		orderRepo    = models.InitOrdersrepo(database.DB)
+		completed    bool
+	)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Checkout completed successfully", "checkout_id": checkout.CheckoutID})
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if completed, err = checkoutRepo.CompleteWithTx(tx, checkout); err != nil || !completed {
+			return err
+		}
+
+		// The purchased products leave the customer's cart
+		if err := models.InitCartRepo(tx).RemoveCheckedOutWithTx(tx, checkout.UserID, checkout.ID); err != nil {
+			return err
+		}
+
+		// Create order record
+		order := models.Order{
+			CheckoutID:       checkout.CheckoutID,
+			UserID:           checkout.UserID,
+			TotalOrderAmount: checkout.TotalAmount,
+			PaymentID:        intent.ID,
+		}
+		if err := orderRepo.CreateWithTx(tx, &order); err != nil {
+			return err
+		}
+
+		// Each merchant fulfils and gets paid for their own items
+		_, err = models.InitMerchantOrderRepo(tx).CreateForOrderWithTx(tx, &order, checkout)
+		return err
+	})
+	if err != nil {
+		utils.Error("unable to complete checkout ", err)
+		return false, err
+	}
+	return completed, nil
 }
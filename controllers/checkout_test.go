@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckoutReservationTTL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: defaultCheckoutReservationTTL},
+		{value: "5m", want: 5 * time.Minute},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "0s", want: defaultCheckoutReservationTTL},
+		{value: "-5m", want: defaultCheckoutReservationTTL},
+		{value: "fifteen minutes", want: defaultCheckoutReservationTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("CHECKOUT_RESERVATION_TTL", tt.value)
+			if got := checkoutReservationTTL(); got != tt.want {
+				t.Fatalf("checkoutReservationTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
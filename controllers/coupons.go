@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/middleware"
+	"ecom/backend/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCouponPageSize = 50
+	maxCouponPageSize     = 200
+)
+
+type CouponRequest struct {
+	Code               string            `json:"code" binding:"required"`
+	Description        string            `json:"description"`
+	Kind               models.CouponKind `json:"kind" binding:"required"`
+	Value              uint              `json:"value" binding:"required"`
+	MinCartValue       uint              `json:"min_cart_value"`
+	StartsAt           *time.Time        `json:"starts_at"`
+	ExpiresAt          *time.Time        `json:"expires_at"`
+	MaxUses            *uint             `json:"max_uses"`
+	MaxUsesPerCustomer *uint             `json:"max_uses_per_customer"`
+	IsActive           *bool             `json:"is_active"`
+}
+
+// couponColumns are the columns of a coupon written from a CouponRequest
+var couponColumns = []string{
+	"code", "description", "kind", "value", "min_cart_value", "starts_at",
+	"expires_at", "max_uses", "max_uses_per_customer", "is_active",
+}
+
+// validate reports what is wrong with the request, if anything
+func (r *CouponRequest) validate() string {
+	switch {
+	case models.NormalizeCouponCode(r.Code) == "":
+		return "code is required"
+	case !r.Kind.IsValid():
+		return "kind must be PERCENTAGE or FIXED"
+	case r.Kind == models.CouponKindPercentage && r.Value > 100:
+		return "a percentage value cannot be above 100"
+	case r.StartsAt != nil && r.ExpiresAt != nil && !r.ExpiresAt.After(*r.StartsAt):
+		return "expires_at must be after starts_at"
+	case r.MaxUses != nil && *r.MaxUses == 0, r.MaxUsesPerCustomer != nil && *r.MaxUsesPerCustomer == 0:
+		return "usage limits must be above zero"
+	}
+	return ""
+}
+
+// apply copies the request onto the coupon
+func (r *CouponRequest) apply(coupon *models.Coupon) {
+	coupon.Code = models.NormalizeCouponCode(r.Code)
+	coupon.Description = r.Description
+	coupon.Kind = r.Kind
+	coupon.Value = r.Value
+	coupon.MinCartValue = r.MinCartValue
+	coupon.StartsAt = r.StartsAt
+	coupon.ExpiresAt = r.ExpiresAt
+	coupon.MaxUses = r.MaxUses
+	coupon.MaxUsesPerCustomer = r.MaxUsesPerCustomer
+	coupon.IsActive = r.IsActive
+	if coupon.IsActive == nil {
+		active := true
+		coupon.IsActive = &active
+	}
+}
+
+// couponOwnerFromContext returns whose coupons the request manages: the
+// merchant's own, or the platform's, with an empty id, for admins
+func couponOwnerFromContext(c *gin.Context) (string, bool) {
+	if c.GetString(middleware.AuthorizedUserRoleContextKey) == models.GetRoleName(models.AdminRole) {
+		return "", true
+	}
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return "", false
+	}
+	return merchantInfo.UUID, true
+}
+
+// couponFromPath loads the coupon named by the coupon_id path parameter, if
+// it belongs to the requester
+func couponFromPath(c *gin.Context) (*models.Coupon, bool) {
+	ownerID, ok := couponOwnerFromContext(c)
+	if !ok {
+		return nil, false
+	}
+
+	coupon, err := models.InitCouponRepo(database.DB).Get(&models.Coupon{UUID: c.Param("coupon_id")})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get coupon"})
+		return nil, false
+	}
+	if coupon.MerchantID != ownerID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+		return nil, false
+	}
+	return coupon, true
+}
+
+// couponCodeTaken reports whether another coupon already uses the code
+func couponCodeTaken(c *gin.Context, code string, couponID uint) (bool, bool) {
+	existing, err := models.InitCouponRepo(database.DB).GetByCode(code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, true
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check coupon code"})
+		return false, false
+	}
+	return existing.ID != couponID, true
+}
+
+// applyCoupon checks that the coupon code can be used on the checkout and
+// sets the checkout's discount. A merchant's coupon only discounts, and needs
+// its minimum cart value from, that merchant's products.
+func applyCoupon(c *gin.Context, checkout *models.Checkout, code string, merchantAmounts map[string]int) (*models.Coupon, bool) {
+	coupon, err := models.InitCouponRepo(database.DB).GetByCode(code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon code", "coupon_code": code})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get coupon"})
+		return nil, false
+	}
+	if !coupon.IsRedeemable(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupon is not valid or has expired", "coupon_code": coupon.Code})
+		return nil, false
+	}
+
+	eligibleAmount := checkout.SubtotalAmount
+	if coupon.MerchantID != "" {
+		eligibleAmount = merchantAmounts[coupon.MerchantID]
+		if eligibleAmount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Coupon does not apply to these products", "coupon_code": coupon.Code})
+			return nil, false
+		}
+	}
+	if uint(eligibleAmount) < coupon.MinCartValue {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Cart value is below the coupon's minimum",
+			"coupon_code":    coupon.Code,
+			"min_cart_value": coupon.MinCartValue,
+		})
+		return nil, false
+	}
+
+	// Payments need an amount to take
+	discount := int(coupon.Discount(uint(eligibleAmount)))
+	if discount >= checkout.SubtotalAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupon cannot cover the whole checkout", "coupon_code": coupon.Code})
+		return nil, false
+	}
+
+	checkout.CouponCode = coupon.Code
+	checkout.DiscountAmount = discount
+	checkout.DiscountMerchantID = coupon.MerchantID
+	checkout.TotalAmount = checkout.SubtotalAmount - discount
+	return coupon, true
+}
+
+// ListCoupons lists the merchant's coupons, or the platform coupons for admins
+func ListCoupons(c *gin.Context) {
+	var (
+		couponRepo = models.InitCouponRepo(database.DB)
+		page       = 1
+		limit      = defaultCouponPageSize
+	)
+
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxCouponPageSize)
+	}
+
+	ownerID, ok := couponOwnerFromContext(c)
+	if !ok {
+		return
+	}
+
+	coupons, total, err := couponRepo.List(ownerID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"coupons": coupons,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// CreateCoupon creates a coupon code for the merchant's products, or a
+// platform coupon for the whole checkout when an admin creates it
+func CreateCoupon(c *gin.Context) {
+	var (
+		request = CouponRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+	if problem := request.validate(); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	ownerID, ok := couponOwnerFromContext(c)
+	if !ok {
+		return
+	}
+
+	taken, ok := couponCodeTaken(c, request.Code, 0)
+	if !ok {
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "coupon code is already in use"})
+		return
+	}
+
+	coupon := models.Coupon{MerchantID: ownerID}
+	request.apply(&coupon)
+	if err := models.InitCouponRepo(database.DB).Create(&coupon); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create coupon"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// GetCoupon returns one of the requester's coupons with its usage
+func GetCoupon(c *gin.Context) {
+	coupon, ok := couponFromPath(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, coupon)
+}
+
+// UpdateCoupon replaces the terms of one of the requester's coupons. Uses
+// already made are kept and count towards the new limits.
+func UpdateCoupon(c *gin.Context) {
+	var (
+		request = CouponRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+	if problem := request.validate(); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	coupon, ok := couponFromPath(c)
+	if !ok {
+		return
+	}
+
+	taken, ok := couponCodeTaken(c, request.Code, coupon.ID)
+	if !ok {
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "coupon code is already in use"})
+		return
+	}
+
+	request.apply(coupon)
+	if err := models.InitCouponRepo(database.DB).Update(coupon, couponColumns); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// DeleteCoupon deletes one of the requester's coupons. Pending checkouts
+// keep the discount they were created with.
+func DeleteCoupon(c *gin.Context) {
+	coupon, ok := couponFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := models.InitCouponRepo(database.DB).Delete(coupon); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "coupon deleted"})
+}
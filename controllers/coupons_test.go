@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"ecom/backend/models"
+	"testing"
+	"time"
+)
+
+func TestCouponRequestValidate(t *testing.T) {
+	var (
+		starts = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		ends   = starts.Add(24 * time.Hour)
+		zero   = uint(0)
+		one    = uint(1)
+	)
+
+	tests := []struct {
+		name    string
+		request CouponRequest
+		want    string
+	}{
+		{name: "valid percentage", request: CouponRequest{Code: "save10", Kind: models.CouponKindPercentage, Value: 10}},
+		{name: "valid full percentage", request: CouponRequest{Code: "free", Kind: models.CouponKindPercentage, Value: 100}},
+		{name: "valid fixed above 100", request: CouponRequest{Code: "save5", Kind: models.CouponKindFixed, Value: 500}},
+		{name: "valid window and limits", request: CouponRequest{Code: "save5", Kind: models.CouponKindFixed, Value: 500, StartsAt: &starts, ExpiresAt: &ends, MaxUses: &one, MaxUsesPerCustomer: &one}},
+		{name: "blank code", request: CouponRequest{Code: "  ", Kind: models.CouponKindFixed, Value: 500}, want: "code is required"},
+		{name: "unknown kind", request: CouponRequest{Code: "save5", Kind: "BOGO", Value: 500}, want: "kind must be PERCENTAGE or FIXED"},
+		{name: "percentage above 100", request: CouponRequest{Code: "save", Kind: models.CouponKindPercentage, Value: 101}, want: "a percentage value cannot be above 100"},
+		{name: "expires when it starts", request: CouponRequest{Code: "save5", Kind: models.CouponKindFixed, Value: 500, StartsAt: &starts, ExpiresAt: &starts}, want: "expires_at must be after starts_at"},
+		{name: "expires before it starts", request: CouponRequest{Code: "save5", Kind: models.CouponKindFixed, Value: 500, StartsAt: &ends, ExpiresAt: &starts}, want: "expires_at must be after starts_at"},
+		{name: "no uses", request: CouponRequest{Code: "save5", Kind: models.CouponKindFixed, Value: 500, MaxUses: &zero}, want: "usage limits must be above zero"},
+		{name: "no uses per customer", request: CouponRequest{Code: "save5", Kind: models.CouponKindFixed, Value: 500, MaxUsesPerCustomer: &zero}, want: "usage limits must be above zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.validate(); got != tt.want {
+				t.Fatalf("validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
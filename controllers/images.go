@@ -0,0 +1,407 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/storage"
+	"ecom/backend/utils"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+const (
+	defaultMaxImageBytes = 5 << 20
+	maxImagesPerProduct  = 10
+	merchantLogoSize     = 512
+)
+
+// thumbnailSizes are the longest-side sizes generated for every product image
+var thumbnailSizes = map[string]int{
+	"small":  150,
+	"medium": 400,
+	"large":  800,
+}
+
+type ReorderImagesRequest struct {
+	ImageIDs []string `json:"image_ids" binding:"required"`
+}
+
+// storedImage is the result of uploading an image and its thumbnails to the blob store
+type storedImage struct {
+	URL        string
+	Thumbnails map[string]string
+	Keys       []string
+}
+
+// maxImageBytes returns the per-file upload limit, configurable via IMAGE_MAX_UPLOAD_BYTES
+func maxImageBytes() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("IMAGE_MAX_UPLOAD_BYTES"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultMaxImageBytes
+}
+
+// storeImage uploads the original image and one resized copy per size under prefix.
+// Already uploaded blobs are removed again when any upload fails.
+func storeImage(ctx context.Context, prefix string, data []byte, contentType string, img image.Image, sizes map[string]int) (*storedImage, error) {
+	var (
+		store  = storage.Store
+		result = storedImage{Thumbnails: map[string]string{}}
+	)
+
+	put := func(key string, body []byte, blobType string) error {
+		if err := store.Put(ctx, key, bytes.NewReader(body), blobType); err != nil {
+			return err
+		}
+		result.Keys = append(result.Keys, key)
+		return nil
+	}
+
+	originalKey := fmt.Sprintf("%s/original.%s", prefix, utils.AllowedImageTypes[contentType])
+	if err := put(originalKey, data, contentType); err != nil {
+		return nil, err
+	}
+	result.URL = store.URL(originalKey)
+
+	for name, size := range sizes {
+		resized, resizedType, err := utils.EncodeImage(utils.ResizeToFit(img, size), contentType)
+		if err == nil {
+			key := fmt.Sprintf("%s/%s.%s", prefix, name, utils.AllowedImageTypes[resizedType])
+			if err = put(key, resized, resizedType); err == nil {
+				result.Thumbnails[name] = store.URL(key)
+				continue
+			}
+		}
+
+		deleteBlobs(ctx, result.Keys)
+		return nil, err
+	}
+	return &result, nil
+}
+
+// deleteBlobs removes blobs on a best-effort basis
+func deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := storage.Store.Delete(ctx, key); err != nil {
+			utils.Error("unable to delete blob ", key, err)
+		}
+	}
+}
+
+// UploadProductImages stores one or more images sent as the multipart field "images"
+func UploadProductImages(c *gin.Context) {
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		imageRepo   = models.InitProductImageRepo(database.DB)
+		maxBytes    = maxImageBytes()
+	)
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	product, err := productRepo.Get(&models.Product{
+		UUID:       c.Param("product_id"),
+		MerchantID: merchantInfo.UUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes*maxImagesPerProduct+(1<<20))
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid multipart form or upload too large"})
+		return
+	}
+
+	files := form.File["images"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one file is required in field images"})
+		return
+	}
+
+	// Checked early to avoid storing the files for nothing; Append enforces it
+	existing, err := imageRepo.GetAll(product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product images"})
+		return
+	}
+	if len(existing)+len(files) > maxImagesPerProduct {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a product can have at most %d images", maxImagesPerProduct)})
+		return
+	}
+
+	var (
+		images     []*models.ProductImage
+		storedKeys []string
+	)
+	for _, fileHeader := range files {
+		if fileHeader.Size > maxBytes {
+			deleteBlobs(c, storedKeys)
+			c.JSON(http.StatusBadRequest, gin.H{"error": utils.ErrImageTooLarge.Error(), "file": fileHeader.Filename})
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			deleteBlobs(c, storedKeys)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file", "file": fileHeader.Filename})
+			return
+		}
+		data, contentType, img, err := utils.ReadImage(file, maxBytes)
+		file.Close()
+		if err != nil {
+			deleteBlobs(c, storedKeys)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "file": fileHeader.Filename})
+			return
+		}
+
+		imageUUID, _ := utils.GenerateNanoID(12, "img_")
+		stored, err := storeImage(c, fmt.Sprintf("products/%s/%s", product.UUID, imageUUID),
+			data, contentType, img, thumbnailSizes)
+		if err != nil {
+			utils.Error("unable to store product image ", err)
+			deleteBlobs(c, storedKeys)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store image", "file": fileHeader.Filename})
+			return
+		}
+		storedKeys = append(storedKeys, stored.Keys...)
+
+		thumbnails := datatypes.JSONMap{}
+		for name, url := range stored.Thumbnails {
+			thumbnails[name] = url
+		}
+
+		images = append(images, &models.ProductImage{
+			UUID:        imageUUID,
+			ProductID:   product.ID,
+			URL:         stored.URL,
+			Thumbnails:  thumbnails,
+			ContentType: contentType,
+			SizeBytes:   int64(len(data)),
+			Width:       img.Bounds().Dx(),
+			Height:      img.Bounds().Dy(),
+			StorageKeys: stored.Keys,
+		})
+	}
+
+	if err := imageRepo.Append(product.ID, images, maxImagesPerProduct); err != nil {
+		deleteBlobs(c, storedKeys)
+		if errors.Is(err, models.ErrTooManyProductImages) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a product can have at most %d images", maxImagesPerProduct)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save images"})
+		return
+	}
+
+	if err := syncPrimaryImage(product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product image"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Images uploaded", "images": images})
+}
+
+// ReorderProductImages sets the image order to the order of image_ids
+func ReorderProductImages(c *gin.Context) {
+	var (
+		request     = ReorderImagesRequest{}
+		productRepo = models.InitProductsRepo(database.DB)
+		imageRepo   = models.InitProductImageRepo(database.DB)
+	)
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	product, err := productRepo.Get(&models.Product{
+		UUID:       c.Param("product_id"),
+		MerchantID: merchantInfo.UUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	images, err := imageRepo.GetAll(product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product images"})
+		return
+	}
+
+	idsByUUID := map[string]uint{}
+	for _, img := range images {
+		idsByUUID[img.UUID] = img.ID
+	}
+
+	if len(request.ImageIDs) != len(images) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list every image of the product exactly once"})
+		return
+	}
+
+	orderedIDs := make([]uint, 0, len(request.ImageIDs))
+	for _, imageUUID := range request.ImageIDs {
+		id, ok := idsByUUID[imageUUID]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list every image of the product exactly once"})
+			return
+		}
+		delete(idsByUUID, imageUUID)
+		orderedIDs = append(orderedIDs, id)
+	}
+
+	tx := database.DB.Begin()
+	if err := imageRepo.UpdatePositionsWithTx(tx, product.ID, orderedIDs); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder images"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder images"})
+		return
+	}
+
+	if err := syncPrimaryImage(product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Images reordered"})
+}
+
+// DeleteProductImage removes an image and its thumbnails
+func DeleteProductImage(c *gin.Context) {
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		imageRepo   = models.InitProductImageRepo(database.DB)
+	)
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	product, err := productRepo.Get(&models.Product{
+		UUID:       c.Param("product_id"),
+		MerchantID: merchantInfo.UUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	img, err := imageRepo.Get(&models.ProductImage{
+		UUID:      c.Param("image_id"),
+		ProductID: product.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	}
+
+	if err := imageRepo.Delete(&models.ProductImage{UUID: img.UUID, ProductID: product.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete image"})
+		return
+	}
+	deleteBlobs(c, img.StorageKeys)
+
+	if err := syncPrimaryImage(product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted"})
+}
+
+// UploadMerchantLogo stores the multipart field "logo" and sets it as
+// Merchant.LogoURL. The blobs of the logo it replaces are removed.
+func UploadMerchantLogo(c *gin.Context) {
+	var (
+		merchantRepo = models.InitMerchantRepo(database.DB)
+		maxBytes     = maxImageBytes()
+	)
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+(1<<20))
+	file, _, err := c.Request.FormFile("logo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve file"})
+		return
+	}
+	defer file.Close()
+
+	data, contentType, img, err := utils.ReadImage(file, maxBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logoUUID, _ := utils.GenerateNanoID(12, "logo_")
+	stored, err := storeImage(c, fmt.Sprintf("merchants/%s/%s", merchantInfo.UUID, logoUUID),
+		data, contentType, img, map[string]int{"logo": merchantLogoSize})
+	if err != nil {
+		utils.Error("unable to store merchant logo ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store logo"})
+		return
+	}
+
+	if err := merchantRepo.Update(&models.Merchant{UUID: merchantInfo.UUID}, &models.Merchant{
+		LogoURL:         stored.Thumbnails["logo"],
+		LogoStorageKeys: stored.Keys,
+	}); err != nil {
+		deleteBlobs(c, stored.Keys)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update merchant"})
+		return
+	}
+	deleteBlobs(c, merchantInfo.LogoStorageKeys)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logo uploaded", "logo_url": stored.Thumbnails["logo"]})
+}
+
+// syncPrimaryImage keeps Product.ImageURL pointing at the first image
+func syncPrimaryImage(product *models.Product) error {
+	images, err := models.InitProductImageRepo(database.DB).GetAll(product.ID)
+	if err != nil {
+		return err
+	}
+
+	imageURL := ""
+	if len(images) > 0 {
+		imageURL = images[0].URL
+	}
+	if imageURL == product.ImageURL {
+		return nil
+	}
+
+	err = database.DB.Model(&models.Product{}).
+		Where("id = ?", product.ID).
+		Update("image_url", imageURL).Error
+	if err != nil {
+		utils.Error("unable to update product image url ", err)
+		return errors.New("unable to update product image url")
+	}
+	return nil
+}
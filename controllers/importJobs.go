@@ -0,0 +1,611 @@
+package controllers
+
+import (
+	"context"
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/storage"
+	"ecom/backend/utils"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	importFormatCSV  = "csv"
+	importFormatXLSX = "xlsx"
+	importFormatJSON = "json"
+
+	importBatchSize          = 50
+	defaultMaxImportBytes    = 50 << 20
+	defaultImportWorkers     = 2
+	importStatusErrorPreview = 100
+	importRequeueInterval    = time.Minute
+)
+
+var importJobQueue = make(chan string, 1000)
+
+// StartImportWorkers starts the background workers processing bulk upload jobs.
+// Pending jobs are re-queued; jobs interrupted mid-way are failed, since some
+// of their rows may already be inserted and re-running them would duplicate
+// products. Jobs left pending by a full queue are picked up once it drains.
+func StartImportWorkers() {
+	var (
+		importJobRepo = models.InitImportJobRepo(database.DB)
+		workers       = defaultImportWorkers
+	)
+
+	if n, err := strconv.Atoi(os.Getenv("IMPORT_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for jobUUID := range importJobQueue {
+				processImportJob(jobUUID)
+			}
+		}()
+	}
+
+	jobs, err := importJobRepo.GetUnfinished()
+	if err != nil {
+		utils.Error("unable to resume unfinished import jobs ", err)
+	}
+	for _, job := range jobs {
+		if job.Status == models.ImportJobStatusProcessing {
+			failImportJob(&job, fmt.Errorf("import was interrupted after %d rows", job.ProcessedRows))
+			continue
+		}
+		enqueueImportJob(job.UUID)
+	}
+
+	go func() {
+		ticker := time.NewTicker(importRequeueInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			requeuePendingImportJobs()
+		}
+	}()
+}
+
+// requeuePendingImportJobs queues the pending jobs once the queue has
+// drained, so none of them is queued twice
+func requeuePendingImportJobs() {
+	if len(importJobQueue) > 0 {
+		return
+	}
+
+	jobs, err := models.InitImportJobRepo(database.DB).GetUnfinished()
+	if err != nil {
+		utils.Error("unable to requeue pending import jobs ", err)
+		return
+	}
+	for _, job := range jobs {
+		if job.Status == models.ImportJobStatusPending {
+			enqueueImportJob(job.UUID)
+		}
+	}
+}
+
+func enqueueImportJob(jobUUID string) {
+	// Never block the request on a full queue; the job stays pending and is
+	// queued again by requeuePendingImportJobs
+	select {
+	case importJobQueue <- jobUUID:
+	default:
+		utils.Error("import queue is full, leaving job pending ", jobUUID)
+	}
+}
+
+// processImportJob parses the uploaded file and inserts its products in batches,
+// recording progress and per-row errors on the job as it goes.
+func processImportJob(jobUUID string) {
+	var (
+		importJobRepo = models.InitImportJobRepo(database.DB)
+		ctx           = context.Background()
+	)
+
+	job, err := importJobRepo.Get(&models.ImportJob{UUID: jobUUID})
+	if err != nil || job.Status != models.ImportJobStatusPending {
+		return
+	}
+
+	if claimed, err := importJobRepo.Claim(job); err != nil || !claimed {
+		return
+	}
+	utils.Info("processing import job ", job.UUID)
+
+	file, err := storage.Store.Get(ctx, job.FileKey)
+	if err != nil {
+		utils.Error("unable to read import file ", err)
+		failImportJob(job, fmt.Errorf("Failed to read uploaded file"))
+		return
+	}
+	defer file.Close()
+
+	stream := importStream{
+		job:       job,
+		repo:      importJobRepo,
+		validator: newSpecificationValidator(),
+		seenKeys:  map[string]int{},
+	}
+
+	// Rows are imported batch by batch while the file is read, so memory use
+	// does not depend on the size of the upload
+	switch job.Format {
+	case importFormatCSV:
+		err = parseCSV(file, &stream)
+	case importFormatXLSX:
+		err = parseExcel(file, job.Sheet, &stream)
+	case importFormatJSON:
+		err = parseJSON(file, &stream)
+	default:
+		err = fmt.Errorf("unsupported format %s", job.Format)
+	}
+	if err == nil {
+		err = stream.flush()
+	}
+	if err != nil {
+		failImportJob(job, err)
+		return
+	}
+
+	finishedAt := time.Now()
+	importJobRepo.Update(job, map[string]interface{}{
+		"status":      models.ImportJobStatusCompleted,
+		"finished_at": finishedAt,
+	})
+	utils.Info("import job ", job.UUID, " completed: ", stream.progress.succeeded, " succeeded, ", stream.progress.failed, " failed")
+}
+
+// importStream receives the rows of an upload as they are parsed and imports
+// them in batches of importBatchSize
+type importStream struct {
+	job       *models.ImportJob
+	repo      models.IImportJobRepo
+	validator *specificationValidator
+	seenKeys  map[string]int
+	progress  importProgress
+
+	rows     []importRow
+	failures []map[string]string
+}
+
+// add queues a parsed row, importing the batch once it is full
+func (s *importStream) add(row importRow) error {
+	s.rows = append(s.rows, row)
+	if len(s.rows) >= importBatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// fail records a row that could not be parsed
+func (s *importStream) fail(record map[string]string) error {
+	s.failures = append(s.failures, record)
+	if len(s.failures) >= importBatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush imports the queued rows and saves their errors and the job progress
+func (s *importStream) flush() error {
+	failures, rows := s.failures, s.rows
+	s.failures, s.rows = nil, nil
+
+	s.progress.total += len(rows) + len(failures)
+	s.progress.processed += len(failures)
+	s.progress.failed += len(failures)
+
+	if len(rows) > 0 {
+		result, err := importBatch(s.job, rows, s.validator, s.seenKeys)
+		if err != nil {
+			utils.Error("unable to import batch ", err)
+			return fmt.Errorf("Failed to import rows %d-%d", rows[0].Number, rows[len(rows)-1].Number)
+		}
+
+		failures = append(failures, result.failures...)
+		s.progress.processed += len(rows)
+		s.progress.failed += len(result.failures)
+		s.progress.created += result.created
+		s.progress.updated += result.updated
+		s.progress.succeeded += result.created + result.updated
+	}
+
+	if err := s.repo.AddErrors(importJobErrors(s.job, failures)); err != nil {
+		return fmt.Errorf("Failed to record row errors")
+	}
+	s.progress.save(s.repo, s.job)
+	return nil
+}
+
+type importProgress struct {
+	total, processed, succeeded, created, updated, failed int
+}
+
+func (p *importProgress) save(importJobRepo models.IImportJobRepo, job *models.ImportJob) {
+	importJobRepo.Update(job, map[string]interface{}{
+		"total_rows":     p.total,
+		"processed_rows": p.processed,
+		"succeeded_rows": p.succeeded,
+		"created_rows":   p.created,
+		"updated_rows":   p.updated,
+		"failed_rows":    p.failed,
+	})
+}
+
+type importBatchResult struct {
+	created, updated int
+	failures         []map[string]string
+}
+
+// importBatch creates or updates the products of one batch. Row level problems
+// are returned as failures; an error is only returned when the batch could not
+// be processed at all. Dry runs do all the checks but skip the writes.
+func importBatch(job *models.ImportJob, batch []importRow, validator *specificationValidator, seenKeys map[string]int) (*importBatchResult, error) {
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		result      = importBatchResult{}
+		existing    = map[string]*models.Product{}
+		creates     []*importRow
+	)
+
+	fail := func(row *importRow, err error) {
+		result.failures = append(result.failures, failedRecord(row.Number, err))
+	}
+
+	if job.Mode == models.ImportModeUpsert {
+		var keys []string
+		for i := range batch {
+			if key := batch[i].key(job.MatchBy); key != "" {
+				keys = append(keys, key)
+			}
+		}
+
+		products, err := productRepo.GetByMerchantKeys(job.MerchantID, string(job.MatchBy), keys)
+		if err != nil {
+			return nil, err
+		}
+		for i := range products {
+			existing[productKey(&products[i], job.MatchBy)] = &products[i]
+		}
+	}
+
+	for i := range batch {
+		row := &batch[i]
+
+		if job.Mode == models.ImportModeUpsert {
+			key := row.key(job.MatchBy)
+			if key == "" {
+				fail(row, fmt.Errorf("%s is required in upsert mode", job.MatchBy))
+				continue
+			}
+			if firstRow, ok := seenKeys[key]; ok {
+				fail(row, fmt.Errorf("duplicate %s %s, first seen at row %d", job.MatchBy, key, firstRow))
+				continue
+			}
+			seenKeys[key] = row.Number
+
+			if current, ok := existing[key]; ok {
+				if err := updateImportedProduct(job, row, current, validator); err != nil {
+					fail(row, err)
+					continue
+				}
+				result.updated++
+				continue
+			}
+
+			if job.MatchBy == models.ImportMatchByUUID {
+				fail(row, fmt.Errorf("product %s not found", key))
+				continue
+			}
+		}
+
+		if !row.has("price") || !row.has("stock") {
+			fail(row, fmt.Errorf("price and stock are required to create a product"))
+			continue
+		}
+
+		specifications, fieldErrors, err := validator.Validate(row.Product.Category, row.Product.Specifications)
+		if err != nil {
+			return nil, err
+		}
+		if len(fieldErrors) > 0 {
+			fail(row, &specificationsError{fields: fieldErrors})
+			continue
+		}
+
+		status := models.ProductStatusDraft
+		if target, ok := row.requestedStatus(); ok {
+			if status, err = resolveStatus(validator, models.ProductStatusDraft, target, row.Product.Category); err != nil {
+				fail(row, err)
+				continue
+			}
+		}
+		if status == models.ProductStatusPublished {
+			now := time.Now()
+			row.Product.PublishedAt = &now
+		}
+
+		row.Product.Status = status
+		row.Product.Specifications = specifications
+		row.Product.UUID = ""
+		creates = append(creates, row)
+	}
+
+	if job.DryRun || len(creates) == 0 {
+		result.created += len(creates)
+		return &result, nil
+	}
+
+	products := make([]*models.Product, 0, len(creates))
+	for _, row := range creates {
+		products = append(products, &row.Product)
+	}
+
+	if err := productRepo.CreateInBatches(products, importBatchSize, job.MerchantID); err != nil {
+		// Retry row by row so one bad row does not fail the whole batch
+		for _, row := range creates {
+			if err := productRepo.CreateInBatches([]*models.Product{&row.Product}, 1, job.MerchantID); err != nil {
+				fail(row, insertError(err))
+				continue
+			}
+			result.created++
+		}
+		return &result, nil
+	}
+
+	result.created += len(creates)
+	return &result, nil
+}
+
+// updateImportedProduct applies the columns present in the row to the existing product
+func updateImportedProduct(job *models.ImportJob, row *importRow, current *models.Product, validator *specificationValidator) error {
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		columns     []string
+	)
+
+	for _, column := range row.Columns {
+		// The key the row was matched by is not updated, nor is the uuid ever.
+		// Status columns go through the lifecycle below.
+		if column == "uuid" || column == string(job.MatchBy) || column == "status" || column == "is_active" {
+			continue
+		}
+		columns = append(columns, column)
+	}
+
+	if target, ok := row.requestedStatus(); ok {
+		category := current.Category
+		if row.has("category") {
+			category = row.Product.Category
+		}
+
+		status, err := resolveStatus(validator, current.Status, target, category)
+		if err != nil {
+			return err
+		}
+
+		isActive := status == models.ProductStatusPublished
+		row.Product.Status = status
+		row.Product.IsActive = &isActive
+		columns = append(columns, "status", "is_active")
+		if isActive && current.Status != models.ProductStatusPublished {
+			now := time.Now()
+			row.Product.PublishedAt = &now
+			columns = append(columns, "published_at")
+		}
+	}
+
+	// Re-validate the specifications whenever they or the category change
+	if row.has("category") || row.has("specifications") {
+		category, specifications := current.Category, current.Specifications
+		if row.has("category") {
+			category = row.Product.Category
+		}
+		if row.has("specifications") {
+			specifications = row.Product.Specifications
+		}
+
+		normalized, fieldErrors, err := validator.Validate(category, specifications)
+		if err != nil {
+			return fmt.Errorf("unable to validate specifications")
+		}
+		if len(fieldErrors) > 0 {
+			return &specificationsError{fields: fieldErrors}
+		}
+
+		row.Product.Specifications = normalized
+		if !row.has("specifications") {
+			columns = append(columns, "specifications")
+		}
+	}
+
+	if len(columns) == 0 || job.DryRun {
+		return nil
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := productRepo.UpdateColumnsWithTx(tx, current.ID, &row.Product, columns); err != nil {
+			return err
+		}
+		if !row.has("price") {
+			return nil
+		}
+		return models.InitPriceHistoryRepo(tx).RecordWithTx(tx, current.ID, &current.Price, row.Product.Price,
+			models.PriceChangeSourceImport, nil)
+	})
+	if err != nil {
+		return insertError(err)
+	}
+	return nil
+}
+
+// requestedStatus returns the status the row asks for; a status column takes
+// precedence over the legacy is_active column
+func (r *importRow) requestedStatus() (models.ProductStatus, bool) {
+	if r.has("status") {
+		return r.Product.Status, true
+	}
+	if r.has("is_active") {
+		return requestedStatus(nil, r.Product.IsActive)
+	}
+	return "", false
+}
+
+// key returns the value the row is matched on in upsert mode
+func (r *importRow) key(matchBy models.ImportMatchBy) string {
+	return productKey(&r.Product, matchBy)
+}
+
+func productKey(p *models.Product, matchBy models.ImportMatchBy) string {
+	if matchBy == models.ImportMatchByUUID {
+		return p.UUID
+	}
+	if p.SKU != nil {
+		return *p.SKU
+	}
+	return ""
+}
+
+// insertError turns a database error into a row error message
+func insertError(err error) error {
+	if strings.Contains(err.Error(), "idx_products_merchant_sku") {
+		return fmt.Errorf("sku already exists")
+	}
+	return fmt.Errorf("Failed to save product")
+}
+
+func failImportJob(job *models.ImportJob, err error) {
+	utils.Error("import job ", job.UUID, " failed: ", err)
+	models.InitImportJobRepo(database.DB).Update(job, map[string]interface{}{
+		"status":      models.ImportJobStatusFailed,
+		"error":       err.Error(),
+		"finished_at": time.Now(),
+	})
+}
+
+func importJobErrors(job *models.ImportJob, failedRecords []map[string]string) []*models.ImportJobError {
+	errs := make([]*models.ImportJobError, 0, len(failedRecords))
+	for _, record := range failedRecords {
+		rowNumber, _ := strconv.Atoi(record["row"])
+		values := datatypes.JSONMap{}
+		for key, value := range record {
+			values[key] = value
+		}
+		errs = append(errs, &models.ImportJobError{
+			JobID:     job.ID,
+			RowNumber: rowNumber,
+			Record:    values,
+		})
+	}
+	return errs
+}
+
+// importJobForMerchant loads the job from the path for the authenticated merchant
+func importJobForMerchant(c *gin.Context) (*models.ImportJob, bool) {
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return nil, false
+	}
+
+	job, err := models.InitImportJobRepo(database.DB).Get(&models.ImportJob{
+		UUID:       c.Param("job_id"),
+		MerchantID: merchantInfo.UUID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "import job not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get import job"})
+		return nil, false
+	}
+	return job, true
+}
+
+// GetImportJob reports the progress of a bulk upload and a preview of its failed rows
+func GetImportJob(c *gin.Context) {
+	job, ok := importJobForMerchant(c)
+	if !ok {
+		return
+	}
+
+	jobErrors, err := models.InitImportJobRepo(database.DB).GetErrors(job.ID, importStatusErrorPreview)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get import errors"})
+		return
+	}
+
+	failedRecords := make([]datatypes.JSONMap, 0, len(jobErrors))
+	for _, jobError := range jobErrors {
+		failedRecords = append(failedRecords, jobError.Record)
+	}
+
+	response := gin.H{
+		"job":            job,
+		"failed_records": failedRecords,
+	}
+	if job.FailedRows > 0 {
+		response["error_report_url"] = fmt.Sprintf("/products/upload/jobs/%s/errors", job.UUID)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadImportJobErrors streams every failed row of the job as a CSV report
+func DownloadImportJobErrors(c *gin.Context) {
+	job, ok := importJobForMerchant(c)
+	if !ok {
+		return
+	}
+
+	jobErrors, err := models.InitImportJobRepo(database.DB).GetErrors(job.ID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get import errors"})
+		return
+	}
+
+	// Field level errors (e.g. specifications.ram_gb) become extra columns
+	columns := []string{"row", "error"}
+	seen := map[string]bool{"row": true, "error": true}
+	var extra []string
+	for _, jobError := range jobErrors {
+		for key := range jobError.Record {
+			if !seen[key] {
+				seen[key] = true
+				extra = append(extra, key)
+			}
+		}
+	}
+	sort.Strings(extra)
+	columns = append(columns, extra...)
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_errors.csv"`, job.UUID))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(columns)
+	for _, jobError := range jobErrors {
+		line := make([]string, len(columns))
+		for i, column := range columns {
+			if value, ok := jobError.Record[column]; ok {
+				line[i] = fmt.Sprint(value)
+			}
+		}
+		writer.Write(line)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMerchantOrderPageSize = 20
+	maxMerchantOrderPageSize     = 100
+)
+
+type MerchantOrderStatusRequest struct {
+	Status models.MerchantOrderStatus `json:"status" binding:"required"`
+}
+
+// merchantOrderFromPath loads the merchant's order named by the order_id path parameter
+func merchantOrderFromPath(c *gin.Context) (*models.MerchantOrder, bool) {
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return nil, false
+	}
+
+	merchantOrder, err := models.InitMerchantOrderRepo(database.DB).Get(&models.MerchantOrder{
+		UUID:       c.Param("order_id"),
+		MerchantID: merchantInfo.UUID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get order"})
+		return nil, false
+	}
+	return merchantOrder, true
+}
+
+// ListMerchantOrders lists the merchant's parts of orders, optionally by status
+func ListMerchantOrders(c *gin.Context) {
+	var (
+		merchantOrderRepo = models.InitMerchantOrderRepo(database.DB)
+		page              = 1
+		limit             = defaultMerchantOrderPageSize
+	)
+
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxMerchantOrderPageSize)
+	}
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	orders, total, err := merchantOrderRepo.ListByMerchant(merchantInfo.UUID,
+		models.MerchantOrderStatus(c.Query("status")), limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": orders,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// GetMerchantOrder returns one of the merchant's parts of an order with its items
+func GetMerchantOrder(c *gin.Context) {
+	merchantOrder, ok := merchantOrderFromPath(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, merchantOrder)
+}
+
+// UpdateMerchantOrderStatus moves the merchant's part of an order along as
+// they fulfil it: PLACED to SHIPPED or CANCELLED, SHIPPED to DELIVERED
+func UpdateMerchantOrderStatus(c *gin.Context) {
+	var (
+		request = MerchantOrderStatusRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+
+	merchantOrder, ok := merchantOrderFromPath(c)
+	if !ok {
+		return
+	}
+
+	if !merchantOrder.Status.CanTransition(request.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": models.ErrInvalidMerchantOrderTransition.Error(),
+			"from":  merchantOrder.Status,
+			"to":    request.Status,
+		})
+		return
+	}
+
+	updated, err := models.InitMerchantOrderRepo(database.DB).UpdateStatus(merchantOrder, request.Status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	if !updated {
+		c.JSON(http.StatusConflict, gin.H{"error": "order status changed, reload it and try again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, merchantOrder)
+}
@@ -4,6 +4,7 @@ import (
 	"ecom/backend/constants"
 	"ecom/backend/database"
 	"ecom/backend/errResponse"
+	"ecom/backend/middleware"
 	"ecom/backend/models"
 	"ecom/backend/utils"
 	"fmt"
@@ -150,3 +151,33 @@ func OnBoardingMerchant(c *gin.Context) {
 		"access_token": token,
 	})
 }
+
+// merchantFromContext loads the merchant of the authenticated account. When it
+// fails the error response is already written and ok is false.
+func merchantFromContext(c *gin.Context) (*models.Merchant, bool) {
+	var (
+		merchantRepo = models.InitMerchantRepo(database.DB)
+	)
+
+	// Get merchant UUID from the context (set by AuthMiddleware)
+	accountUUID := c.GetString(middleware.AccountUUIDContextKey)
+	if accountUUID == "" {
+		utils.Error("failed to get account uuid")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "failed to get account uuid",
+		})
+		return nil, false
+	}
+
+	merchantInfo, err := merchantRepo.Get(&models.Merchant{
+		AccountUUID: accountUUID,
+	})
+	if err != nil || merchantInfo == nil {
+		utils.Error("error in getting merchant || err: ", err)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "error in getting merchant",
+		})
+		return nil, false
+	}
+	return merchantInfo, true
+}
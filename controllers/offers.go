@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOfferPageSize = 20
+	maxOfferPageSize     = 100
+)
+
+type OfferRequest struct {
+	Discount    float64   `json:"discount" binding:"required"`
+	ExpiresAt   time.Time `json:"expires_at" binding:"required"`
+	Description string    `json:"description"`
+}
+
+type CreateOfferRequest struct {
+	OfferRequest
+	ProductID string `json:"product_id" binding:"required"`
+	IsActive  bool   `json:"is_active"`
+}
+
+type OfferResponse struct {
+	UUID           string    `json:"uuid"`
+	ProductID      string    `json:"product_id,omitempty"`
+	ProductSlug    string    `json:"product_slug,omitempty"`
+	ProductTitle   string    `json:"product_title,omitempty"`
+	Price          uint      `json:"price"`
+	EffectivePrice uint      `json:"effective_price"`
+	Discount       float64   `json:"discount"`
+	Description    string    `json:"description,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	IsActive       bool      `json:"is_active"`
+}
+
+// validate reports what is wrong with the request, if anything
+func (r *OfferRequest) validate() string {
+	switch {
+	case r.Discount <= 0 || r.Discount >= 100:
+		return "discount must be a percentage between 0 and 100"
+	case !r.ExpiresAt.After(time.Now()):
+		return "expires_at must be in the future"
+	}
+	return ""
+}
+
+// offerResponse describes the offer with the price of its product after the discount
+func offerResponse(offer *models.Offer) OfferResponse {
+	response := OfferResponse{
+		UUID:        offer.UUID,
+		Discount:    offer.Discount,
+		Description: offer.Description,
+		ExpiresAt:   offer.ExpiresAt,
+		IsActive:    offer.IsActive,
+	}
+	if offer.Product != nil {
+		response.ProductID = offer.Product.UUID
+		response.ProductSlug = offer.Product.Slug
+		response.ProductTitle = offer.Product.Title
+		response.Price = offer.Product.Price
+		response.EffectivePrice = models.DiscountedPrice(offer.Product.Price, offer.Discount)
+	}
+	return response
+}
+
+// offerDiscounts returns the discount of the best offer applying to each of
+// the products, for the products that have one
+func offerDiscounts(products ...*models.Product) (map[uint]float64, error) {
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	return models.InitOfferRepo(database.DB).ActiveDiscounts(ids, time.Now())
+}
+
+// productPointers points at each of the products
+func productPointers(products []models.Product) []*models.Product {
+	pointers := make([]*models.Product, 0, len(products))
+	for i := range products {
+		pointers = append(pointers, &products[i])
+	}
+	return pointers
+}
+
+// effectivePrice is what a product sells for with the given offer discount
+func effectivePrice(product *models.Product, discounts map[uint]float64) uint {
+	return models.DiscountedPrice(product.Price, discounts[product.ID])
+}
+
+// offerFromPath loads the offer named by the offer_id path parameter when it
+// is on one of the authenticated merchant's products
+func offerFromPath(c *gin.Context) (*models.Offer, bool) {
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return nil, false
+	}
+
+	offer, err := models.InitOfferRepo(database.DB).GetForMerchant(c.Param("offer_id"), merchantInfo.UUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "offer not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get offer"})
+		return nil, false
+	}
+	return offer, true
+}
+
+// ListActiveOffers lists the offers currently applying to live products,
+// ending soonest first
+func ListActiveOffers(c *gin.Context) {
+	var (
+		offerRepo = models.InitOfferRepo(database.DB)
+		page      = 1
+		limit     = defaultOfferPageSize
+	)
+
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxOfferPageSize)
+	}
+
+	offers, total, err := offerRepo.ListActive(time.Now(), limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list offers"})
+		return
+	}
+
+	response := make([]OfferResponse, 0, len(offers))
+	for i := range offers {
+		response = append(response, offerResponse(&offers[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"offers": response,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// ListMerchantOffers lists the offers on the merchant's products, active or not
+func ListMerchantOffers(c *gin.Context) {
+	var (
+		offerRepo = models.InitOfferRepo(database.DB)
+		page      = 1
+		limit     = defaultOfferPageSize
+	)
+
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxOfferPageSize)
+	}
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	offers, total, err := offerRepo.ListByMerchant(merchantInfo.UUID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list offers"})
+		return
+	}
+
+	response := make([]OfferResponse, 0, len(offers))
+	for i := range offers {
+		response = append(response, offerResponse(&offers[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"offers": response,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// CreateOffer creates an offer on one of the merchant's products. Offers are
+// created inactive unless is_active is set.
+func CreateOffer(c *gin.Context) {
+	var (
+		request = CreateOfferRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+	if problem := request.validate(); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	product, err := models.InitProductsRepo(database.DB).Get(&models.Product{
+		UUID:       request.ProductID,
+		MerchantID: merchantInfo.UUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	offer := models.Offer{
+		ProductID:   product.ID,
+		Discount:    request.Discount,
+		ExpiresAt:   request.ExpiresAt,
+		Description: request.Description,
+		IsActive:    request.IsActive,
+	}
+	if err := models.InitOfferRepo(database.DB).Create(&offer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create offer"})
+		return
+	}
+	offer.Product = product
+
+	c.JSON(http.StatusCreated, offerResponse(&offer))
+}
+
+// UpdateOffer replaces the discount, expiry and description of one of the merchant's offers
+func UpdateOffer(c *gin.Context) {
+	var (
+		request = OfferRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+	if problem := request.validate(); problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	offer, ok := offerFromPath(c)
+	if !ok {
+		return
+	}
+
+	offer.Discount = request.Discount
+	offer.ExpiresAt = request.ExpiresAt
+	offer.Description = request.Description
+	err := models.InitOfferRepo(database.DB).Update(offer, []string{"discount", "expires_at", "description"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update offer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, offerResponse(offer))
+}
+
+// ActivateOffer makes one of the merchant's offers apply to its product until it expires
+func ActivateOffer(c *gin.Context) {
+	setOfferActive(c, true)
+}
+
+// DeactivateOffer stops one of the merchant's offers from applying
+func DeactivateOffer(c *gin.Context) {
+	setOfferActive(c, false)
+}
+
+func setOfferActive(c *gin.Context, active bool) {
+	offer, ok := offerFromPath(c)
+	if !ok {
+		return
+	}
+
+	if active && !offer.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offer has expired, extend expires_at first"})
+		return
+	}
+
+	offer.IsActive = active
+	if err := models.InitOfferRepo(database.DB).Update(offer, []string{"is_active"}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update offer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, offerResponse(offer))
+}
+
+// DeleteOffer deletes one of the merchant's offers
+func DeleteOffer(c *gin.Context) {
+	offer, ok := offerFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := models.InitOfferRepo(database.DB).Delete(offer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete offer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "offer deleted"})
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/payments"
+	"ecom/backend/utils"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	paymentEventWorkers         = 2
+	maxWebhookBytes             = 1 << 20
+	defaultPaymentEventPageSize = 50
+	maxPaymentEventPageSize     = 200
+)
+
+var paymentEventQueue = make(chan uint, 1000)
+
+// StartPaymentEventWorkers starts the background workers applying payment
+// webhook events to checkouts, and queues the events a restart interrupted.
+// Processing an event again is safe, as it only acts on pending checkouts.
+func StartPaymentEventWorkers() {
+	var (
+		eventRepo = models.InitPaymentEventRepo(database.DB)
+	)
+
+	for i := 0; i < paymentEventWorkers; i++ {
+		go func() {
+			for eventID := range paymentEventQueue {
+				processPaymentEvent(eventID)
+			}
+		}()
+	}
+
+	events, err := eventRepo.GetUnfinished()
+	if err != nil {
+		utils.Error("unable to resume unfinished payment events ", err)
+		return
+	}
+	for i := range events {
+		if requeued, err := eventRepo.Requeue(&events[i], true); err == nil && requeued {
+			enqueuePaymentEvent(events[i].ID)
+		}
+	}
+}
+
+func enqueuePaymentEvent(eventID uint) {
+	// Never block the webhook on a full queue; the event stays received and is
+	// processed on the next start or when replayed
+	select {
+	case paymentEventQueue <- eventID:
+	default:
+		utils.Error("payment event queue is full, leaving event received ", eventID)
+	}
+}
+
+// processPaymentEvent settles the checkout paid by the event's payment intent.
+// The intent's state is fetched from the provider rather than taken from the
+// event, so events arriving late or out of order do no harm.
+func processPaymentEvent(eventID uint) {
+	var (
+		eventRepo    = models.InitPaymentEventRepo(database.DB)
+		checkoutRepo = models.InitCheckoutrepo(database.DB)
+	)
+
+	event, err := eventRepo.Get(&models.PaymentEvent{ID: eventID})
+	if err != nil || event.Status != models.PaymentEventStatusReceived {
+		return
+	}
+	if claimed, err := eventRepo.Claim(event); err != nil || !claimed {
+		return
+	}
+
+	checkout, err := checkoutRepo.Get(&models.Checkout{
+		PaymentProvider: event.Provider,
+		PaymentIntentID: event.IntentID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			eventRepo.Finish(event, models.PaymentEventStatusFailed, "no checkout for payment intent "+event.IntentID)
+			return
+		}
+		eventRepo.Finish(event, models.PaymentEventStatusFailed, err.Error())
+		return
+	}
+
+	if checkout.Status != models.CheckoutStatusPending {
+		eventRepo.Finish(event, models.PaymentEventStatusProcessed, "")
+		return
+	}
+
+	err = settleCheckout(context.Background(), checkout)
+	switch {
+	case err == nil, errors.Is(err, errPaymentFailed),
+		errors.Is(err, errPaymentNotPaid), errors.Is(err, errPaymentProcessing):
+		eventRepo.Finish(event, models.PaymentEventStatusProcessed, "")
+		utils.Info("processed payment event "+event.EventID+" for checkout ", checkout.CheckoutID)
+	default:
+		// Settled concurrently by the customer completing the checkout
+		if current, getErr := checkoutRepo.Get(&models.Checkout{CheckoutID: checkout.CheckoutID}); getErr == nil &&
+			current.Status != models.CheckoutStatusPending {
+			eventRepo.Finish(event, models.PaymentEventStatusProcessed, "")
+			return
+		}
+		eventRepo.Finish(event, models.PaymentEventStatusFailed, err.Error())
+	}
+}
+
+// ReceivePaymentWebhook records a signed webhook event of the payment provider
+// and queues it for processing. Events already received are acknowledged
+// without being processed again.
+func ReceivePaymentWebhook(c *gin.Context) {
+	var (
+		eventRepo = models.InitPaymentEventRepo(database.DB)
+	)
+
+	provider := payments.Provider
+	if c.Param("provider") != provider.Name() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown payment provider"})
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBytes+1))
+	if err != nil || len(payload) > maxWebhookBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook payload"})
+		return
+	}
+
+	event, err := provider.ParseWebhook(c.Request.Header, payload)
+	if err != nil {
+		utils.Error("rejected payment webhook ", err)
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook payload"})
+		return
+	}
+
+	record := models.PaymentEvent{
+		Provider: provider.Name(),
+		EventID:  event.ID,
+		Type:     event.Type,
+		IntentID: event.IntentID,
+		Payload:  payload,
+		Status:   models.PaymentEventStatusReceived,
+	}
+	created, err := eventRepo.Create(&record)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record event"})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+		return
+	}
+
+	enqueuePaymentEvent(record.ID)
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// ListPaymentEvents lists received payment webhook events, optionally by status
+func ListPaymentEvents(c *gin.Context) {
+	var (
+		eventRepo = models.InitPaymentEventRepo(database.DB)
+		page      = 1
+		limit     = defaultPaymentEventPageSize
+	)
+
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxPaymentEventPageSize)
+	}
+
+	events, total, err := eventRepo.List(models.PaymentEventStatus(c.Query("status")), limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list payment events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// ReplayPaymentEvent processes a stored payment event again, e.g. after a
+// failure was fixed
+func ReplayPaymentEvent(c *gin.Context) {
+	var (
+		eventRepo = models.InitPaymentEventRepo(database.DB)
+	)
+
+	id, err := strconv.ParseUint(c.Param("event_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment event not found"})
+		return
+	}
+
+	event, err := eventRepo.Get(&models.PaymentEvent{ID: uint(id)})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "payment event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get payment event"})
+		return
+	}
+
+	requeued, err := eventRepo.Requeue(event, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replay payment event"})
+		return
+	}
+	if !requeued {
+		c.JSON(http.StatusConflict, gin.H{"error": "payment event is being processed"})
+		return
+	}
+
+	enqueuePaymentEvent(event.ID)
+	c.JSON(http.StatusAccepted, event)
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/payments"
+	"ecom/backend/utils"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errPaymentMismatch is returned when a payment intent is not for the checkout's amount and currency
+	errPaymentMismatch    = errors.New("payment does not match the checkout")
+	errPaymentProvider    = errors.New("payment provider error")
+	errPaymentNotPaid     = errors.New("checkout has not been paid")
+	errPaymentProcessing  = errors.New("payment is processing")
+	errPaymentFailed      = errors.New("payment failed")
+	errCheckoutNotPending = errors.New("checkout is no longer pending")
+)
+
+type ConfirmMockPaymentRequest struct {
+	PaymentMethod string `json:"payment_method" binding:"required"`
+}
+
+// createCheckoutPayment opens a payment intent for the checkout's total
+func createCheckoutPayment(ctx context.Context, checkout *models.Checkout) (*payments.Intent, error) {
+	intent, err := payments.Provider.CreateIntent(ctx, payments.CreateIntentRequest{
+		Reference: checkout.CheckoutID,
+		Amount:    int64(checkout.TotalAmount),
+		Currency:  storeCurrency(),
+	})
+	if err != nil {
+		utils.Error("unable to create payment intent ", err)
+		return nil, err
+	}
+	return intent, nil
+}
+
+// verifyCheckoutPayment fetches the checkout's payment intent from the
+// provider and checks that it pays exactly the checkout's total
+func verifyCheckoutPayment(ctx context.Context, checkout *models.Checkout) (*payments.Intent, error) {
+	intent, err := payments.Provider.Verify(ctx, checkout.PaymentIntentID)
+	if err != nil {
+		utils.Error("unable to verify payment intent ", err)
+		return nil, fmt.Errorf("%w: %v", errPaymentProvider, err)
+	}
+
+	if intent.Reference != checkout.CheckoutID ||
+		intent.Amount != int64(checkout.TotalAmount) ||
+		intent.Currency != storeCurrency() {
+		utils.Error(fmt.Sprintf("payment intent %s of %d %s for %s does not match checkout %s of %d %s",
+			intent.ID, intent.Amount, intent.Currency, intent.Reference,
+			checkout.CheckoutID, checkout.TotalAmount, storeCurrency()))
+		return nil, errPaymentMismatch
+	}
+	return intent, nil
+}
+
+// settleCheckout verifies the payment of a pending checkout with the provider
+// and acts on its state: a failed payment fails the checkout, an authorized
+// one is captured and completes it. A payment captured for a checkout that
+// cannot be completed is refunded. Unpaid and processing payments are
+// reported as errPaymentNotPaid and errPaymentProcessing.
+func settleCheckout(ctx context.Context, checkout *models.Checkout) error {
+	var (
+		checkoutRepo = models.InitCheckoutrepo(database.DB)
+	)
+
+	intent, err := verifyCheckoutPayment(ctx, checkout)
+	if err != nil {
+		return err
+	}
+
+	switch intent.Status {
+	case payments.IntentRequiresPaymentMethod:
+		return errPaymentNotPaid
+	case payments.IntentProcessing:
+		return errPaymentProcessing
+	case payments.IntentFailed:
+		if _, err := checkoutRepo.Fail(checkout); err != nil {
+			return err
+		}
+		return errPaymentFailed
+	case payments.IntentRequiresCapture:
+		if intent, err = payments.Provider.Capture(ctx, intent.ID); err != nil {
+			utils.Error("unable to capture payment intent ", err)
+			return fmt.Errorf("%w: %v", errPaymentProvider, err)
+		}
+	}
+
+	completed, err := finishCheckout(checkout, intent)
+	if err != nil {
+		refundCheckoutPayment(ctx, intent)
+		return err
+	}
+	if !completed {
+		// Completed concurrently through the same payment, or expired meanwhile
+		current, err := checkoutRepo.Get(&models.Checkout{CheckoutID: checkout.CheckoutID})
+		if err != nil || current.Status != models.CheckoutStatusCompleted {
+			refundCheckoutPayment(ctx, intent)
+			return errCheckoutNotPending
+		}
+	}
+	return nil
+}
+
+// refundCheckoutPayment gives back a captured payment whose checkout could not be completed
+func refundCheckoutPayment(ctx context.Context, intent *payments.Intent) {
+	if _, err := payments.Provider.Refund(ctx, intent.ID, intent.Amount); err != nil {
+		utils.Error("unable to refund payment intent "+intent.ID+" ", err)
+		return
+	}
+	utils.Info("refunded payment intent ", intent.ID)
+}
+
+// ConfirmMockPayment plays the customer's side of a mock payment, paying the
+// intent with pm_mock_success, pm_mock_failure or pm_mock_pending. It is only
+// routed when the mock payment provider is in use.
+func ConfirmMockPayment(c *gin.Context) {
+	var (
+		request = ConfirmMockPaymentRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	mock, ok := payments.Provider.(*payments.MockProvider)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "mock payments are not enabled"})
+		return
+	}
+
+	intent, err := mock.Confirm(c.Param("intent_id"), request.PaymentMethod)
+	if err != nil {
+		if errors.Is(err, payments.ErrIntentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, intent)
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+	"ecom/backend/models"
+	"ecom/backend/payments"
+	"errors"
+	"testing"
+)
+
+func TestVerifyCheckoutPayment(t *testing.T) {
+	t.Setenv("STORE_CURRENCY", "usd")
+
+	provider := payments.NewMockProvider("", "")
+	previous := payments.Provider
+	payments.Provider = provider
+	t.Cleanup(func() { payments.Provider = previous })
+
+	newIntent := func(reference string, amount int64, currency string) string {
+		intent, err := provider.CreateIntent(context.Background(), payments.CreateIntentRequest{
+			Reference: reference,
+			Amount:    amount,
+			Currency:  currency,
+		})
+		if err != nil {
+			t.Fatalf("CreateIntent() = %v", err)
+		}
+		return intent.ID
+	}
+
+	tests := []struct {
+		name     string
+		intentID string
+		wantErr  error
+	}{
+		{name: "matching", intentID: newIntent("chk_1", 2500, "USD")},
+		{name: "amount below the total", intentID: newIntent("chk_1", 2499, "USD"), wantErr: errPaymentMismatch},
+		{name: "amount above the total", intentID: newIntent("chk_1", 2501, "USD"), wantErr: errPaymentMismatch},
+		{name: "other currency", intentID: newIntent("chk_1", 2500, "EUR"), wantErr: errPaymentMismatch},
+		{name: "lower case currency", intentID: newIntent("chk_1", 2500, "usd"), wantErr: errPaymentMismatch},
+		{name: "other checkout", intentID: newIntent("chk_2", 2500, "USD"), wantErr: errPaymentMismatch},
+		{name: "unknown intent", intentID: "pi_mock_missing", wantErr: errPaymentProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkout := &models.Checkout{CheckoutID: "chk_1", TotalAmount: 2500, PaymentIntentID: tt.intentID}
+
+			intent, err := verifyCheckoutPayment(context.Background(), checkout)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("verifyCheckoutPayment() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyCheckoutPayment() = %v, want nil", err)
+			}
+			if intent.ID != tt.intentID {
+				t.Fatalf("verifyCheckoutPayment() returned intent %s, want %s", intent.ID, tt.intentID)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPriceHistoryDays       = 90
+	maxPriceHistoryDays           = 365
+	lowestPriceWindow             = 30 * 24 * time.Hour
+	defaultPriceSchedulerInterval = time.Minute
+)
+
+type PriceScheduleRequest struct {
+	Price    uint       `json:"price" binding:"required"`
+	StartsAt time.Time  `json:"starts_at" binding:"required"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+type PriceHistoryResponse struct {
+	CurrentPrice      uint                         `json:"current_price"`
+	LowestPrice30Days uint                         `json:"lowest_price_30_days"`
+	History           []models.ProductPriceHistory `json:"history"`
+}
+
+// StartPriceScheduler applies due price schedules in the background. The
+// interval is configurable via PRICE_SCHEDULER_INTERVAL (e.g. "30s").
+func StartPriceScheduler() {
+	interval := defaultPriceSchedulerInterval
+	if d, err := time.ParseDuration(os.Getenv("PRICE_SCHEDULER_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			applyDuePriceSchedules()
+			<-ticker.C
+		}
+	}()
+}
+
+func applyDuePriceSchedules() {
+	var (
+		priceRepo = models.InitPriceHistoryRepo(database.DB)
+		now       = time.Now()
+	)
+
+	schedules, err := priceRepo.DueSchedules(now)
+	if err != nil {
+		return
+	}
+
+	for i := range schedules {
+		applied, err := priceRepo.ApplySchedule(&schedules[i], now)
+		if err == nil && applied {
+			utils.Info("applied price schedule ", schedules[i].UUID)
+		}
+	}
+}
+
+// lowestRecentPrice returns the lowest price of the product over the last 30 days
+func lowestRecentPrice(product *models.Product) (uint, error) {
+	return models.InitPriceHistoryRepo(database.DB).LowestSince(product.ID, time.Now().Add(-lowestPriceWindow))
+}
+
+// GetPriceHistory returns the price changes of a product over the last `days` days
+func GetPriceHistory(c *gin.Context) {
+	var (
+		priceRepo = models.InitPriceHistoryRepo(database.DB)
+		days      = defaultPriceHistoryDays
+	)
+
+	if d, err := strconv.Atoi(c.Query("days")); err == nil && d > 0 {
+		days = min(d, maxPriceHistoryDays)
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+	if !canViewProduct(c, product) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	history, err := priceRepo.List(product.ID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get price history"})
+		return
+	}
+
+	lowest, err := lowestRecentPrice(product)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PriceHistoryResponse{
+		CurrentPrice:      product.Price,
+		LowestPrice30Days: lowest,
+		History:           history,
+	})
+}
+
+// merchantProductFromPath loads the product named by the product_id path parameter
+// when it belongs to the authenticated merchant
+func merchantProductFromPath(c *gin.Context) (*models.Product, bool) {
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return nil, false
+	}
+
+	product, err := models.InitProductsRepo(database.DB).Get(&models.Product{
+		UUID:       c.Param("product_id"),
+		MerchantID: merchantInfo.UUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return nil, false
+	}
+	return product, true
+}
+
+// CreatePriceSchedule schedules a future price change for one of the merchant's products
+func CreatePriceSchedule(c *gin.Context) {
+	var (
+		request   = PriceScheduleRequest{}
+		priceRepo = models.InitPriceHistoryRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if request.EndsAt != nil && !request.EndsAt.After(request.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+	if request.EndsAt != nil && request.EndsAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be in the future"})
+		return
+	}
+
+	product, ok := merchantProductFromPath(c)
+	if !ok {
+		return
+	}
+
+	overlaps, err := priceRepo.HasOverlappingSchedule(product.ID, request.StartsAt, request.EndsAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check price schedules"})
+		return
+	}
+	if overlaps {
+		c.JSON(http.StatusConflict, gin.H{"error": "another price schedule overlaps this window"})
+		return
+	}
+
+	schedule := models.PriceSchedule{
+		ProductID: product.ID,
+		Price:     request.Price,
+		StartsAt:  request.StartsAt,
+		EndsAt:    request.EndsAt,
+		Status:    models.PriceScheduleStatusScheduled,
+	}
+	if err := priceRepo.CreateSchedule(&schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create price schedule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListPriceSchedules lists the price schedules of one of the merchant's products
+func ListPriceSchedules(c *gin.Context) {
+	product, ok := merchantProductFromPath(c)
+	if !ok {
+		return
+	}
+
+	schedules, err := models.InitPriceHistoryRepo(database.DB).ListSchedules(product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get price schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// CancelPriceSchedule cancels a schedule that has not started yet. An active
+// schedule is ended now instead, so the scheduler restores the previous price.
+func CancelPriceSchedule(c *gin.Context) {
+	var (
+		priceRepo = models.InitPriceHistoryRepo(database.DB)
+	)
+
+	product, ok := merchantProductFromPath(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := priceRepo.GetSchedule(&models.PriceSchedule{
+		UUID:      c.Param("schedule_id"),
+		ProductID: product.ID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "price schedule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get price schedule"})
+		return
+	}
+
+	now := time.Now()
+	switch schedule.Status {
+	case models.PriceScheduleStatusScheduled:
+		err = priceRepo.UpdateSchedule(schedule, map[string]interface{}{
+			"status":      models.PriceScheduleStatusCancelled,
+			"finished_at": now,
+		})
+	case models.PriceScheduleStatusActive:
+		err = priceRepo.UpdateSchedule(schedule, map[string]interface{}{"ends_at": now})
+		if err == nil {
+			schedule.EndsAt = &now
+			_, err = priceRepo.ApplySchedule(schedule, now)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price schedule has already finished"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel price schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "price schedule cancelled"})
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+const exportBatchSize = 500
+
+// exportColumns are written first, followed by one spec.<key> column per specification key.
+// They use the same headers mapRowToProduct reads, so an export can be edited and re-uploaded.
+var exportColumns = []string{"uuid", "sku", "title", "description", "price", "stock", "category", "image_url", "is_active", "status"}
+
+// ExportProducts streams the merchant's catalogue as csv, xlsx or json
+func ExportProducts(c *gin.Context) {
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		format      = c.DefaultQuery("format", importFormatCSV)
+	)
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	if format != importFormatCSV && format != importFormatXLSX && format != importFormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of csv, xlsx, json"})
+		return
+	}
+
+	specKeys, err := productRepo.SpecificationKeys(merchantInfo.UUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export products"})
+		return
+	}
+
+	headers := append([]string{}, exportColumns...)
+	for _, key := range specKeys {
+		headers = append(headers, specFilterPrefix+key)
+	}
+
+	fileName := fmt.Sprintf("products_%s.%s", time.Now().Format("20060102_150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+
+	switch format {
+	case importFormatCSV:
+		err = exportCSV(c, productRepo, merchantInfo.UUID, headers, specKeys)
+	case importFormatXLSX:
+		err = exportExcel(c, productRepo, merchantInfo.UUID, headers, specKeys)
+	case importFormatJSON:
+		err = exportJSON(c, productRepo, merchantInfo.UUID)
+	}
+
+	// Headers are already sent once streaming started, so only log the failure
+	if err != nil {
+		utils.Error("unable to export products ", err)
+	}
+}
+
+func exportCSV(c *gin.Context, productRepo models.IProductRepo, merchantID string, headers, specKeys []string) error {
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write(headers); err != nil {
+		return err
+	}
+
+	return productRepo.FindByMerchantInBatches(merchantID, exportBatchSize, func(products []models.Product) error {
+		for i := range products {
+			if err := writer.Write(exportRow(&products[i], specKeys)); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		c.Writer.Flush()
+		return writer.Error()
+	})
+}
+
+func exportExcel(c *gin.Context, productRepo models.IProductRepo, merchantID string, headers, specKeys []string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheetName := f.GetSheetName(0)
+	streamWriter, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return err
+	}
+
+	rowNumber := 1
+	writeRow := func(values []string) error {
+		cells := make([]interface{}, len(values))
+		for i, value := range values {
+			cells[i] = value
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, rowNumber)
+		rowNumber++
+		return streamWriter.SetRow(cell, cells)
+	}
+
+	if err := writeRow(headers); err != nil {
+		return err
+	}
+
+	err = productRepo.FindByMerchantInBatches(merchantID, exportBatchSize, func(products []models.Product) error {
+		for i := range products {
+			if err := writeRow(exportRow(&products[i], specKeys)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := streamWriter.Flush(); err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Status(http.StatusOK)
+	return f.Write(c.Writer)
+}
+
+func exportJSON(c *gin.Context, productRepo models.IProductRepo, merchantID string) error {
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	first := true
+
+	if _, err := c.Writer.Write([]byte("[")); err != nil {
+		return err
+	}
+
+	err := productRepo.FindByMerchantInBatches(merchantID, exportBatchSize, func(products []models.Product) error {
+		for i := range products {
+			if !first {
+				if _, err := c.Writer.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			first = false
+
+			p := &products[i]
+			record := map[string]interface{}{
+				"uuid":           p.UUID,
+				"sku":            p.SKU,
+				"title":          p.Title,
+				"description":    p.Description,
+				"price":          p.Price,
+				"stock":          p.Stock,
+				"category":       p.Category,
+				"image_url":      p.ImageURL,
+				"is_active":      p.IsActive != nil && *p.IsActive,
+				"status":         p.Status,
+				"specifications": p.Specifications,
+			}
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Writer.Write([]byte("]"))
+	return err
+}
+
+// exportRow renders a product as the cells of exportColumns followed by its flattened specifications
+func exportRow(p *models.Product, specKeys []string) []string {
+	sku := ""
+	if p.SKU != nil {
+		sku = *p.SKU
+	}
+
+	row := []string{
+		p.UUID,
+		sku,
+		p.Title,
+		p.Description,
+		strconv.FormatUint(uint64(p.Price), 10),
+		strconv.FormatUint(uint64(p.Stock), 10),
+		p.Category,
+		p.ImageURL,
+		strconv.FormatBool(p.IsActive != nil && *p.IsActive),
+		string(p.Status),
+	}
+
+	specs := map[string]interface{}{}
+	if len(p.Specifications) > 0 {
+		json.Unmarshal(p.Specifications, &specs)
+	}
+
+	for _, key := range specKeys {
+		row = append(row, exportSpecificationCell(specs[key]))
+	}
+	return row
+}
+
+// exportSpecificationCell is the inverse of parseSpecificationCell. Strings
+// that would import as something else, like "8", "true" or "", are written
+// JSON quoted so they import as strings again.
+func exportSpecificationCell(value interface{}) string {
+	text, ok := value.(string)
+	if !ok {
+		return formatSpecificationCell(value)
+	}
+	if parsed, ok := parseSpecificationCell(text); ok {
+		if parsed, ok := parsed.(string); ok && parsed == text {
+			return text
+		}
+	}
+	quoted, _ := json.Marshal(text)
+	return string(quoted)
+}
+
+// formatSpecificationCell renders a specification value as plain text
+func formatSpecificationCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+}
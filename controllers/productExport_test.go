@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"bytes"
+	"ecom/backend/models"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+// exportRepo serves a fixed catalogue to the exporters
+type exportRepo struct {
+	models.IProductRepo
+	products []models.Product
+}
+
+func (r *exportRepo) FindByMerchantInBatches(_ string, _ int, fn func(products []models.Product) error) error {
+	return fn(r.products)
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	var (
+		sku      = "SKU-1"
+		isActive = true
+		specs    = map[string]interface{}{
+			"color":   "red",
+			"ram_gb":  float64(8),
+			"wifi":    true,
+			"model":   "8",
+			"code":    "007",
+			"enabled": "true",
+			"note":    "",
+			"sizes":   []interface{}{"S", "M"},
+		}
+	)
+
+	raw, _ := json.Marshal(specs)
+	product := models.Product{
+		UUID:           "prd_1",
+		SKU:            &sku,
+		Title:          "Café table",
+		Description:    "Round, \"solid\" oak",
+		Price:          12500,
+		Stock:          3,
+		Category:       "furniture",
+		ImageURL:       "https://example.com/table.png",
+		IsActive:       &isActive,
+		Status:         models.ProductStatusPublished,
+		Specifications: datatypes.JSON(raw),
+	}
+
+	specKeys := []string{"code", "color", "enabled", "model", "note", "ram_gb", "sizes", "wifi"}
+	headers := append([]string{}, exportColumns...)
+	for _, key := range specKeys {
+		headers = append(headers, specFilterPrefix+key)
+	}
+
+	gin.SetMode(gin.TestMode)
+	repo := &exportRepo{products: []models.Product{product}}
+
+	tests := []struct {
+		format string
+		export func(c *gin.Context, repo models.IProductRepo, merchantID string, headers, specKeys []string) error
+		parse  func(file *bytes.Reader, stream *importStream) error
+	}{
+		{
+			format: importFormatCSV,
+			export: exportCSV,
+			parse: func(file *bytes.Reader, stream *importStream) error {
+				return parseCSV(file, stream)
+			},
+		},
+		{
+			format: importFormatXLSX,
+			export: exportExcel,
+			parse: func(file *bytes.Reader, stream *importStream) error {
+				// No sheet given, as when an export is re-uploaded as is
+				return parseExcel(file, "", stream)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+
+			if err := tt.export(c, repo, "mer_1", headers, specKeys); err != nil {
+				t.Fatalf("export = %v", err)
+			}
+
+			stream := &importStream{}
+			if err := tt.parse(bytes.NewReader(recorder.Body.Bytes()), stream); err != nil {
+				t.Fatalf("import = %v", err)
+			}
+			if len(stream.failures) != 0 || len(stream.rows) != 1 {
+				t.Fatalf("imported %d rows with failures %v, want 1 row", len(stream.rows), stream.failures)
+			}
+
+			got := stream.rows[0].Product
+			var gotSpecs map[string]interface{}
+			if err := json.Unmarshal(got.Specifications, &gotSpecs); err != nil {
+				t.Fatalf("imported specifications %s: %v", got.Specifications, err)
+			}
+			if !reflect.DeepEqual(gotSpecs, specs) {
+				t.Errorf("specifications = %v, want %v", gotSpecs, specs)
+			}
+
+			want := product
+			got.Specifications, want.Specifications = nil, nil
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("product = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
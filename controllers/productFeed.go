@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"context"
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/storage"
+	"ecom/backend/utils"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultFeedInterval = 6 * time.Hour
+	feedBatchSize       = 500
+	maxFeedTitle        = 150
+	maxFeedDescription  = 5000
+	defaultCurrency     = "USD"
+)
+
+type productFeedFile struct {
+	key         string
+	contentType string
+}
+
+// productFeeds are the generated Google Merchant Center feeds by the name they are served under
+var productFeeds = map[string]productFeedFile{
+	"google.xml": {key: "feeds/google.xml", contentType: "application/xml"},
+	"google.tsv": {key: "feeds/google.tsv", contentType: "text/tab-separated-values"},
+}
+
+var feedColumns = []string{"id", "title", "description", "link", "image_link", "price", "sale_price", "availability", "brand", "gtin", "identifier_exists"}
+
+type MerchantFeedSettingsRequest struct {
+	OptOut *bool `json:"opt_out" binding:"required"`
+}
+
+// feedItem is one product in the Google Merchant Center format
+type feedItem struct {
+	XMLName          xml.Name `xml:"item"`
+	ID               string   `xml:"g:id"`
+	Title            string   `xml:"g:title"`
+	Description      string   `xml:"g:description"`
+	Link             string   `xml:"g:link"`
+	ImageLink        string   `xml:"g:image_link,omitempty"`
+	Price            string   `xml:"g:price"`
+	SalePrice        string   `xml:"g:sale_price,omitempty"`
+	Availability     string   `xml:"g:availability"`
+	Brand            string   `xml:"g:brand,omitempty"`
+	GTIN             string   `xml:"g:gtin,omitempty"`
+	IdentifierExists string   `xml:"g:identifier_exists,omitempty"`
+}
+
+func (item *feedItem) values() []string {
+	return []string{item.ID, item.Title, item.Description, item.Link, item.ImageLink, item.Price,
+		item.SalePrice, item.Availability, item.Brand, item.GTIN, item.IdentifierExists}
+}
+
+// storeCurrency is the ISO 4217 currency product prices are in, STORE_CURRENCY or USD
+func storeCurrency() string {
+	if currency := os.Getenv("STORE_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return defaultCurrency
+}
+
+// formatPrice renders a price kept in minor units as "12.50 USD"
+func formatPrice(price uint) string {
+	return fmt.Sprintf("%d.%02d %s", price/100, price%100, storeCurrency())
+}
+
+// publicSiteURL is the origin product pages are served from, SITE_BASE_URL or
+// else PUBLIC_ASSET_BASE_URL
+func publicSiteURL() string {
+	base := os.Getenv("SITE_BASE_URL")
+	if base == "" {
+		base = os.Getenv("PUBLIC_ASSET_BASE_URL")
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// StartFeedGenerator regenerates the product feeds in the background. The
+// interval is configurable via FEED_INTERVAL (e.g. "6h").
+func StartFeedGenerator() {
+	interval := defaultFeedInterval
+	if d, err := time.ParseDuration(os.Getenv("FEED_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := generateProductFeeds(); err != nil {
+				utils.Error("unable to generate product feeds ", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// generateProductFeeds writes the xml and tsv feeds to temporary files in a
+// single pass over the catalogue, then replaces the stored copies
+func generateProductFeeds() error {
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		imageRepo   = models.InitProductImageRepo(database.DB)
+		baseURL     = publicSiteURL()
+		count       int
+	)
+
+	xmlFile, err := os.CreateTemp("", "feed-*.xml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(xmlFile.Name())
+	defer xmlFile.Close()
+
+	tsvFile, err := os.CreateTemp("", "feed-*.tsv")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tsvFile.Name())
+	defer tsvFile.Close()
+
+	fmt.Fprintf(xmlFile, `%s<rss version="2.0" xmlns:g="http://base.google.com/ns/1.0"><channel><title>Products</title><link>%s</link><description>Product feed</description>`,
+		xml.Header, baseURL)
+	encoder := xml.NewEncoder(xmlFile)
+
+	tsv := csv.NewWriter(tsvFile)
+	tsv.Comma = '\t'
+	tsv.Write(feedColumns)
+
+	err = productRepo.FindFeedInBatches(feedBatchSize, func(products []models.Product) error {
+		ids := make([]uint, 0, len(products))
+		for i := range products {
+			ids = append(ids, products[i].ID)
+		}
+		images, err := imageRepo.FirstURLs(ids)
+		if err != nil {
+			return err
+		}
+		discounts, err := offerDiscounts(productPointers(products)...)
+		if err != nil {
+			return err
+		}
+
+		for i := range products {
+			item := newFeedItem(&products[i], images[products[i].ID], discounts[products[i].ID], baseURL)
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+			if err := tsv.Write(item.values()); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	xmlFile.WriteString("</channel></rss>")
+	tsv.Flush()
+	if err := tsv.Error(); err != nil {
+		return err
+	}
+
+	for _, feed := range []struct {
+		file *os.File
+		productFeedFile
+	}{{xmlFile, productFeeds["google.xml"]}, {tsvFile, productFeeds["google.tsv"]}} {
+		if _, err := feed.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := storage.Store.Put(context.Background(), feed.key, feed.file, feed.contentType); err != nil {
+			return err
+		}
+	}
+
+	utils.Info(fmt.Sprintf("generated product feeds with %d products", count))
+	return nil
+}
+
+// newFeedItem maps a product to the feed. Brand and GTIN come from the
+// "brand" and "gtin" specifications, the brand falling back to the merchant's name.
+// An offer discount is published as the sale price, matching what checkout charges.
+func newFeedItem(p *models.Product, firstImage string, discount float64, baseURL string) *feedItem {
+	specs := map[string]interface{}{}
+	if len(p.Specifications) > 0 {
+		json.Unmarshal(p.Specifications, &specs)
+	}
+
+	brand := formatSpecificationCell(specs["brand"])
+	if brand == "" {
+		brand = p.Merchant.DoingBusinessAs
+	}
+	if brand == "" {
+		brand = p.Merchant.CorporateName
+	}
+
+	item := &feedItem{
+		ID:           p.UUID,
+		Title:        feedText(p.Title, maxFeedTitle),
+		Description:  feedText(p.Description, maxFeedDescription),
+		Link:         baseURL + "/product/" + p.Slug,
+		ImageLink:    p.ImageURL,
+		Price:        formatPrice(p.Price),
+		Availability: "out_of_stock",
+		Brand:        feedText(brand, maxFeedTitle),
+		GTIN:         formatSpecificationCell(specs["gtin"]),
+	}
+	if discount > 0 {
+		item.SalePrice = formatPrice(models.DiscountedPrice(p.Price, discount))
+	}
+	if item.ImageLink == "" {
+		item.ImageLink = firstImage
+	}
+	if p.Stock > 0 {
+		item.Availability = "in_stock"
+	}
+	if item.GTIN == "" {
+		item.IdentifierExists = "no"
+	}
+	return item
+}
+
+// feedText flattens whitespace, which tsv cannot hold, and cuts s to limit bytes
+func feedText(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > limit {
+		s = strings.ToValidUTF8(s[:limit], "")
+	}
+	return s
+}
+
+// GetProductFeed serves the last generated product feed
+func GetProductFeed(c *gin.Context) {
+	feed, ok := productFeeds[c.Param("feed")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "feed not found"})
+		return
+	}
+
+	body, err := storage.Store.Get(c.Request.Context(), feed.key)
+	if err != nil {
+		utils.Error("unable to read product feed ", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "feed has not been generated yet"})
+		return
+	}
+	defer body.Close()
+
+	c.Header("Content-Type", feed.contentType)
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, body); err != nil {
+		utils.Error("unable to serve product feed ", err)
+	}
+}
+
+// UpdateMerchantFeedSettings lets a merchant keep their products out of the product feeds
+func UpdateMerchantFeedSettings(c *gin.Context) {
+	var (
+		request      = MerchantFeedSettingsRequest{}
+		merchantRepo = models.InitMerchantRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := merchantRepo.Update(&models.Merchant{UUID: merchantInfo.UUID}, &models.Merchant{
+		FeedOptOut: request.OptOut,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update feed settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feed_opt_out": *request.OptOut})
+}
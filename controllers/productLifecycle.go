@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultModerationPageSize = 20
+	maxModerationPageSize     = 100
+)
+
+type ProductStatusRequest struct {
+	Status      models.ProductStatus `json:"status" binding:"required"`
+	PublishAt   *time.Time           `json:"publish_at"`
+	UnpublishAt *time.Time           `json:"unpublish_at"`
+}
+
+type ModerationRequest struct {
+	Approve bool   `json:"approve"`
+	Note    string `json:"note"`
+}
+
+// requestedStatus returns the status asked for by a product request. The
+// legacy is_active flag maps to published or draft.
+func requestedStatus(status *models.ProductStatus, isActive *bool) (models.ProductStatus, bool) {
+	if status != nil {
+		return *status, true
+	}
+	if isActive != nil {
+		if *isActive {
+			return models.ProductStatusPublished, true
+		}
+		return models.ProductStatusDraft, true
+	}
+	return "", false
+}
+
+// resolveStatus applies a merchant's requested status to a product in `from`,
+// sending it to review instead when its category is moderated
+func resolveStatus(validator *specificationValidator, from, to models.ProductStatus, category string) (models.ProductStatus, error) {
+	if !to.IsValid() {
+		return "", fmt.Errorf("status must be one of DRAFT, PUBLISHED, ARCHIVED")
+	}
+
+	moderated, err := validator.RequiresModeration(category)
+	if err != nil {
+		return "", fmt.Errorf("failed to check category moderation")
+	}
+
+	status, err := models.ResolveProductTransition(from, to, moderated)
+	if errors.Is(err, models.ErrInvalidProductTransition) {
+		return "", fmt.Errorf("cannot move product from %s to %s", from, to)
+	}
+	return status, err
+}
+
+// validPublishWindow checks that a scheduled unpublish comes after the scheduled publish
+func validPublishWindow(publishAt, unpublishAt *time.Time) bool {
+	return publishAt == nil || unpublishAt == nil || unpublishAt.After(*publishAt)
+}
+
+// UpdateProductStatus moves one of the merchant's products through its lifecycle
+// and sets its publishing window. Omitted window timestamps are cleared.
+func UpdateProductStatus(c *gin.Context) {
+	var (
+		request     = ProductStatusRequest{}
+		productRepo = models.InitProductsRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if !validPublishWindow(request.PublishAt, request.UnpublishAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unpublish_at must be after publish_at"})
+		return
+	}
+
+	product, ok := merchantProductFromPath(c)
+	if !ok {
+		return
+	}
+
+	status, err := resolveStatus(newSpecificationValidator(), product.Status, request.Status, product.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	values := models.StatusValues(status, time.Now())
+	if status == product.Status {
+		// Keep the original publish time when only the window changes
+		delete(values, "published_at")
+	}
+	values["publish_at"] = request.PublishAt
+	values["unpublish_at"] = request.UnpublishAt
+
+	if err := productRepo.UpdateStatus(product.ID, values); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id":   product.UUID,
+		"status":       status,
+		"publish_at":   request.PublishAt,
+		"unpublish_at": request.UnpublishAt,
+	})
+}
+
+// ListPendingProducts lists the products waiting for admin review
+func ListPendingProducts(c *gin.Context) {
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		page        = 1
+		limit       = defaultModerationPageSize
+	)
+
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxModerationPageSize)
+	}
+
+	products, total, err := productRepo.GetPendingReview(limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get products pending review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products": products,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+// ModerateProduct approves a product pending review, publishing it, or rejects
+// it back to draft with a note for the merchant
+func ModerateProduct(c *gin.Context) {
+	var (
+		request     = ModerationRequest{}
+		productRepo = models.InitProductsRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if !request.Approve && request.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a note is required when rejecting a product"})
+		return
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+	if product.Status != models.ProductStatusPendingReview {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product is not pending review"})
+		return
+	}
+
+	status := models.ProductStatusDraft
+	if request.Approve {
+		status = models.ProductStatusPublished
+	}
+
+	values := models.StatusValues(status, time.Now())
+	values["moderation_note"] = request.Note
+	if err := productRepo.UpdateStatus(product.ID, values); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to moderate product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"product_id": product.UUID, "status": status})
+}
@@ -6,43 +6,86 @@ import (
 	"ecom/backend/errResponse"
 	"ecom/backend/middleware"
 	"ecom/backend/models"
+	"ecom/backend/storage"
 	"ecom/backend/utils"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"mime/multipart"
+	"io"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xuri/excelize/v2"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type ProdctRequest struct {
-	UUID           string         `gorm:"unique" json:"uuid,omitempty"`
-	Title          string         `json:"title" gorm:"not null"`
-	Description    string         `json:"description,omitempty"`
-	Price          uint           `json:"price" gorm:"not null"`
-	Stock          uint           `json:"stock" gorm:"default:0"`
-	Category       string         `json:"category"`
-	ImageURL       string         `json:"image_url,omitempty"`
-	IsActive       *bool          `json:"is_active" gorm:"default:false"`
-	Specifications datatypes.JSON `json:"specifications" gorm:"type:jsonb"`
+	UUID            string                `gorm:"unique" json:"uuid,omitempty"`
+	SKU             *string               `json:"sku,omitempty"`
+	Slug            string                `json:"slug,omitempty"`
+	Title           string                `json:"title" gorm:"not null"`
+	Description     string                `json:"description,omitempty"`
+	Price           uint                  `json:"price" gorm:"not null"`
+	Stock           uint                  `json:"stock" gorm:"default:0"`
+	Category        string                `json:"category"`
+	ImageURL        string                `json:"image_url,omitempty"`
+	IsActive        *bool                 `json:"is_active" gorm:"default:false"`
+	Status          *models.ProductStatus `json:"status,omitempty"`
+	PublishAt       *time.Time            `json:"publish_at,omitempty"`
+	UnpublishAt     *time.Time            `json:"unpublish_at,omitempty"`
+	MetaTitle       string                `json:"meta_title,omitempty"`
+	MetaDescription string                `json:"meta_description,omitempty"`
+	Specifications  datatypes.JSON        `json:"specifications" gorm:"type:jsonb"`
 }
 
 type ProductDetailsResponse struct {
-	UUID           string         `gorm:"unique" json:"uuid,omitempty"`
-	Title          string         `json:"title" gorm:"not null"`
-	Description    string         `json:"description,omitempty"`
-	Price          uint           `json:"price" gorm:"not null"`
-	Stock          uint           `json:"stock" gorm:"default:0"`
-	Category       string         `json:"category"`
-	ImageURL       string         `json:"image_url,omitempty"`
-	IsActive       *bool          `json:"is_active,omitempty" gorm:"default:false"`
-	Specifications datatypes.JSON `json:"specifications" gorm:"type:jsonb"`
+	UUID              string                   `gorm:"unique" json:"uuid,omitempty"`
+	SKU               *string                  `json:"sku,omitempty"`
+	Slug              string                   `json:"slug,omitempty"`
+	Title             string                   `json:"title" gorm:"not null"`
+	Description       string                   `json:"description,omitempty"`
+	Price             uint                     `json:"price" gorm:"not null"`
+	EffectivePrice    uint                     `json:"effective_price"`
+	Discount          float64                  `json:"discount,omitempty"`
+	Stock             uint                     `json:"stock" gorm:"default:0"`
+	Category          string                   `json:"category"`
+	ImageURL          string                   `json:"image_url,omitempty"`
+	IsActive          *bool                    `json:"is_active,omitempty" gorm:"default:false"`
+	Specifications    datatypes.JSON           `json:"specifications" gorm:"type:jsonb"`
+	Status            models.ProductStatus     `json:"status,omitempty"`
+	MetaTitle         string                   `json:"meta_title,omitempty"`
+	MetaDescription   string                   `json:"meta_description,omitempty"`
+	RatingAverage     float64                  `json:"rating_average"`
+	RatingCount       uint                     `json:"rating_count"`
+	LowestPrice30Days *uint                    `json:"lowest_price_30_days,omitempty"`
+	Images            []models.ProductImage    `json:"images,omitempty"`
+	TopQuestions      []models.ProductQuestion `json:"top_questions,omitempty"`
 }
 
+type ProductListResponse struct {
+	Products   []ProductDetailsResponse `json:"products"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	TotalCount *int64                   `json:"total_count,omitempty"`
+	Facets     map[string][]FacetValue  `json:"facets,omitempty"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+const (
+	defaultProductPageSize = 20
+	maxProductPageSize     = 100
+	specFilterPrefix       = "spec."
+)
+
 func CreateProduct(c *gin.Context) {
 	var (
 		request      = ProdctRequest{}
@@ -77,27 +120,76 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if !validPublishWindow(request.PublishAt, request.UnpublishAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unpublish_at must be after publish_at"})
+		return
+	}
+	if request.Slug != "" && !models.ValidSlug(request.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug may only contain lowercase letters, digits and single hyphens"})
+		return
+	}
+
+	// New products start as drafts unless the merchant asks to publish them
+	validator := newSpecificationValidator()
+	status := models.ProductStatusDraft
+	if target, ok := requestedStatus(request.Status, request.IsActive); ok {
+		status, err = resolveStatus(validator, models.ProductStatusDraft, target, request.Category)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	specifications, fieldErrors, err := validator.Validate(request.Category, request.Specifications)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate specifications"})
+		return
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid specifications", "fields": fieldErrors})
+		return
+	}
+
 	// Create a new product
 	product := models.Product{
-		Title:          request.Title,
-		Description:    request.Description,
-		Price:          request.Price,
-		Stock:          request.Stock,
-		Category:       request.Category,
-		ImageURL:       request.ImageURL,
-		MerchantID:     merchantInfo.UUID,
-		IsActive:       request.IsActive,
-		Specifications: request.Specifications,
+		Title:           request.Title,
+		Slug:            request.Slug,
+		Description:     request.Description,
+		Price:           request.Price,
+		Stock:           request.Stock,
+		SKU:             request.SKU,
+		Category:        request.Category,
+		ImageURL:        request.ImageURL,
+		MerchantID:      merchantInfo.UUID,
+		Status:          status,
+		PublishAt:       request.PublishAt,
+		UnpublishAt:     request.UnpublishAt,
+		MetaTitle:       request.MetaTitle,
+		MetaDescription: request.MetaDescription,
+		Specifications:  specifications,
+	}
+	if status == models.ProductStatusPublished {
+		now := time.Now()
+		product.PublishedAt = &now
 	}
 
 	// Create the product
 	if err := productRepo.Create(&product); err != nil {
+		if strings.Contains(err.Error(), "idx_products_merchant_sku") {
+			c.JSON(http.StatusConflict, gin.H{"error": "sku already exists"})
+			return
+		}
+		if errors.Is(err, models.ErrSlugTaken) || strings.Contains(err.Error(), "idx_products_slug") {
+			c.JSON(http.StatusConflict, gin.H{"error": "slug already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create product"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Successfully added",
+		"slug":    product.Slug,
 	})
 }
 
@@ -148,21 +240,114 @@ func UpdateProduct(c *gin.Context) {
 
 	// Create a new product
 	product := models.Product{
-		Title:          request.Title,
-		Description:    request.Description,
-		Price:          request.Price,
-		Stock:          request.Stock,
-		Category:       request.Category,
-		ImageURL:       request.ImageURL,
-		IsActive:       request.IsActive,
-		Specifications: request.Specifications,
+		Title:           request.Title,
+		Description:     request.Description,
+		Price:           request.Price,
+		Stock:           request.Stock,
+		SKU:             request.SKU,
+		Category:        request.Category,
+		ImageURL:        request.ImageURL,
+		PublishAt:       request.PublishAt,
+		UnpublishAt:     request.UnpublishAt,
+		MetaTitle:       request.MetaTitle,
+		MetaDescription: request.MetaDescription,
+		Specifications:  request.Specifications,
 	}
 
-	// Create the product
-	if err := productRepo.Update(&models.Product{
+	if request.Slug != "" && !models.ValidSlug(request.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug may only contain lowercase letters, digits and single hyphens"})
+		return
+	}
+
+	existing, err := productRepo.Get(&models.Product{
 		UUID:       productId,
 		MerchantID: merchantInfo.UUID,
-	}, &product); err != nil {
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	publishAt, unpublishAt := existing.PublishAt, existing.UnpublishAt
+	if request.PublishAt != nil {
+		publishAt = request.PublishAt
+	}
+	if request.UnpublishAt != nil {
+		unpublishAt = request.UnpublishAt
+	}
+	if !validPublishWindow(publishAt, unpublishAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unpublish_at must be after publish_at"})
+		return
+	}
+
+	// Status changes follow the product lifecycle, including the legacy is_active flag
+	if target, ok := requestedStatus(request.Status, request.IsActive); ok {
+		category := existing.Category
+		if request.Category != "" {
+			category = request.Category
+		}
+
+		status, err := resolveStatus(newSpecificationValidator(), existing.Status, target, category)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		isActive := status == models.ProductStatusPublished
+		product.Status = status
+		product.IsActive = &isActive
+		if isActive && existing.Status != models.ProductStatusPublished {
+			now := time.Now()
+			product.PublishedAt = &now
+		}
+	}
+
+	// Validate the resulting specifications when either they or the category change
+	if request.Category != "" || len(request.Specifications) > 0 {
+		category, specifications := existing.Category, existing.Specifications
+		if request.Category != "" {
+			category = request.Category
+		}
+		if len(request.Specifications) > 0 {
+			specifications = request.Specifications
+		}
+
+		normalized, fieldErrors, err := newSpecificationValidator().Validate(category, specifications)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate specifications"})
+			return
+		}
+		if len(fieldErrors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid specifications", "fields": fieldErrors})
+			return
+		}
+		product.Specifications = normalized
+	}
+
+	// Update the product and record a price change in the same transaction
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := productRepo.UpdateWithTx(tx, &models.Product{
+			UUID:       productId,
+			MerchantID: merchantInfo.UUID,
+		}, &product); err != nil {
+			return err
+		}
+		if request.Slug != "" {
+			if err := productRepo.UpdateSlugWithTx(tx, existing, request.Slug); err != nil {
+				return err
+			}
+		}
+		if request.Price == 0 {
+			return nil
+		}
+		return models.InitPriceHistoryRepo(tx).RecordWithTx(tx, existing.ID, &existing.Price, request.Price,
+			models.PriceChangeSourceManual, nil)
+	})
+	if errors.Is(err, models.ErrSlugTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "slug already exists"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create product"})
 		return
 	}
@@ -186,9 +371,18 @@ func GetProductDetails(c *gin.Context) {
 		return
 	}
 
-	product, err := productRepo.Get(&models.Product{
-		UUID: productId,
-	})
+	// Products are addressed by UUID or by slug; slugs never contain an underscore
+	var (
+		product *models.Product
+		err     error
+	)
+	if strings.Contains(productId, "_") {
+		product, err = productRepo.Get(&models.Product{
+			UUID: productId,
+		})
+	} else {
+		product, err = productRepo.FindBySlug(productId)
+	}
 
 	if err != nil || product == nil {
 		utils.Error("error in getting product || err: ", err)
@@ -198,23 +392,96 @@ func GetProductDetails(c *gin.Context) {
 		return
 	}
 
+	if !canViewProduct(c, product) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	if !strings.Contains(productId, "_") && product.Slug != productId {
+		redirectToSlug(c, "/product/", product.Slug)
+		return
+	}
+
+	images, err := models.InitProductImageRepo(database.DB).GetAll(product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product images"})
+		return
+	}
+
+	lowestPrice, err := lowestRecentPrice(product)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get price history"})
+		return
+	}
+
+	topQuestions, err := models.InitProductQuestionRepo(database.DB).TopAnswered(product.ID, topQuestionsInDetails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product questions"})
+		return
+	}
+
+	discounts, err := offerDiscounts(product)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product offers"})
+		return
+	}
+
 	productDetails := ProductDetailsResponse{
-		Title:          product.Title,
-		Description:    product.Description,
-		Price:          product.Price,
-		Stock:          product.Stock,
-		Category:       product.Category,
-		ImageURL:       product.ImageURL,
-		IsActive:       product.IsActive,
-		Specifications: product.Specifications,
+		UUID:              product.UUID,
+		SKU:               product.SKU,
+		Slug:              product.Slug,
+		Title:             product.Title,
+		Description:       product.Description,
+		Price:             product.Price,
+		EffectivePrice:    effectivePrice(product, discounts),
+		Discount:          discounts[product.ID],
+		Stock:             product.Stock,
+		Category:          product.Category,
+		ImageURL:          product.ImageURL,
+		IsActive:          product.IsActive,
+		Status:            product.Status,
+		MetaTitle:         metaOrDefault(product.MetaTitle, product.Title, maxMetaTitle),
+		MetaDescription:   metaOrDefault(product.MetaDescription, product.Description, maxMetaDescription),
+		Specifications:    product.Specifications,
+		RatingAverage:     product.RatingAverage,
+		RatingCount:       product.RatingCount,
+		LowestPrice30Days: &lowestPrice,
+		Images:            images,
+		TopQuestions:      topQuestions,
 	}
 
 	c.JSON(http.StatusOK, productDetails)
 }
 
+// canViewProduct reports whether the requester may see the product: anyone
+// once it is live, before that only admins and the merchant selling it
+func canViewProduct(c *gin.Context, product *models.Product) bool {
+	if product.IsLive(time.Now()) {
+		return true
+	}
+
+	switch c.GetString(middleware.AuthorizedUserRoleContextKey) {
+	case models.GetRoleName(models.AdminRole):
+		return true
+	case models.GetRoleName(models.MerchantRole):
+		merchantInfo, err := models.InitMerchantRepo(database.DB).Get(&models.Merchant{
+			AccountUUID: c.GetString(middleware.AccountUUIDContextKey),
+		})
+		return err == nil && merchantInfo.UUID == product.MerchantID
+	}
+	return false
+}
+
 func ListFilteredActiveProducts(c *gin.Context) {
-	var products []models.Product
-	query := database.DB.Where("is_active = ?", true)
+	var (
+		productRepo = models.InitProductsRepo(database.DB)
+		filter      = models.ProductListFilter{
+			Sort:  models.ProductSortNewest,
+			Limit: defaultProductPageSize,
+		}
+		includeTotal  bool
+		includeFacets bool
+	)
 
 	// Get filters from query parameters
 	filters := c.Request.URL.Query()
@@ -222,214 +489,613 @@ func ListFilteredActiveProducts(c *gin.Context) {
 	for key, values := range filters {
 		switch key {
 		case "category":
-			query = query.Where("category = ?", values[0])
+			filter.Category = values[0]
 		case "min_price":
 			if minPrice, err := strconv.ParseUint(values[0], 10, 32); err == nil {
-				query = query.Where("price >= ?", minPrice)
+				filter.MinPrice = &minPrice
 			}
 		case "max_price":
 			if maxPrice, err := strconv.ParseUint(values[0], 10, 32); err == nil {
-				query = query.Where("price <= ?", maxPrice)
+				filter.MaxPrice = &maxPrice
 			}
 		case "min_stock":
 			if minStock, err := strconv.ParseUint(values[0], 10, 32); err == nil {
-				query = query.Where("stock >= ?", minStock)
+				filter.MinStock = &minStock
+			}
+		case "sort":
+			filter.Sort = models.ProductSort(values[0])
+			if !filter.Sort.IsValid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of price_asc, price_desc, newest, popularity, rating"})
+				return
+			}
+		case "limit":
+			limit, err := strconv.Atoi(values[0])
+			if err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+				return
+			}
+			filter.Limit = min(limit, maxProductPageSize)
+		case "cursor":
+			cursor, err := models.DecodeProductCursor(values[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+				return
+			}
+			filter.Cursor = cursor
+		case "include_total":
+			includeTotal = values[0] == "true"
+		case "include_facets":
+			includeFacets = values[0] == "true"
+		default:
+			if !strings.HasPrefix(key, specFilterPrefix) {
+				continue
 			}
+			specFilter, err := parseSpecFilter(key, values)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter.Specs = append(filter.Specs, *specFilter)
 		}
 	}
 
+	// A cursor is only valid for the sort it was issued for
+	if filter.Cursor != nil && filter.Cursor.Sort != filter.Sort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor does not match the requested sort"})
+		return
+	}
+
 	// Execute query
-	if err := query.Find(&products).Error; err != nil {
+	products, nextCursor, err := productRepo.List(&filter)
+	if err != nil {
 		utils.Error("error fetching products:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch products"})
 		return
 	}
 
+	discounts, err := offerDiscounts(productPointers(products)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product offers"})
+		return
+	}
+
 	// Convert to response format
-	var productResponses []ProductDetailsResponse
-	for _, product := range products {
-		productResponses = append(productResponses, ProductDetailsResponse{
-			UUID:           product.UUID,
-			Title:          product.Title,
-			Description:    product.Description,
-			Price:          product.Price,
-			Stock:          product.Stock,
-			Category:       product.Category,
-			ImageURL:       product.ImageURL,
-			Specifications: product.Specifications,
-		})
+	response := ProductListResponse{
+		Products: make([]ProductDetailsResponse, 0, len(products)),
+	}
+	for i := range products {
+		response.Products = append(response.Products, productSummary(&products[i], discounts))
+	}
+
+	if nextCursor != nil {
+		response.NextCursor = nextCursor.Encode()
+	}
+
+	if includeTotal {
+		total, err := productRepo.Count(&filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count products"})
+			return
+		}
+		response.TotalCount = &total
+	}
+
+	if includeFacets {
+		facets, err := productRepo.Facets(&filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product facets"})
+			return
+		}
+		response.Facets = map[string][]FacetValue{}
+		for _, facet := range facets {
+			response.Facets[facet.Key] = append(response.Facets[facet.Key], FacetValue{
+				Value: facet.Value,
+				Count: facet.Count,
+			})
+		}
 	}
 
 	// Return response
-	c.JSON(http.StatusOK, productResponses)
+	c.JSON(http.StatusOK, response)
 }
 
-// BulkUploadProducts handles bulk product upload via CSV or Excel
+// productSummary is the representation of a product in lists
+func productSummary(product *models.Product, discounts map[uint]float64) ProductDetailsResponse {
+	return ProductDetailsResponse{
+		UUID:           product.UUID,
+		SKU:            product.SKU,
+		Slug:           product.Slug,
+		Title:          product.Title,
+		Description:    product.Description,
+		Price:          product.Price,
+		EffectivePrice: effectivePrice(product, discounts),
+		Discount:       discounts[product.ID],
+		Stock:          product.Stock,
+		Category:       product.Category,
+		ImageURL:       product.ImageURL,
+		Specifications: product.Specifications,
+		RatingAverage:  product.RatingAverage,
+		RatingCount:    product.RatingCount,
+	}
+}
+
+// parseSpecFilter reads a specification filter from a query parameter. Since
+// "spec.ram_gb>=8" is split by the query parser into the key "spec.ram_gb>"
+// and the value "8", a trailing > or < on the key selects the range operator.
+func parseSpecFilter(key string, values []string) (*models.SpecificationFilter, error) {
+	specKey := strings.TrimPrefix(key, specFilterPrefix)
+	operator := models.SpecificationOperatorEq
+
+	switch {
+	case strings.HasSuffix(specKey, ">"):
+		specKey, operator = strings.TrimSuffix(specKey, ">"), models.SpecificationOperatorGte
+	case strings.HasSuffix(specKey, "<"):
+		specKey, operator = strings.TrimSuffix(specKey, "<"), models.SpecificationOperatorLte
+	}
+
+	return models.NewSpecificationFilter(specKey, operator, values)
+}
+
+// maxImportBytes returns the bulk upload size limit, configurable via IMPORT_MAX_UPLOAD_BYTES
+func maxImportBytes() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("IMPORT_MAX_UPLOAD_BYTES"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultMaxImportBytes
+}
+
+// BulkUploadProducts accepts a CSV, Excel or JSON file and queues it as an import job
 func BulkUploadProducts(c *gin.Context) {
 	var (
-		merchantRepo = models.InitMerchantRepo(database.DB)
-		productRepo  = models.InitProductsRepo(database.DB)
+		importJobRepo = models.InitImportJobRepo(database.DB)
 	)
 
-	// Get merchant UUID from the context (set by AuthMiddleware)
-	AccountUUIDStr, ok := c.Get(middleware.AccountUUIDContextKey)
-	if !ok || AccountUUIDStr == "" {
-		utils.Error("failed to get account uuid")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "failed to get account uuid",
-		})
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
 		return
 	}
 
-	merchantInfo, err := merchantRepo.Get(&models.Merchant{
-		AccountUUID: AccountUUIDStr.(string),
-	})
-
-	if err != nil || merchantInfo == nil {
-		utils.Error("error in getting merchant || err: ", err)
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "error in getting merchant",
-		})
-		return
-	}
+	maxBytes := maxImportBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+(1<<20))
 
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file exceeds the maximum size of %d bytes", maxBytes)})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve file"})
 		return
 	}
 
 	defer file.Close()
 
-	var products []models.Product
-	var failedRecords []map[string]string
+	if header.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file exceeds the maximum size of %d bytes", maxBytes)})
+		return
+	}
 
+	var format string
 	switch {
 	case strings.HasSuffix(header.Filename, ".csv"):
-		utils.Info("get csv file: ", header.Filename)
-		products, failedRecords = parseCSV(file)
+		format = importFormatCSV
 	case strings.HasSuffix(header.Filename, ".xlsx"):
-		utils.Info("get xlsx file: ", header.Filename)
-		products, failedRecords = parseExcel(file)
+		format = importFormatXLSX
+	case strings.HasSuffix(header.Filename, ".json"):
+		format = importFormatJSON
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only CSV or Excel files are supported"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only CSV, Excel or JSON files are supported"})
 		return
 	}
+	utils.Info("get ", format, " file: ", header.Filename)
 
-	if len(products) > 0 {
-		// Convert the slice of Product structs to a slice of pointers
-		var productPtrs []*models.Product
-		for i := range products {
-			productPtrs = append(productPtrs, &products[i])
-		}
+	// Import options are sent as form fields next to the file
+	mode := models.ImportMode(c.DefaultPostForm("mode", string(models.ImportModeCreate)))
+	matchBy := models.ImportMatchBy(c.DefaultPostForm("match_by", string(models.ImportMatchBySKU)))
+	if !mode.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be create or upsert"})
+		return
+	}
+	if !matchBy.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "match_by must be sku or uuid"})
+		return
+	}
 
-		// Now pass the converted slice to CreateInBatches
-		result := productRepo.CreateInBatches(productPtrs, 50, merchantInfo.UUID)
-		if result != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert products"})
-			return
-		}
+	// Keep the file in the blob store so the worker (or a restarted server) can read it
+	fileUUID, _ := utils.GenerateNanoID(12, "")
+	fileKey := fmt.Sprintf("imports/%s/%s.%s", merchantInfo.UUID, fileUUID, format)
+	if err := storage.Store.Put(c, fileKey, file, header.Header.Get("Content-Type")); err != nil {
+		utils.Error("unable to store import file ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":        fmt.Sprintf("%d products uploaded successfully", len(products)),
-		"failed_records": failedRecords,
+	job := models.ImportJob{
+		MerchantID: merchantInfo.UUID,
+		FileName:   header.Filename,
+		FileKey:    fileKey,
+		Format:     format,
+		Mode:       mode,
+		MatchBy:    matchBy,
+		DryRun:     c.PostForm("dry_run") == "true",
+		Sheet:      c.PostForm("sheet"),
+		Status:     models.ImportJobStatusPending,
+	}
+	if err := importJobRepo.Create(&job); err != nil {
+		deleteBlobs(c, []string{fileKey})
+		c.JSON(http.StatusInternalServerError, errResponse.Generate(constants.ErrorDatabaseCreateFailed,
+			constants.ErrorText(constants.ErrorDatabaseCreateFailed), nil))
+		return
+	}
+
+	enqueueImportJob(job.UUID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Upload accepted for processing",
+		"job_id":     job.UUID,
+		"status":     job.Status,
+		"status_url": fmt.Sprintf("/products/upload/jobs/%s", job.UUID),
 	})
 }
 
-// parseCSV reads and processes a CSV file
-func parseCSV(file multipart.File) ([]models.Product, []map[string]string) {
-	// Reset the file cursor before reading
-	file.Seek(0, 0)
+// importRow is a parsed product together with its row number in the uploaded file
+type importRow struct {
+	Number  int
+	Product models.Product
+	Columns []string
+}
 
+// has reports whether the uploaded file sets the product column
+func (r *importRow) has(column string) bool {
+	for _, c := range r.Columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCSV reads a CSV file row by row into the import stream
+func parseCSV(file io.Reader, stream *importStream) error {
 	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	// Rows with a different number of fields are reported by mapRowToProduct
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
 	if err != nil {
 		utils.Error("CSV Read Error:", err)
-		return nil, []map[string]string{{"error": "Failed to read CSV file"}}
+		return fmt.Errorf("Failed to read CSV file")
 	}
+	headers := append([]string{}, header...)
 
-	if len(records) < 2 {
-		return nil, []map[string]string{{"error": "CSV file must have at least one product row"}}
+	// Row numbers match the spreadsheet view: the header is row 1
+	rowNumber := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		rowNumber++
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := stream.fail(failedRecord(rowNumber, fmt.Errorf("malformed CSV row"))); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			utils.Error("CSV Read Error:", err)
+			return fmt.Errorf("Failed to read CSV file")
+		}
+
+		if err := streamRow(stream, rowNumber, headers, record); err != nil {
+			return err
+		}
 	}
 
-	headers := records[0]
-	var products []models.Product
-	var failedRecords []map[string]string
+	if rowNumber < 2 {
+		return fmt.Errorf("CSV file must have at least one product row")
+	}
+	return nil
+}
+
+// parseExcel reads a sheet of an Excel file row by row into the import stream.
+// The first sheet is used when none is given.
+func parseExcel(file io.Reader, sheet string, stream *importStream) error {
+	// excelize needs random access to the archive, so spool it to disk
+	// rather than holding the whole upload in memory
+	tmp, err := os.CreateTemp("", "import-*.xlsx")
+	if err != nil {
+		utils.Error("unable to create temp file ", err)
+		return fmt.Errorf("Failed to read Excel file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
-	for _, row := range records[1:] {
-		product, err := mapRowToProduct(headers, row)
+	if _, err := io.Copy(tmp, file); err != nil {
+		utils.Error("unable to spool Excel file ", err)
+		return fmt.Errorf("Failed to read Excel file")
+	}
+
+	f, err := excelize.OpenFile(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("Failed to read Excel file")
+	}
+	defer f.Close()
+
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	}
+	if index, err := f.GetSheetIndex(sheet); err != nil || index < 0 {
+		return fmt.Errorf("sheet %s not found", sheet)
+	}
+
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return fmt.Errorf("Invalid Excel format")
+	}
+	defer rows.Close()
+
+	var headers []string
+	rowNumber := 0
+	for rows.Next() {
+		rowNumber++
+		record, err := rows.Columns()
 		if err != nil {
-			failedRecords = append(failedRecords, map[string]string{"error": err.Error()})
+			return fmt.Errorf("Invalid Excel format")
+		}
+
+		if headers == nil {
+			headers = record
 			continue
 		}
-		products = append(products, product)
+		if len(record) == 0 {
+			continue
+		}
+
+		// Trailing empty cells are not returned by excelize
+		for len(record) < len(headers) {
+			record = append(record, "")
+		}
+
+		if err := streamRow(stream, rowNumber, headers, record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Error(); err != nil {
+		return fmt.Errorf("Invalid Excel format")
 	}
 
-	return products, failedRecords
+	if rowNumber < 2 {
+		return fmt.Errorf("Invalid Excel format")
+	}
+	return nil
 }
 
-// parseExcel reads and processes an Excel file
-func parseExcel(file multipart.File) ([]models.Product, []map[string]string) {
-	f, err := excelize.OpenReader(file)
+// streamRow maps a row and hands it, or its error, to the import stream
+func streamRow(stream *importStream, rowNumber int, headers, record []string) error {
+	parsed, err := mapRowToProduct(headers, record)
 	if err != nil {
-		return nil, []map[string]string{{"error": "Failed to read Excel file"}}
+		return stream.fail(failedRecord(rowNumber, err))
 	}
+	parsed.Number = rowNumber
+	return stream.add(parsed)
+}
 
-	sheetName := f.GetSheetName(1)
-	rows, err := f.GetRows(sheetName)
-	if err != nil || len(rows) < 2 {
-		return nil, []map[string]string{{"error": "Invalid Excel format"}}
+// parseJSON reads an array of product objects, as written by ExportProducts.
+// Each object is turned into a header row so it goes through mapRowToProduct.
+func parseJSON(file io.Reader, stream *importStream) error {
+	decoder := json.NewDecoder(file)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return fmt.Errorf("JSON file must contain an array of products")
 	}
 
-	headers := rows[0]
-	var products []models.Product
-	var failedRecords []map[string]string
+	// Rows are numbered from 1 in the order of the array
+	number := 0
+	for decoder.More() {
+		number++
+		var record map[string]json.RawMessage
+		if err := decoder.Decode(&record); err != nil {
+			utils.Error("JSON Read Error:", err)
+			return fmt.Errorf("Failed to read JSON file")
+		}
 
-	for _, row := range rows[1:] {
-		product, err := mapRowToProduct(headers, row)
-		if err != nil {
-			failedRecords = append(failedRecords, map[string]string{"error": err.Error()})
-			continue
+		headers := make([]string, 0, len(record))
+		values := make([]string, 0, len(record))
+		for key, raw := range record {
+			var value string
+			switch {
+			case string(raw) == "null":
+			case len(raw) > 0 && raw[0] == '"':
+				json.Unmarshal(raw, &value)
+			default:
+				value = string(raw)
+			}
+			headers = append(headers, key)
+			values = append(values, value)
+		}
+
+		if err := streamRow(stream, number, headers, values); err != nil {
+			return err
+		}
+	}
+
+	if number == 0 {
+		return fmt.Errorf("JSON file must have at least one product")
+	}
+	return nil
+}
+
+// specificationsError reports the field errors of a row whose specifications do not follow the category schema
+type specificationsError struct {
+	fields []models.SpecificationError
+}
+
+func (e *specificationsError) Error() string {
+	return "invalid specifications"
+}
+
+// failedRecord converts a row error to an entry of failed_records
+func failedRecord(rowNumber int, err error) map[string]string {
+	record := map[string]string{
+		"row":   strconv.Itoa(rowNumber),
+		"error": err.Error(),
+	}
+
+	var specErr *specificationsError
+	if errors.As(err, &specErr) {
+		for _, field := range specErr.fields {
+			record[field.Field] = field.Message
 		}
-		products = append(products, product)
 	}
+	return record
+}
 
-	return products, failedRecords
+// importColumns maps the accepted file headers to product columns
+var importColumns = map[string]string{
+	"uuid":           "uuid",
+	"sku":            "sku",
+	"title":          "title",
+	"description":    "description",
+	"price":          "price",
+	"stock":          "stock",
+	"category":       "category",
+	"imageurl":       "image_url",
+	"image_url":      "image_url",
+	"is_active":      "is_active",
+	"status":         "status",
+	"specifications": "specifications",
 }
 
-// mapRowToProduct maps a row of data to a Product struct
-func mapRowToProduct(headers, row []string) (models.Product, error) {
+// mapRowToProduct maps a row of data to a Product struct. Only the columns
+// present in the file are parsed; the returned row lists them so that upserts
+// can update just those columns.
+func mapRowToProduct(headers, row []string) (importRow, error) {
 	if len(headers) != len(row) {
-		return models.Product{}, fmt.Errorf("invalid row length")
+		return importRow{}, fmt.Errorf("invalid row length")
 	}
 
-	productMap := make(map[string]string)
+	var (
+		product = models.Product{}
+		columns []string
+		specs   map[string]interface{}
+
+		hasSpecColumn bool
+	)
+
 	for i, header := range headers {
-		productMap[strings.ToLower(header)] = row[i]
+		// spec.<key> columns hold a single specification each, as written by ExportProducts
+		name := strings.TrimSpace(header)
+		if len(name) > len(specFilterPrefix) && strings.EqualFold(name[:len(specFilterPrefix)], specFilterPrefix) {
+			if specs == nil {
+				specs = map[string]interface{}{}
+			}
+			if value, ok := parseSpecificationCell(row[i]); ok {
+				specs[name[len(specFilterPrefix):]] = value
+			}
+			continue
+		}
+
+		column, ok := importColumns[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		columns = append(columns, column)
+		value := row[i]
+
+		switch column {
+		case "uuid":
+			product.UUID = strings.TrimSpace(value)
+		case "sku":
+			if sku := strings.TrimSpace(value); sku != "" {
+				product.SKU = &sku
+			}
+		case "title":
+			product.Title = value
+		case "description":
+			product.Description = value
+		case "price":
+			price, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return importRow{}, fmt.Errorf("invalid price value")
+			}
+			product.Price = uint(price)
+		case "stock":
+			stock, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return importRow{}, fmt.Errorf("invalid stock value")
+			}
+			product.Stock = uint(stock)
+		case "category":
+			product.Category = value
+		case "image_url":
+			product.ImageURL = value
+		case "is_active":
+			isActive := value == "true" || value == "TRUE"
+			product.IsActive = &isActive
+		case "status":
+			product.Status = models.ProductStatus(strings.ToUpper(strings.TrimSpace(value)))
+			if !product.Status.IsValid() {
+				return importRow{}, fmt.Errorf("invalid status value")
+			}
+		case "specifications":
+			product.Specifications = datatypes.JSON([]byte(value))
+			hasSpecColumn = true
+		}
 	}
 
-	price, err := strconv.ParseUint(productMap["price"], 10, 32)
-	if err != nil {
-		return models.Product{}, fmt.Errorf("invalid price value")
+	// Flattened columns take precedence over the keys of a specifications column
+	if specs != nil {
+		merged := map[string]interface{}{}
+		if len(product.Specifications) > 0 {
+			if err := json.Unmarshal(product.Specifications, &merged); err != nil {
+				return importRow{}, fmt.Errorf("invalid specifications value")
+			}
+		}
+		for key, value := range specs {
+			merged[key] = value
+		}
+
+		raw, err := json.Marshal(merged)
+		if err != nil {
+			return importRow{}, fmt.Errorf("invalid specifications value")
+		}
+		product.Specifications = datatypes.JSON(raw)
+		if !hasSpecColumn {
+			columns = append(columns, "specifications")
+		}
 	}
 
-	stock, err := strconv.ParseUint(productMap["stock"], 10, 32)
-	if err != nil {
-		return models.Product{}, fmt.Errorf("invalid stock value")
-	}
-
-	isActive := productMap["is_active"] == "true" || productMap["is_active"] == "TRUE"
-
-	return models.Product{
-		MerchantID:     productMap["merchant_id"],
-		Title:          productMap["title"],
-		Description:    productMap["description"],
-		Price:          uint(price),
-		Stock:          uint(stock),
-		Category:       productMap["category"],
-		ImageURL:       productMap["imageurl"],
-		Specifications: datatypes.JSON([]byte(productMap["specifications"])),
-		IsActive:       &isActive,
-	}, nil
-}
\ No newline at end of file
+	return importRow{Product: product, Columns: columns}, nil
+}
+
+// parseSpecificationCell converts a spec.<key> cell to its JSON value. Empty
+// cells are skipped; numbers and booleans are only recognised when they format
+// back to the same text, so values like "007" stay strings. A JSON quoted cell
+// is a string, which is how exports write strings like "8".
+func parseSpecificationCell(value string) (interface{}, bool) {
+	trimmed := strings.TrimSpace(value)
+	switch {
+	case trimmed == "":
+		return nil, false
+	case trimmed == "true" || trimmed == "false":
+		return trimmed == "true", true
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		if json.Valid([]byte(trimmed)) {
+			return json.RawMessage(trimmed), true
+		}
+	case strings.HasPrefix(trimmed, `"`):
+		var text string
+		if json.Unmarshal([]byte(trimmed), &text) == nil {
+			return text, true
+		}
+	}
+
+	if number, err := strconv.ParseFloat(trimmed, 64); err == nil && strconv.FormatFloat(number, 'f', -1, 64) == trimmed {
+		return number, true
+	}
+	return value, true
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/middleware"
+	"ecom/backend/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultQuestionPageSize = 10
+	maxQuestionPageSize     = 50
+	topQuestionsInDetails   = 3
+	maxQuestionLength       = 1000
+)
+
+type QuestionRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+type AnswerRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+type QuestionListResponse struct {
+	Questions []models.ProductQuestion `json:"questions"`
+	Total     int64                    `json:"total"`
+	Page      int                      `json:"page"`
+	Limit     int                      `json:"limit"`
+}
+
+// questionFromPath loads the question named by the question_id path parameter for the product
+func questionFromPath(c *gin.Context) (*models.Product, *models.ProductQuestion, bool) {
+	product, ok := productFromPath(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	question, err := models.InitProductQuestionRepo(database.DB).GetQuestion(&models.ProductQuestion{
+		UUID:      c.Param("question_id"),
+		ProductID: product.ID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "question not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get question"})
+		return nil, nil, false
+	}
+	return product, question, true
+}
+
+// postBody trims a question or answer body and checks its length
+func postBody(c *gin.Context, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" || len(body) > maxQuestionLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be between 1 and 1000 characters"})
+		return "", false
+	}
+	return body, true
+}
+
+// ListProductQuestions returns a page of a product's questions with their answers
+func ListProductQuestions(c *gin.Context) {
+	var (
+		questionRepo = models.InitProductQuestionRepo(database.DB)
+		answeredOnly = c.Query("answered") == "true"
+		page         = 1
+		limit        = defaultQuestionPageSize
+	)
+
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxQuestionPageSize)
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	questions, total, err := questionRepo.ListQuestions(product.ID, answeredOnly, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get questions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, QuestionListResponse{
+		Questions: questions,
+		Total:     total,
+		Page:      page,
+		Limit:     limit,
+	})
+}
+
+// AskProductQuestion posts a customer's question about a product
+func AskProductQuestion(c *gin.Context) {
+	var (
+		request      = QuestionRequest{}
+		questionRepo = models.InitProductQuestionRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	body, ok := postBody(c, request.Body)
+	if !ok {
+		return
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	question := models.ProductQuestion{
+		ProductID:   product.ID,
+		AccountUUID: c.GetString(middleware.AccountUUIDContextKey),
+		Body:        body,
+	}
+	if err := questionRepo.CreateQuestion(&question); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create question"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, question)
+}
+
+// AnswerProductQuestion answers a question; allowed for the product's merchant and for verified buyers
+func AnswerProductQuestion(c *gin.Context) {
+	var (
+		request      = AnswerRequest{}
+		questionRepo = models.InitProductQuestionRepo(database.DB)
+		accountUUID  = c.GetString(middleware.AccountUUIDContextKey)
+		role         = c.GetString(middleware.AuthorizedUserRoleContextKey)
+		answer       = models.ProductAnswer{AccountUUID: accountUUID}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	body, ok := postBody(c, request.Body)
+	if !ok {
+		return
+	}
+
+	product, question, ok := questionFromPath(c)
+	if !ok {
+		return
+	}
+
+	switch role {
+	case models.GetRoleName(models.MerchantRole):
+		merchantInfo, ok := merchantFromContext(c)
+		if !ok {
+			return
+		}
+		answer.IsMerchant = product.MerchantID == merchantInfo.UUID
+	case models.GetRoleName(models.CustomerRole):
+		purchased, err := models.InitProductReviewRepo(database.DB).HasPurchased(accountUUID, product.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify purchase"})
+			return
+		}
+		answer.IsVerifiedBuyer = purchased
+	}
+
+	if !answer.IsMerchant && !answer.IsVerifiedBuyer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the product's merchant or verified buyers can answer"})
+		return
+	}
+
+	answer.QuestionID = question.ID
+	answer.Body = body
+	if err := questionRepo.CreateAnswer(&answer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create answer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, answer)
+}
+
+// UpvoteProductAnswer upvotes an answer (POST) or withdraws the upvote (DELETE)
+func UpvoteProductAnswer(c *gin.Context) {
+	var (
+		questionRepo = models.InitProductQuestionRepo(database.DB)
+		accountUUID  = c.GetString(middleware.AccountUUIDContextKey)
+		upvote       = c.Request.Method != http.MethodDelete
+	)
+
+	_, question, ok := questionFromPath(c)
+	if !ok {
+		return
+	}
+
+	answer, err := questionRepo.GetAnswer(&models.ProductAnswer{
+		UUID:       c.Param("answer_id"),
+		QuestionID: question.ID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "answer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get answer"})
+		return
+	}
+	if answer.AccountUUID == accountUUID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot upvote your own answer"})
+		return
+	}
+
+	count, err := questionRepo.Upvote(answer, accountUUID, upvote)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record upvote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"answer_id": answer.UUID, "upvote_count": count})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRecommendationsInterval = time.Hour
+	recommendationsPerProduct      = 20
+	defaultRecommendationLimit     = 10
+)
+
+type RecommendationsResponse struct {
+	FrequentlyBoughtTogether []ProductDetailsResponse `json:"frequently_bought_together"`
+	Similar                  []ProductDetailsResponse `json:"similar"`
+}
+
+// StartRecommendationRefresher recomputes product recommendations in the
+// background. The interval is configurable via RECOMMENDATIONS_INTERVAL (e.g. "1h").
+func StartRecommendationRefresher() {
+	interval := defaultRecommendationsInterval
+	if d, err := time.ParseDuration(os.Getenv("RECOMMENDATIONS_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := models.InitProductRecommendationRepo(database.DB).Refresh(recommendationsPerProduct); err == nil {
+				utils.Info("refreshed product recommendations")
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// GetProductRecommendations returns the products frequently bought together
+// with the product and the products most similar to it
+func GetProductRecommendations(c *gin.Context) {
+	var (
+		recommendationRepo = models.InitProductRecommendationRepo(database.DB)
+		limit              = defaultRecommendationLimit
+	)
+
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, recommendationsPerProduct)
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	response := RecommendationsResponse{}
+	for kind, target := range map[models.RecommendationKind]*[]ProductDetailsResponse{
+		models.RecommendationFrequentlyBoughtTogether: &response.FrequentlyBoughtTogether,
+		models.RecommendationSimilar:                  &response.Similar,
+	} {
+		products, err := recommendationRepo.List(product.ID, kind, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get recommendations"})
+			return
+		}
+
+		discounts, err := offerDiscounts(productPointers(products)...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product offers"})
+			return
+		}
+
+		*target = make([]ProductDetailsResponse, 0, len(products))
+		for i := range products {
+			*target = append(*target, productSummary(&products[i], discounts))
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
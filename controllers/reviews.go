@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/middleware"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReviewPageSize = 10
+	maxReviewPageSize     = 50
+	maxImagesPerReview    = 5
+)
+
+// ReviewRequest is sent as JSON, or as a multipart form when images are attached
+type ReviewRequest struct {
+	Rating uint   `json:"rating" form:"rating" binding:"required"`
+	Title  string `json:"title" form:"title"`
+	Body   string `json:"body" form:"body"`
+}
+
+type UpdateReviewRequest struct {
+	Rating *uint   `json:"rating"`
+	Title  *string `json:"title"`
+	Body   *string `json:"body"`
+}
+
+type ReviewReplyRequest struct {
+	Reply string `json:"reply" binding:"required"`
+}
+
+type ReviewListResponse struct {
+	Reviews       []models.ProductReview `json:"reviews"`
+	Total         int64                  `json:"total"`
+	Page          int                    `json:"page"`
+	Limit         int                    `json:"limit"`
+	RatingAverage float64                `json:"rating_average"`
+	RatingCount   uint                   `json:"rating_count"`
+}
+
+func validRating(rating uint) bool {
+	return rating >= models.MinReviewRating && rating <= models.MaxReviewRating
+}
+
+// productFromPath loads the product named by the product_id path parameter
+func productFromPath(c *gin.Context) (*models.Product, bool) {
+	product, err := models.InitProductsRepo(database.DB).Get(&models.Product{UUID: c.Param("product_id")})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product"})
+		return nil, false
+	}
+	return product, true
+}
+
+// reviewFromPath loads the review named by the review_id path parameter for the product
+func reviewFromPath(c *gin.Context) (*models.Product, *models.ProductReview, bool) {
+	product, ok := productFromPath(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	review, err := models.InitProductReviewRepo(database.DB).Get(&models.ProductReview{
+		UUID:      c.Param("review_id"),
+		ProductID: product.ID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get review"})
+		return nil, nil, false
+	}
+	return product, review, true
+}
+
+// ListProductReviews returns a page of a product's reviews with its rating aggregates
+func ListProductReviews(c *gin.Context) {
+	var (
+		reviewRepo = models.InitProductReviewRepo(database.DB)
+		sort       = models.ReviewSort(c.DefaultQuery("sort", string(models.ReviewSortNewest)))
+		page       = 1
+		limit      = defaultReviewPageSize
+	)
+
+	if !sort.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of newest, helpful, rating"})
+		return
+	}
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, maxReviewPageSize)
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	reviews, total, err := reviewRepo.List(product.ID, sort, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReviewListResponse{
+		Reviews:       reviews,
+		Total:         total,
+		Page:          page,
+		Limit:         limit,
+		RatingAverage: product.RatingAverage,
+		RatingCount:   product.RatingCount,
+	})
+}
+
+// CreateProductReview lets a customer who bought the product rate it, optionally
+// attaching images as the multipart field "images"
+func CreateProductReview(c *gin.Context) {
+	var (
+		request     = ReviewRequest{}
+		reviewRepo  = models.InitProductReviewRepo(database.DB)
+		accountUUID = c.GetString(middleware.AccountUUIDContextKey)
+		maxBytes    = maxImageBytes()
+	)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes*maxImagesPerReview+(1<<20))
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if !validRating(request.Rating) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rating must be between %d and %d", models.MinReviewRating, models.MaxReviewRating)})
+		return
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	purchased, err := reviewRepo.HasPurchased(accountUUID, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify purchase"})
+		return
+	}
+	if !purchased {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers with a completed order for this product can review it"})
+		return
+	}
+
+	if _, err := reviewRepo.Get(&models.ProductReview{ProductID: product.ID, AccountUUID: accountUUID}); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "you have already reviewed this product"})
+		return
+	}
+
+	var files []*multipart.FileHeader
+	if form, err := c.MultipartForm(); err == nil {
+		files = form.File["images"]
+	}
+	if len(files) > maxImagesPerReview {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a review can have at most %d images", maxImagesPerReview)})
+		return
+	}
+
+	reviewUUID, _ := utils.GenerateNanoID(12, "rev_")
+	review := models.ProductReview{
+		UUID:        reviewUUID,
+		ProductID:   product.ID,
+		AccountUUID: accountUUID,
+		Rating:      request.Rating,
+		Title:       strings.TrimSpace(request.Title),
+		Body:        strings.TrimSpace(request.Body),
+	}
+
+	for i, fileHeader := range files {
+		if fileHeader.Size > maxBytes {
+			deleteBlobs(c, review.StorageKeys)
+			c.JSON(http.StatusBadRequest, gin.H{"error": utils.ErrImageTooLarge.Error(), "file": fileHeader.Filename})
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			deleteBlobs(c, review.StorageKeys)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file", "file": fileHeader.Filename})
+			return
+		}
+		data, contentType, img, err := utils.ReadImage(file, maxBytes)
+		file.Close()
+		if err != nil {
+			deleteBlobs(c, review.StorageKeys)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "file": fileHeader.Filename})
+			return
+		}
+
+		stored, err := storeImage(c, fmt.Sprintf("reviews/%s/%s/%d", product.UUID, reviewUUID, i),
+			data, contentType, img, map[string]int{"large": thumbnailSizes["large"]})
+		if err != nil {
+			utils.Error("unable to store review image ", err)
+			deleteBlobs(c, review.StorageKeys)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store image", "file": fileHeader.Filename})
+			return
+		}
+		review.Images = append(review.Images, stored.Thumbnails["large"])
+		review.StorageKeys = append(review.StorageKeys, stored.Keys...)
+	}
+
+	if err := reviewRepo.Create(&review); err != nil {
+		deleteBlobs(c, review.StorageKeys)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create review"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, review)
+}
+
+// UpdateProductReview lets the author change the rating or text of their review
+func UpdateProductReview(c *gin.Context) {
+	var (
+		request    = UpdateReviewRequest{}
+		reviewRepo = models.InitProductReviewRepo(database.DB)
+		values     = map[string]interface{}{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	_, review, ok := reviewFromPath(c)
+	if !ok {
+		return
+	}
+	if review.AccountUUID != c.GetString(middleware.AccountUUIDContextKey) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can edit a review"})
+		return
+	}
+
+	if request.Rating != nil {
+		if !validRating(*request.Rating) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rating must be between %d and %d", models.MinReviewRating, models.MaxReviewRating)})
+			return
+		}
+		values["rating"] = *request.Rating
+	}
+	if request.Title != nil {
+		values["title"] = strings.TrimSpace(*request.Title)
+	}
+	if request.Body != nil {
+		values["body"] = strings.TrimSpace(*request.Body)
+	}
+	if len(values) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	if err := reviewRepo.Update(review, values); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update review"})
+		return
+	}
+
+	updated, err := reviewRepo.Get(&models.ProductReview{UUID: review.UUID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get review"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteProductReview removes a review; allowed for its author and for admins
+func DeleteProductReview(c *gin.Context) {
+	var (
+		reviewRepo = models.InitProductReviewRepo(database.DB)
+	)
+
+	_, review, ok := reviewFromPath(c)
+	if !ok {
+		return
+	}
+
+	isAdmin := c.GetString(middleware.AuthorizedUserRoleContextKey) == models.GetRoleName(models.AdminRole)
+	if review.AccountUUID != c.GetString(middleware.AccountUUIDContextKey) && !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can delete a review"})
+		return
+	}
+
+	if err := reviewRepo.Delete(review); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete review"})
+		return
+	}
+	deleteBlobs(c, review.StorageKeys)
+
+	c.JSON(http.StatusOK, gin.H{"message": "review deleted"})
+}
+
+// ReplyToProductReview sets the merchant's public reply to a review of one of their products
+func ReplyToProductReview(c *gin.Context) {
+	var (
+		request    = ReviewReplyRequest{}
+		reviewRepo = models.InitProductReviewRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	merchantInfo, ok := merchantFromContext(c)
+	if !ok {
+		return
+	}
+
+	product, review, ok := reviewFromPath(c)
+	if !ok {
+		return
+	}
+	if product.MerchantID != merchantInfo.UUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the product's merchant can reply"})
+		return
+	}
+
+	repliedAt := time.Now()
+	err := reviewRepo.Update(review, map[string]interface{}{
+		"merchant_reply":      strings.TrimSpace(request.Reply),
+		"merchant_replied_at": repliedAt,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save reply"})
+		return
+	}
+
+	review.MerchantReply = strings.TrimSpace(request.Reply)
+	review.MerchantRepliedAt = &repliedAt
+	c.JSON(http.StatusOK, review)
+}
+
+// VoteReviewHelpful marks a review as helpful (POST) or withdraws the vote (DELETE)
+func VoteReviewHelpful(c *gin.Context) {
+	var (
+		reviewRepo  = models.InitProductReviewRepo(database.DB)
+		accountUUID = c.GetString(middleware.AccountUUIDContextKey)
+		helpful     = c.Request.Method != http.MethodDelete
+	)
+
+	_, review, ok := reviewFromPath(c)
+	if !ok {
+		return
+	}
+	if review.AccountUUID == accountUUID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot vote on your own review"})
+		return
+	}
+
+	count, err := reviewRepo.Vote(review, accountUUID, helpful)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record vote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"review_id": review.UUID, "helpful_count": count})
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	sitemapBatchSize    = 1000
+	maxSitemapURLs      = 50000 // per sitemap file, the protocol's limit
+	maxMetaTitle        = 60
+	maxMetaDescription  = 160
+	sitemapDateLayout   = "2006-01-02"
+	sitemapNamespaceURI = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+type CategorySEORequest struct {
+	Slug            string `json:"slug"`
+	MetaTitle       string `json:"meta_title"`
+	MetaDescription string `json:"meta_description"`
+}
+
+type sitemapURL struct {
+	XMLName xml.Name `xml:"url"`
+	Loc     string   `xml:"loc"`
+	LastMod string   `xml:"lastmod,omitempty"`
+}
+
+type sitemapRef struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapIndex struct {
+	XMLName   xml.Name     `xml:"sitemapindex"`
+	Namespace string       `xml:"xmlns,attr"`
+	Sitemaps  []sitemapRef `xml:"sitemap"`
+}
+
+// sitemapBaseURL is the configured public origin used in sitemap links. The
+// request's Host header is never used, so it cannot be spoofed into the links.
+func sitemapBaseURL(c *gin.Context) (string, bool) {
+	base := publicSiteURL()
+	if base == "" {
+		utils.Error("unable to generate sitemap ", errors.New("SITE_BASE_URL is not set"))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "sitemap is not configured"})
+		return "", false
+	}
+	return base, true
+}
+
+// metaOrDefault falls back to the given text, cut to the length search engines display
+func metaOrDefault(meta, fallback string, limit int) string {
+	if meta != "" {
+		return meta
+	}
+	if utf8.RuneCountInString(fallback) > limit {
+		return strings.TrimSpace(string([]rune(fallback)[:limit]))
+	}
+	return fallback
+}
+
+// redirectToSlug answers a request made with a retired slug with a permanent
+// redirect to the current one, keeping the query string
+func redirectToSlug(c *gin.Context, prefix, slug string) {
+	location := prefix + slug
+	if c.Request.URL.RawQuery != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+	c.Redirect(http.StatusMovedPermanently, location)
+}
+
+// GetCategory returns a category and its metadata by slug
+func GetCategory(c *gin.Context) {
+	slug := c.Param("category")
+
+	category, err := models.InitCategoryRepo(database.DB).FindBySlug(slug)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get category"})
+		return
+	}
+
+	if category.Slug != slug {
+		redirectToSlug(c, "/category/", category.Slug)
+		return
+	}
+
+	category.MetaTitle = metaOrDefault(category.MetaTitle, category.Name, maxMetaTitle)
+	c.JSON(http.StatusOK, category)
+}
+
+// UpdateCategorySEO sets the slug and metadata of a category, keeping the old
+// slug as a redirect
+func UpdateCategorySEO(c *gin.Context) {
+	var (
+		request      = CategorySEORequest{}
+		categoryRepo = models.InitCategoryRepo(database.DB)
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+	if request.Slug != "" && !models.ValidSlug(request.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug may only contain lowercase letters, digits and single hyphens"})
+		return
+	}
+
+	category, err := categoryRepo.GetByName(c.Param("category"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get category"})
+		return
+	}
+
+	if err := categoryRepo.Update(category, request.Slug, request.MetaTitle, request.MetaDescription); err != nil {
+		if errors.Is(err, models.ErrSlugTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "slug already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// GetSitemap returns the sitemap index of sitemap.xml, pointing at the
+// category sitemap and at as many product sitemaps as the live products need
+func GetSitemap(c *gin.Context) {
+	baseURL, ok := sitemapBaseURL(c)
+	if !ok {
+		return
+	}
+
+	count, err := models.InitProductsRepo(database.DB).CountLive(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate sitemap"})
+		return
+	}
+
+	index := sitemapIndex{Namespace: sitemapNamespaceURI}
+	index.Sitemaps = append(index.Sitemaps, sitemapRef{Loc: baseURL + "/sitemaps/categories.xml"})
+	for page := 1; page <= int((count+maxSitemapURLs-1)/maxSitemapURLs); page++ {
+		index.Sitemaps = append(index.Sitemaps, sitemapRef{Loc: fmt.Sprintf("%s/sitemaps/products-%d.xml", baseURL, page)})
+	}
+
+	c.Header("Content-Type", "application/xml")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString(xml.Header)
+	if err := xml.NewEncoder(c.Writer).Encode(index); err != nil {
+		utils.Error("unable to write sitemap index ", err)
+	}
+}
+
+// GetSitemapPage streams one sitemap of the index: categories.xml with every
+// category that has a live product, or products-<n>.xml with the nth page of
+// live products
+func GetSitemapPage(c *gin.Context) {
+	var (
+		productRepo  = models.InitProductsRepo(database.DB)
+		categoryRepo = models.InitCategoryRepo(database.DB)
+		file         = c.Param("file")
+		page         int
+	)
+
+	isCategories := file == "categories.xml"
+	if !isCategories {
+		if _, err := fmt.Sscanf(file, "products-%d.xml", &page); err != nil || page < 1 || file != fmt.Sprintf("products-%d.xml", page) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "sitemap not found"})
+			return
+		}
+	}
+
+	baseURL, ok := sitemapBaseURL(c)
+	if !ok {
+		return
+	}
+
+	var categories []models.CategorySitemapEntry
+	if isCategories {
+		var err error
+		categories, err = categoryRepo.ListWithLiveProducts(time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate sitemap"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/xml")
+	c.Status(http.StatusOK)
+
+	encoder := xml.NewEncoder(c.Writer)
+	writeURL := func(path, slug string, updatedAt time.Time) error {
+		return encoder.Encode(sitemapURL{
+			Loc:     baseURL + path + slug,
+			LastMod: updatedAt.UTC().Format(sitemapDateLayout),
+		})
+	}
+
+	c.Writer.WriteString(xml.Header + `<urlset xmlns="` + sitemapNamespaceURI + `">`)
+
+	for _, category := range categories {
+		if err := writeURL("/category/", category.Slug, category.UpdatedAt); err != nil {
+			utils.Error("unable to write sitemap ", err)
+			return
+		}
+	}
+
+	if !isCategories {
+		offset := (page - 1) * maxSitemapURLs
+		err := productRepo.FindLiveInBatches(offset, maxSitemapURLs, sitemapBatchSize, func(products []models.Product) error {
+			for i := range products {
+				if err := writeURL("/product/", products[i].Slug, products[i].UpdatedAt); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		})
+		// Headers are already sent once streaming started, so only log the failure
+		if err != nil {
+			utils.Error("unable to write sitemap ", err)
+			return
+		}
+	}
+
+	c.Writer.WriteString("</urlset>")
+}
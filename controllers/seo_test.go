@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMetaOrDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		meta     string
+		fallback string
+		limit    int
+		want     string
+	}{
+		{name: "meta wins", meta: "Custom", fallback: "Fallback", limit: 3, want: "Custom"},
+		{name: "short fallback", fallback: "Café", limit: 10, want: "Café"},
+		{name: "fallback of exactly the limit", fallback: "Café", limit: 4, want: "Café"},
+		{name: "cut by characters, not bytes", fallback: "Café crème", limit: 4, want: "Café"},
+		{name: "trailing space trimmed", fallback: "Café crème", limit: 5, want: "Café"},
+		{name: "multi-byte only", fallback: "日本語のタイトル", limit: 3, want: "日本語"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := metaOrDefault(tt.meta, tt.fallback, tt.limit)
+			if got != tt.want {
+				t.Fatalf("metaOrDefault() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Fatalf("metaOrDefault() = %q is not valid UTF-8", got)
+			}
+		})
+	}
+}
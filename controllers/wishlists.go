@@ -0,0 +1,523 @@
+package controllers
+
+import (
+	"ecom/backend/database"
+	"ecom/backend/middleware"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultWishlistWatchInterval = 15 * time.Minute
+	wishlistAlertBatchSize       = 500
+	maxWishlistName              = 100
+)
+
+type CreateWishlistRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type AddWishlistItemRequest struct {
+	ProductID string `json:"product_id" binding:"required"`
+}
+
+type MoveToCartRequest struct {
+	Quantity uint `json:"quantity"`
+}
+
+type WishlistItemResponse struct {
+	ProductID      string `json:"product_id"`
+	Slug           string `json:"slug,omitempty"`
+	Title          string `json:"title,omitempty"`
+	ImageURL       string `json:"image_url,omitempty"`
+	Price          uint   `json:"price"`
+	PriceWhenAdded uint   `json:"price_when_added"`
+	Stock          uint   `json:"stock"`
+	Available      bool   `json:"available"`
+}
+
+type WishlistResponse struct {
+	UUID       string                 `json:"uuid"`
+	Name       string                 `json:"name"`
+	Kind       models.WishlistKind    `json:"kind"`
+	ShareToken *string                `json:"share_token,omitempty"`
+	Items      []WishlistItemResponse `json:"items,omitempty"`
+}
+
+// WishlistNotifier tells customers about wishlisted products that got cheaper
+// or came back in stock
+type WishlistNotifier interface {
+	NotifyWishlistAlert(alert *models.WishlistAlert) error
+}
+
+type logWishlistNotifier struct{}
+
+func (logWishlistNotifier) NotifyWishlistAlert(alert *models.WishlistAlert) error {
+	utils.Info(fmt.Sprintf("wishlist alert %s for %s: product %s at %d (was %d), %d in stock",
+		alert.Kind, alert.AccountUUID, alert.ProductUUID, alert.Price, alert.LastSeenPrice, alert.Stock))
+	return nil
+}
+
+// WishlistAlerts receives the alerts of the wishlist watcher. It only logs them
+// until a delivery channel such as email is plugged in.
+var WishlistAlerts WishlistNotifier = logWishlistNotifier{}
+
+// newWishlistResponse describes the wishlist, pricing the items with the given offer discounts
+func newWishlistResponse(wishlist *models.Wishlist, items []models.WishlistItem, discounts map[uint]float64) WishlistResponse {
+	response := WishlistResponse{
+		UUID:       wishlist.UUID,
+		Name:       wishlist.Name,
+		Kind:       wishlist.Kind,
+		ShareToken: wishlist.ShareToken,
+	}
+	if items == nil {
+		return response
+	}
+
+	now := time.Now()
+	response.Items = make([]WishlistItemResponse, 0, len(items))
+	for i := range items {
+		item, product := &items[i], &items[i].Product
+		response.Items = append(response.Items, WishlistItemResponse{
+			ProductID:      product.UUID,
+			Slug:           product.Slug,
+			Title:          product.Title,
+			ImageURL:       product.ImageURL,
+			Price:          effectivePrice(product, discounts),
+			PriceWhenAdded: item.PriceWhenAdded,
+			Stock:          product.Stock,
+			Available:      product.ID != 0 && product.IsLive(now) && product.Stock > 0,
+		})
+	}
+	return response
+}
+
+// wishlistFromPath loads the wishlist named by the wishlist_id path parameter,
+// when it belongs to the authenticated customer
+func wishlistFromPath(c *gin.Context) (*models.Wishlist, bool) {
+	wishlist, err := models.InitWishlistRepo(database.DB).Get(&models.Wishlist{
+		UUID:        c.Param("wishlist_id"),
+		AccountUUID: c.GetString(middleware.AccountUUIDContextKey),
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wishlist not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wishlist"})
+		return nil, false
+	}
+	return wishlist, true
+}
+
+// wishlistItemFromPath loads the wishlist and the product named by the
+// product_id path parameter. Deleted products can still be found, so they can
+// be removed from the list.
+func wishlistItemFromPath(c *gin.Context) (*models.Wishlist, *models.Product, bool) {
+	wishlist, ok := wishlistFromPath(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	product, err := models.InitProductsRepo(database.DB).GetWithTx(database.DB.Unscoped(),
+		&models.Product{UUID: c.Param("product_id")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not on the wishlist"})
+		return nil, nil, false
+	}
+	return wishlist, product, true
+}
+
+// wishlistItemDiscounts returns the offer discounts of the products on the wishlist items
+func wishlistItemDiscounts(items []models.WishlistItem) (map[uint]float64, error) {
+	products := make([]*models.Product, 0, len(items))
+	for i := range items {
+		products = append(products, &items[i].Product)
+	}
+	return offerDiscounts(products...)
+}
+
+// addWishlistItem puts the product on the wishlist at the price it sells for
+// now, so a later offer counts as a price drop but a running one does not
+func addWishlistItem(wishlistID uint, product *models.Product) error {
+	discounts, err := offerDiscounts(product)
+	if err != nil {
+		return err
+	}
+	return models.InitWishlistRepo(database.DB).AddItem(wishlistID, product, effectivePrice(product, discounts))
+}
+
+func respondWithWishlist(c *gin.Context, status int, wishlist *models.Wishlist) {
+	items, err := models.InitWishlistRepo(database.DB).GetItems(wishlist.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wishlist"})
+		return
+	}
+	discounts, err := wishlistItemDiscounts(items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wishlist"})
+		return
+	}
+	c.JSON(status, newWishlistResponse(wishlist, items, discounts))
+}
+
+// ListWishlists returns the customer's wishlists, without their items
+func ListWishlists(c *gin.Context) {
+	wishlists, err := models.InitWishlistRepo(database.DB).List(c.GetString(middleware.AccountUUIDContextKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list wishlists"})
+		return
+	}
+
+	response := make([]WishlistResponse, 0, len(wishlists))
+	for i := range wishlists {
+		response = append(response, newWishlistResponse(&wishlists[i], nil, nil))
+	}
+	c.JSON(http.StatusOK, gin.H{"wishlists": response})
+}
+
+// CreateWishlist creates a named wishlist for the customer
+func CreateWishlist(c *gin.Context) {
+	var (
+		request = CreateWishlistRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > maxWishlistName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be 1 to %d characters", maxWishlistName)})
+		return
+	}
+
+	wishlist := models.Wishlist{
+		AccountUUID: c.GetString(middleware.AccountUUIDContextKey),
+		Name:        request.Name,
+		Kind:        models.WishlistKindWishlist,
+	}
+	if err := models.InitWishlistRepo(database.DB).Create(&wishlist); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newWishlistResponse(&wishlist, []models.WishlistItem{}, nil))
+}
+
+// GetWishlist returns one of the customer's wishlists with its items
+func GetWishlist(c *gin.Context) {
+	wishlist, ok := wishlistFromPath(c)
+	if !ok {
+		return
+	}
+	respondWithWishlist(c, http.StatusOK, wishlist)
+}
+
+// DeleteWishlist deletes a wishlist with its items. The saved for later list
+// cannot be deleted, only emptied.
+func DeleteWishlist(c *gin.Context) {
+	wishlist, ok := wishlistFromPath(c)
+	if !ok {
+		return
+	}
+	if wishlist.Kind == models.WishlistKindSavedForLater {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the saved for later list cannot be deleted"})
+		return
+	}
+
+	if err := models.InitWishlistRepo(database.DB).Delete(wishlist); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete wishlist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "wishlist deleted"})
+}
+
+// AddWishlistItem adds a live product to a wishlist; adding it twice does nothing
+func AddWishlistItem(c *gin.Context) {
+	var (
+		request = AddWishlistItemRequest{}
+	)
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	wishlist, ok := wishlistFromPath(c)
+	if !ok {
+		return
+	}
+	product, ok := cartProductFromRequest(c, request.ProductID)
+	if !ok {
+		return
+	}
+
+	if err := addWishlistItem(wishlist.ID, product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add to wishlist"})
+		return
+	}
+	respondWithWishlist(c, http.StatusOK, wishlist)
+}
+
+// RemoveWishlistItem removes a product from a wishlist
+func RemoveWishlistItem(c *gin.Context) {
+	wishlist, product, ok := wishlistItemFromPath(c)
+	if !ok {
+		return
+	}
+
+	removed, err := models.InitWishlistRepo(database.DB).RemoveItem(wishlist.ID, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update wishlist"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not on the wishlist"})
+		return
+	}
+	respondWithWishlist(c, http.StatusOK, wishlist)
+}
+
+// MoveWishlistItemToCart adds a product on a wishlist to the customer's cart,
+// one unless a quantity is given, and takes it off the wishlist
+func MoveWishlistItemToCart(c *gin.Context) {
+	var (
+		request      = MoveToCartRequest{}
+		wishlistRepo = models.InitWishlistRepo(database.DB)
+	)
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+	}
+	if request.Quantity == 0 {
+		request.Quantity = 1
+	}
+
+	wishlist, ok := wishlistFromPath(c)
+	if !ok {
+		return
+	}
+	product, ok := cartProductFromRequest(c, c.Param("product_id"))
+	if !ok {
+		return
+	}
+
+	removed, err := wishlistRepo.RemoveItem(wishlist.ID, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update wishlist"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not on the wishlist"})
+		return
+	}
+
+	cart, ok := cartFromContext(c, true)
+	if ok && addProductToCart(c, cart, product, request.Quantity) {
+		respondWithCart(c, cart)
+		return
+	}
+
+	// Put the product back, the error response has already been written
+	if err := addWishlistItem(wishlist.ID, product); err != nil {
+		utils.Error("unable to restore wishlist item ", err)
+	}
+}
+
+// SaveCartItemForLater moves a product from the cart to the customer's saved for later list
+func SaveCartItemForLater(c *gin.Context) {
+	var (
+		cartRepo     = models.InitCartRepo(database.DB)
+		wishlistRepo = models.InitWishlistRepo(database.DB)
+	)
+
+	accountUUID := c.GetString(middleware.AccountUUIDContextKey)
+	if accountUUID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "log in to save items for later"})
+		return
+	}
+
+	cart, ok := cartFromContext(c, false)
+	if !ok {
+		return
+	}
+
+	items, err := cartRepo.GetItems(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update cart"})
+		return
+	}
+
+	var item *models.CartItem
+	for i := range items {
+		if items[i].Product.UUID == c.Param("product_id") {
+			item = &items[i]
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+
+	saved, err := wishlistRepo.GetSavedForLater(accountUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save for later"})
+		return
+	}
+	if err := addWishlistItem(saved.ID, &item.Product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save for later"})
+		return
+	}
+	if _, err := cartRepo.RemoveItem(cart.ID, item.ProductID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update cart"})
+		return
+	}
+
+	respondWithCart(c, cart)
+}
+
+// ShareWishlist creates a public link to the wishlist, or returns the existing one
+func ShareWishlist(c *gin.Context) {
+	wishlist, ok := wishlistFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := models.InitWishlistRepo(database.DB).Share(wishlist); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to share wishlist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"share_token": *wishlist.ShareToken,
+		"url":         publicSiteURL() + "/shared/wishlists/" + *wishlist.ShareToken,
+	})
+}
+
+// UnshareWishlist revokes the public link of the wishlist
+func UnshareWishlist(c *gin.Context) {
+	wishlist, ok := wishlistFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := models.InitWishlistRepo(database.DB).Unshare(wishlist); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unshare wishlist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "wishlist is no longer shared"})
+}
+
+// GetSharedWishlist returns a shared wishlist by its share token, showing only
+// the products that are still live
+func GetSharedWishlist(c *gin.Context) {
+	var (
+		wishlistRepo = models.InitWishlistRepo(database.DB)
+		token        = c.Param("share_token")
+	)
+
+	wishlist, err := wishlistRepo.Get(&models.Wishlist{ShareToken: &token})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wishlist not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wishlist"})
+		return
+	}
+
+	items, err := wishlistRepo.GetItems(wishlist.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wishlist"})
+		return
+	}
+	now := time.Now()
+	live := items[:0]
+	for _, item := range items {
+		if item.Product.ID != 0 && item.Product.IsLive(now) {
+			live = append(live, item)
+		}
+	}
+
+	discounts, err := wishlistItemDiscounts(live)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wishlist"})
+		return
+	}
+
+	response := newWishlistResponse(wishlist, live, discounts)
+	response.ShareToken = nil
+	c.JSON(http.StatusOK, response)
+}
+
+// StartWishlistWatcher notifies customers when a wishlisted product gets
+// cheaper or comes back in stock. The interval is configurable via
+// WISHLIST_WATCH_INTERVAL (e.g. "15m").
+func StartWishlistWatcher() {
+	interval := defaultWishlistWatchInterval
+	if d, err := time.ParseDuration(os.Getenv("WISHLIST_WATCH_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := sendWishlistAlerts(); err != nil {
+				utils.Error("unable to send wishlist alerts ", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// sendWishlistAlerts claims each pending alert before notifying, so an alert
+// is sent once even with several instances running
+func sendWishlistAlerts() error {
+	var (
+		wishlistRepo = models.InitWishlistRepo(database.DB)
+	)
+
+	if err := wishlistRepo.SyncSeen(); err != nil {
+		return err
+	}
+
+	for {
+		alerts, err := wishlistRepo.PendingAlerts(wishlistAlertBatchSize)
+		if err != nil {
+			return err
+		}
+
+		claimedAny := false
+		for i := range alerts {
+			claimed, err := wishlistRepo.ClaimAlert(&alerts[i])
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				continue
+			}
+			claimedAny = true
+			if err := WishlistAlerts.NotifyWishlistAlert(&alerts[i]); err != nil {
+				utils.Error("unable to notify wishlist alert ", err)
+			}
+		}
+
+		if len(alerts) < wishlistAlertBatchSize || !claimedAny {
+			return nil
+		}
+	}
+}
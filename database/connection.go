@@ -31,6 +31,7 @@ func ConnectDB() (*gorm.DB, error) {
 	}
 
 	DB = db
+	dataMigrations := models.GetDataMigrations()
 	models := models.GetMigrationModels()
 
 	// Apply migrations for each model
@@ -39,6 +40,11 @@ func ConnectDB() (*gorm.DB, error) {
 			log.Fatalf("Failed to migrate model: %v", err)
 		}
 	}
+	for _, migrate := range dataMigrations {
+		if err := migrate(db); err != nil {
+			log.Fatalf("Failed to migrate data: %v", err)
+		}
+	}
 	log.Println("Database migrations completed successfully!")
 
 	return db, nil
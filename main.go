@@ -4,6 +4,9 @@ import (
 	"ecom/backend/controllers"
 	"ecom/backend/database"
 	"ecom/backend/middleware"
+	"ecom/backend/models"
+	"ecom/backend/payments"
+	"ecom/backend/storage"
 	"fmt"
 	"log"
 	"os"
@@ -33,6 +36,41 @@ func main() {
 	database.DB = db // Ensure the global DB variable is set
 	log.Println("Successfully connected to the database!")
 
+	// Blob storage for uploaded images
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialise blob storage: %v", err)
+	}
+	storage.Store = store
+
+	// Payment gateway for checkouts
+	paymentProvider, err := payments.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialise payment provider: %v", err)
+	}
+	payments.Provider = paymentProvider
+
+	// Background workers for bulk product uploads
+	controllers.StartImportWorkers()
+
+	// Applies scheduled price changes
+	controllers.StartPriceScheduler()
+
+	// Regenerates the product feeds for shopping comparison engines
+	controllers.StartFeedGenerator()
+
+	// Recomputes product recommendations
+	controllers.StartRecommendationRefresher()
+
+	// Sends price drop and back in stock alerts for wishlisted products
+	controllers.StartWishlistWatcher()
+
+	// Releases the stock of checkouts that were not paid in time
+	controllers.StartCheckoutSweeper()
+
+	// Applies payment webhook events to checkouts
+	controllers.StartPaymentEventWorkers()
+
 	// Initialize Gin router
 	r := gin.Default()
 
@@ -40,16 +78,25 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // Allow all origins
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", controllers.CartTokenHeader, middleware.IdempotencyKeyHeader},
+		ExposeHeaders:    []string{controllers.CartTokenHeader, middleware.IdempotentReplayedHeader},
 		AllowCredentials: true,
 	}))
 
+	// Serve uploaded files when they are stored on the local filesystem
+	if localStore, ok := store.(*storage.LocalStore); ok {
+		r.Static(localStore.URLPath, localStore.Root)
+	}
+
 	// endpoint
 	r.POST("/register", controllers.OnBoardingCustomer)
 	r.POST("/login", controllers.Login)
 
 	r.POST("/merchant/register", controllers.OnBoardingMerchant)
 
+	// payment provider webhooks, authenticated by their signature
+	r.POST("/webhooks/payments/:provider", controllers.ReceivePaymentWebhook)
+
 	// Secure routes with JWT authentication middleware
 	// secured := r.Group("/")
 
@@ -65,22 +112,124 @@ func main() {
 
 	merchantsFullAuthGroup.POST("/product", controllers.CreateProduct)
 	merchantsFullAuthGroup.PUT("/product/:product_id", controllers.UpdateProduct)
+	merchantsFullAuthGroup.POST("/product/:product_id/images", controllers.UploadProductImages)
+	merchantsFullAuthGroup.PUT("/product/:product_id/images/order", controllers.ReorderProductImages)
+	merchantsFullAuthGroup.DELETE("/product/:product_id/images/:image_id", controllers.DeleteProductImage)
+	merchantsFullAuthGroup.POST("/merchant/logo", controllers.UploadMerchantLogo)
+	merchantsFullAuthGroup.GET("/merchant/products/export", controllers.ExportProducts)
+	merchantsFullAuthGroup.PUT("/merchant/feed_settings", controllers.UpdateMerchantFeedSettings)
+	merchantsFullAuthGroup.GET("/merchant/orders", controllers.ListMerchantOrders)
+	merchantsFullAuthGroup.GET("/merchant/orders/:order_id", controllers.GetMerchantOrder)
+	merchantsFullAuthGroup.PUT("/merchant/orders/:order_id/status", controllers.UpdateMerchantOrderStatus)
+	merchantsFullAuthGroup.GET("/merchant/offers", controllers.ListMerchantOffers)
+	merchantsFullAuthGroup.POST("/offers", controllers.CreateOffer)
+	merchantsFullAuthGroup.PUT("/offers/:offer_id", controllers.UpdateOffer)
+	merchantsFullAuthGroup.POST("/offers/:offer_id/activate", controllers.ActivateOffer)
+	merchantsFullAuthGroup.POST("/offers/:offer_id/deactivate", controllers.DeactivateOffer)
+	merchantsFullAuthGroup.DELETE("/offers/:offer_id", controllers.DeleteOffer)
+	merchantsFullAuthGroup.GET("/merchant/coupons", controllers.ListCoupons)
+	merchantsFullAuthGroup.POST("/merchant/coupons", controllers.CreateCoupon)
+	merchantsFullAuthGroup.GET("/merchant/coupons/:coupon_id", controllers.GetCoupon)
+	merchantsFullAuthGroup.PUT("/merchant/coupons/:coupon_id", controllers.UpdateCoupon)
+	merchantsFullAuthGroup.DELETE("/merchant/coupons/:coupon_id", controllers.DeleteCoupon)
+	merchantsFullAuthGroup.PUT("/product/:product_id/status", controllers.UpdateProductStatus)
+	merchantsFullAuthGroup.GET("/product/:product_id/price_schedules", controllers.ListPriceSchedules)
+	merchantsFullAuthGroup.POST("/product/:product_id/price_schedules", controllers.CreatePriceSchedule)
+	merchantsFullAuthGroup.DELETE("/product/:product_id/price_schedules/:schedule_id", controllers.CancelPriceSchedule)
 
 	noAuthGroup := r.Group("")
-	noAuthGroup.GET("/product/:product_id", controllers.GetProductDetails)
+	// Unpublished products are only shown to their merchant and to admins
+	optionalAuth := middleware.OptionalAuthMiddleware([]byte(os.Getenv("SECRET")))
+	noAuthGroup.GET("/product/:product_id", optionalAuth, controllers.GetProductDetails)
 	noAuthGroup.GET("/products", controllers.ListFilteredActiveProducts)
+	noAuthGroup.GET("/category/:category", controllers.GetCategory)
+	noAuthGroup.GET("/category/:category/schema", controllers.GetCategorySchema)
+	noAuthGroup.GET("/sitemap.xml", controllers.GetSitemap)
+	noAuthGroup.GET("/sitemaps/:file", controllers.GetSitemapPage)
+	noAuthGroup.GET("/feeds/:feed", controllers.GetProductFeed)
+	noAuthGroup.GET("/product/:product_id/reviews", controllers.ListProductReviews)
+	noAuthGroup.GET("/product/:product_id/questions", controllers.ListProductQuestions)
+	noAuthGroup.GET("/product/:product_id/price_history", optionalAuth, controllers.GetPriceHistory)
+	noAuthGroup.GET("/product/:product_id/recommendations", controllers.GetProductRecommendations)
+	noAuthGroup.GET("/offers", controllers.ListActiveOffers)
 
 	fullAuth := r.Group("",
 		middleware.AuthMiddleware([]byte(os.Getenv("SECRET")), false))
 
-	fullAuth.POST("/product/checkout", controllers.CreateCheckout)
+	fullAuth.POST("/product/checkout", middleware.Idempotency(), controllers.CreateCheckout)
 
 	// profile
 	fullAuth.GET("/profile", controllers.GetProfile)
 	fullAuth.POST("/products/upload", controllers.BulkUploadProducts)
-	fullAuth.POST("/checkout/complete", controllers.CompleteCheckout)
+	fullAuth.GET("/products/upload/jobs/:job_id", controllers.GetImportJob)
+	fullAuth.GET("/products/upload/jobs/:job_id/errors", controllers.DownloadImportJobErrors)
+	fullAuth.POST("/checkout/complete", middleware.Idempotency(), controllers.CompleteCheckout)
 	fullAuth.GET("/checkout/:checkout_id", controllers.GetCheckoutDetails)
 
+	// cart, for customers and for guests holding a cart token
+	cartGroup := r.Group("/cart",
+		middleware.OptionalAuthMiddleware([]byte(os.Getenv("SECRET"))))
+	cartGroup.GET("", controllers.GetCart)
+	cartGroup.POST("/add", controllers.AddToCart)
+	cartGroup.PUT("/items/:product_id", controllers.UpdateCartItem)
+	cartGroup.DELETE("/remove/:product_id", controllers.RemoveFromCart)
+	cartGroup.POST("/checkout", middleware.Idempotency(), controllers.CheckoutCart)
+	cartGroup.POST("/items/:product_id/save_for_later", controllers.SaveCartItemForLater)
+
+	// wishlists
+	wishlistGroup := fullAuth.Group("/wishlists", middleware.RequireRoles(models.CustomerRole))
+	wishlistGroup.GET("", controllers.ListWishlists)
+	wishlistGroup.POST("", controllers.CreateWishlist)
+	wishlistGroup.GET("/:wishlist_id", controllers.GetWishlist)
+	wishlistGroup.DELETE("/:wishlist_id", controllers.DeleteWishlist)
+	wishlistGroup.POST("/:wishlist_id/items", controllers.AddWishlistItem)
+	wishlistGroup.DELETE("/:wishlist_id/items/:product_id", controllers.RemoveWishlistItem)
+	wishlistGroup.POST("/:wishlist_id/items/:product_id/move_to_cart", controllers.MoveWishlistItemToCart)
+	wishlistGroup.POST("/:wishlist_id/share", controllers.ShareWishlist)
+	wishlistGroup.DELETE("/:wishlist_id/share", controllers.UnshareWishlist)
+	noAuthGroup.GET("/shared/wishlists/:share_token", controllers.GetSharedWishlist)
+
+	// customer side of the mock payment gateway, for local development
+	if _, ok := paymentProvider.(*payments.MockProvider); ok {
+		noAuthGroup.POST("/payments/mock/:intent_id/confirm", controllers.ConfirmMockPayment)
+	}
+
+	// reviews
+	fullAuth.POST("/product/:product_id/reviews",
+		middleware.RequireRoles(models.CustomerRole), controllers.CreateProductReview)
+	fullAuth.PUT("/product/:product_id/reviews/:review_id", controllers.UpdateProductReview)
+	fullAuth.DELETE("/product/:product_id/reviews/:review_id", controllers.DeleteProductReview)
+	fullAuth.POST("/product/:product_id/reviews/:review_id/reply",
+		middleware.RequireRoles(models.MerchantRole), controllers.ReplyToProductReview)
+	fullAuth.POST("/product/:product_id/reviews/:review_id/helpful", controllers.VoteReviewHelpful)
+	fullAuth.DELETE("/product/:product_id/reviews/:review_id/helpful", controllers.VoteReviewHelpful)
+
+	// questions and answers
+	fullAuth.POST("/product/:product_id/questions",
+		middleware.RequireRoles(models.CustomerRole), controllers.AskProductQuestion)
+	fullAuth.POST("/product/:product_id/questions/:question_id/answers",
+		middleware.RequireRoles(models.MerchantRole, models.CustomerRole), controllers.AnswerProductQuestion)
+	fullAuth.POST("/product/:product_id/questions/:question_id/answers/:answer_id/upvote", controllers.UpvoteProductAnswer)
+	fullAuth.DELETE("/product/:product_id/questions/:question_id/answers/:answer_id/upvote", controllers.UpvoteProductAnswer)
+
+	adminGroup := r.Group("/admin",
+		middleware.AuthMiddleware([]byte(os.Getenv("SECRET")), false),
+		middleware.RequireRoles(models.AdminRole))
+
+	adminGroup.GET("/category/schemas", controllers.ListCategorySchemas)
+	adminGroup.PUT("/category/:category/schema", controllers.UpsertCategorySchema)
+	adminGroup.DELETE("/category/:category/schema", controllers.DeleteCategorySchema)
+	adminGroup.PUT("/category/:category/seo", controllers.UpdateCategorySEO)
+	adminGroup.GET("/products/pending", controllers.ListPendingProducts)
+	adminGroup.POST("/product/:product_id/moderation", controllers.ModerateProduct)
+	adminGroup.GET("/payments/events", controllers.ListPaymentEvents)
+	adminGroup.POST("/payments/events/:event_id/replay", controllers.ReplayPaymentEvent)
+	adminGroup.GET("/coupons", controllers.ListCoupons)
+	adminGroup.POST("/coupons", controllers.CreateCoupon)
+	adminGroup.GET("/coupons/:coupon_id", controllers.GetCoupon)
+	adminGroup.PUT("/coupons/:coupon_id", controllers.UpdateCoupon)
+	adminGroup.DELETE("/coupons/:coupon_id", controllers.DeleteCoupon)
+
 	// Display banner in logs
 	banner := `
 	  ,------.  ,-----.  ,-----.  ,--.   ,--. 
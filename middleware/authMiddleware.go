@@ -99,3 +99,34 @@ func AuthMiddleware(secretKey []byte, allowPartial bool) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware authenticates requests carrying an Authorization
+// header like AuthMiddleware and lets anonymous requests through
+func OptionalAuthMiddleware(secretKey []byte) gin.HandlerFunc {
+	auth := AuthMiddleware(secretKey, false)
+	return func(c *gin.Context) {
+		if c.GetHeader(AuthorizationHeader) == "" {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
+
+// RequireRoles allows the request through only when AuthMiddleware authorized one of the given roles
+func RequireRoles(roleIDs ...uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString(AuthorizedUserRoleContextKey)
+		for _, roleID := range roleIDs {
+			if role == models.GetRoleName(roleID) {
+				c.Next()
+				return
+			}
+		}
+
+		utils.Error("role not allowed for this route ", role)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "insufficient permissions",
+		})
+	}
+}
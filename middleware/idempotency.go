@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"ecom/backend/database"
+	"ecom/backend/models"
+	"ecom/backend/utils"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	IdempotencyKeyTTL         = 24 * time.Hour
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a request carrying an Idempotency-Key header safe to
+// retry. The first request with a key runs and its response is stored per key
+// and account; retries with the same body get that response replayed, while
+// reusing the key for a different request is rejected. Server errors are not
+// stored so the request can be retried. Requests without the header, or
+// without an authenticated account, pass through unchanged.
+func Idempotency() gin.HandlerFunc {
+	return idempotency(func() models.IIdempotencyKeyRepo {
+		return models.InitIdempotencyKeyRepo(database.DB)
+	})
+}
+
+// idempotency is Idempotency with the keys kept in the repo newKeyRepo returns
+func idempotency(newKeyRepo func() models.IIdempotencyKeyRepo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			keyRepo     = newKeyRepo()
+			key         = c.GetHeader(IdempotencyKeyHeader)
+			accountUUID = c.GetString(AccountUUIDContextKey)
+		)
+
+		if key == "" || accountUUID == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentRequestBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unable to read request body"})
+			return
+		}
+		if len(body) > maxIdempotentRequestBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body is too large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The fingerprint covers the route as well, so a key cannot be replayed on another endpoint
+		hash := sha256.New()
+		io.WriteString(hash, c.Request.Method+" "+c.FullPath()+"\n")
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		record, claimed, err := keyRepo.Claim(&models.IdempotencyKey{
+			AccountUUID: accountUUID,
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   time.Now().Add(IdempotencyKeyTTL),
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process Idempotency-Key"})
+			return
+		}
+
+		if !claimed {
+			switch {
+			case record.RequestHash != requestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+					"error": "Idempotency-Key was already used for a different request",
+				})
+			case record.StatusCode == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"error": "a request with this Idempotency-Key is still in progress",
+				})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(record.StatusCode, record.ContentType, record.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		completed := false
+		defer func() {
+			if !completed {
+				keyRepo.Release(record)
+			}
+		}()
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+		record.StatusCode = c.Writer.Status()
+		record.ContentType = c.Writer.Header().Get("Content-Type")
+		record.ResponseBody = recorder.body.Bytes()
+		if err := keyRepo.Complete(record); err != nil {
+			utils.Error("unable to store idempotent response for key ", key)
+			return
+		}
+		completed = true
+	}
+}
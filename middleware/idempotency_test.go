@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"ecom/backend/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryKeyRepo keeps idempotency keys in memory, claiming them atomically
+type memoryKeyRepo struct {
+	mu   sync.Mutex
+	keys map[string]*models.IdempotencyKey
+}
+
+func (r *memoryKeyRepo) Claim(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := key.AccountUUID + "/" + key.Key
+	if existing, ok := r.keys[id]; ok {
+		stored := *existing
+		return &stored, false, nil
+	}
+	stored := *key
+	r.keys[id] = &stored
+	return key, true, nil
+}
+
+func (r *memoryKeyRepo) Complete(key *models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *key
+	r.keys[key.AccountUUID+"/"+key.Key] = &stored
+	return nil
+}
+
+func (r *memoryKeyRepo) Release(key *models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.keys, key.AccountUUID+"/"+key.Key)
+	return nil
+}
+
+func (r *memoryKeyRepo) DeleteExpired(time.Time) (int64, error) {
+	return 0, nil
+}
+
+type idempotentRequest struct {
+	account string
+	key     string
+	body    string
+	path    string
+}
+
+type idempotentResult struct {
+	status   int
+	replayed bool
+	calls    int
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var (
+		first      = idempotentRequest{account: "acc_1", key: "key-1", body: `{"items":[1]}`}
+		otherBody  = idempotentRequest{account: "acc_1", key: "key-1", body: `{"items":[2]}`}
+		otherAcc   = idempotentRequest{account: "acc_2", key: "key-1", body: `{"items":[1]}`}
+		otherRoute = idempotentRequest{account: "acc_1", key: "key-1", body: `{"items":[1]}`, path: "/other"}
+		noKey      = idempotentRequest{account: "acc_1", body: `{"items":[1]}`}
+		anonymous  = idempotentRequest{key: "key-1", body: `{"items":[1]}`}
+		longKey    = idempotentRequest{account: "acc_1", key: strings.Repeat("k", maxIdempotencyKeyLength+1), body: "{}"}
+	)
+
+	tests := []struct {
+		name     string
+		statuses []int // what the handler answers, call by call
+		requests []idempotentRequest
+		want     []idempotentResult
+	}{
+		{
+			name:     "retry replays the stored response",
+			statuses: []int{http.StatusCreated},
+			requests: []idempotentRequest{first, first, first},
+			want:     []idempotentResult{{http.StatusCreated, false, 1}, {http.StatusCreated, true, 1}, {http.StatusCreated, true, 1}},
+		},
+		{
+			name:     "client errors are replayed too",
+			statuses: []int{http.StatusBadRequest},
+			requests: []idempotentRequest{first, first},
+			want:     []idempotentResult{{http.StatusBadRequest, false, 1}, {http.StatusBadRequest, true, 1}},
+		},
+		{
+			name:     "key reused for another body",
+			statuses: []int{http.StatusCreated},
+			requests: []idempotentRequest{first, otherBody},
+			want:     []idempotentResult{{http.StatusCreated, false, 1}, {http.StatusUnprocessableEntity, false, 1}},
+		},
+		{
+			name:     "key reused on another route",
+			statuses: []int{http.StatusCreated},
+			requests: []idempotentRequest{first, otherRoute},
+			want:     []idempotentResult{{http.StatusCreated, false, 1}, {http.StatusUnprocessableEntity, false, 1}},
+		},
+		{
+			name:     "keys are per account",
+			statuses: []int{http.StatusCreated, http.StatusCreated},
+			requests: []idempotentRequest{first, otherAcc},
+			want:     []idempotentResult{{http.StatusCreated, false, 1}, {http.StatusCreated, false, 2}},
+		},
+		{
+			name:     "server errors are released for a retry",
+			statuses: []int{http.StatusInternalServerError, http.StatusCreated},
+			requests: []idempotentRequest{first, first, first},
+			want:     []idempotentResult{{http.StatusInternalServerError, false, 1}, {http.StatusCreated, false, 2}, {http.StatusCreated, true, 2}},
+		},
+		{
+			name:     "requests without a key pass through",
+			statuses: []int{http.StatusCreated, http.StatusCreated},
+			requests: []idempotentRequest{noKey, noKey},
+			want:     []idempotentResult{{http.StatusCreated, false, 1}, {http.StatusCreated, false, 2}},
+		},
+		{
+			name:     "anonymous requests pass through",
+			statuses: []int{http.StatusCreated, http.StatusCreated},
+			requests: []idempotentRequest{anonymous, anonymous},
+			want:     []idempotentResult{{http.StatusCreated, false, 1}, {http.StatusCreated, false, 2}},
+		},
+		{
+			name:     "key too long",
+			requests: []idempotentRequest{longKey},
+			want:     []idempotentResult{{http.StatusBadRequest, false, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				repo   = &memoryKeyRepo{keys: map[string]*models.IdempotencyKey{}}
+				calls  int
+				router = gin.New()
+			)
+
+			handler := func(c *gin.Context) {
+				status := tt.statuses[calls]
+				calls++
+				c.JSON(status, gin.H{"call": calls})
+			}
+			router.Use(func(c *gin.Context) {
+				if account := c.GetHeader("X-Test-Account"); account != "" {
+					c.Set(AccountUUIDContextKey, account)
+				}
+			}, idempotency(func() models.IIdempotencyKeyRepo { return repo }))
+			router.POST("/checkout", handler)
+			router.POST("/other", handler)
+
+			var storedBody string
+			for i, request := range tt.requests {
+				path := request.path
+				if path == "" {
+					path = "/checkout"
+				}
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(request.body))
+				req.Header.Set("X-Test-Account", request.account)
+				if request.key != "" {
+					req.Header.Set(IdempotencyKeyHeader, request.key)
+				}
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, req)
+
+				want := tt.want[i]
+				replayed := recorder.Header().Get(IdempotentReplayedHeader) == "true"
+				if recorder.Code != want.status || replayed != want.replayed || calls != want.calls {
+					t.Fatalf("request %d: status %d, replayed %v, handler calls %d; want %d, %v, %d",
+						i+1, recorder.Code, replayed, calls, want.status, want.replayed, want.calls)
+				}
+
+				if !replayed {
+					storedBody = recorder.Body.String()
+				} else if recorder.Body.String() != storedBody {
+					t.Fatalf("request %d: replayed %s, want %s", i+1, recorder.Body.String(), storedBody)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var (
+		repo   = &memoryKeyRepo{keys: map[string]*models.IdempotencyKey{}}
+		router = gin.New()
+		inner  *httptest.ResponseRecorder
+	)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/checkout", strings.NewReader(`{"items":[1]}`))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	router.Use(func(c *gin.Context) {
+		c.Set(AccountUUIDContextKey, "acc_1")
+	}, idempotency(func() models.IIdempotencyKeyRepo { return repo }))
+	router.POST("/checkout", func(c *gin.Context) {
+		// A retry arriving while the first request is still running
+		if inner == nil {
+			inner = send()
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	outer := send()
+	if outer.Code != http.StatusCreated {
+		t.Fatalf("first request: status %d, want %d", outer.Code, http.StatusCreated)
+	}
+	if inner.Code != http.StatusConflict {
+		t.Fatalf("concurrent retry: status %d, want %d", inner.Code, http.StatusConflict)
+	}
+	if retry := send(); retry.Code != http.StatusCreated || retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("later retry: status %d, replayed %q, want %d replayed",
+			retry.Code, retry.Header().Get(IdempotentReplayedHeader), http.StatusCreated)
+	}
+}
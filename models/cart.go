@@ -0,0 +1,282 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"ecom/backend/utils"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const cartTokenBytes = 32
+
+// Cart is the server-side shopping cart of a customer, or of a guest holding
+// the cart token. Only the SHA-256 of the token is stored.
+type Cart struct {
+	gorm.Model
+	UUID        string     `gorm:"unique" json:"uuid"`
+	AccountUUID *string    `json:"-" gorm:"uniqueIndex"`
+	TokenHash   *string    `json:"-" gorm:"uniqueIndex"`
+	Items       []CartItem `json:"items,omitempty" gorm:"foreignKey:CartID"`
+}
+
+// CartItem is one product in a cart. Price is the price the customer last saw,
+// so a later change can be pointed out to them.
+type CartItem struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CartID    uint      `json:"-" gorm:"not null;uniqueIndex:idx_cart_items_cart_product"`
+	ProductID uint      `json:"-" gorm:"not null;uniqueIndex:idx_cart_items_cart_product"`
+	Quantity  uint      `json:"quantity"`
+	Price     uint      `json:"price"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Product   Product   `json:"-" gorm:"foreignKey:ProductID"`
+}
+
+type cartRepo struct {
+	db *gorm.DB
+}
+
+func (ct *Cart) BeforeCreate(tx *gorm.DB) error {
+	if ct.UUID == "" {
+		cartUUID, err := utils.GenerateNanoID(12, "cart_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		ct.UUID = cartUUID
+	}
+	return nil
+}
+
+func hashCartToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetOrCreate implements ICartRepo, returning the account's cart and creating it on first use.
+func (cr *cartRepo) GetOrCreate(accountUUID string) (*Cart, error) {
+	return cr.getOrCreateWithTx(cr.db, accountUUID)
+}
+
+func (cr *cartRepo) getOrCreateWithTx(tx *gorm.DB, accountUUID string) (*Cart, error) {
+	cart := Cart{AccountUUID: &accountUUID}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "account_uuid"}},
+		DoNothing: true,
+	}).Create(&cart).Error
+	if err == nil && cart.ID == 0 {
+		err = tx.Model(&Cart{}).Where("account_uuid = ?", accountUUID).Last(&cart).Error
+	}
+	if err != nil {
+		utils.Error("unable to get cart ", err)
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// CreateGuest implements ICartRepo, creating an anonymous cart and returning
+// the opaque token that identifies it.
+func (cr *cartRepo) CreateGuest() (*Cart, string, error) {
+	raw := make([]byte, cartTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		utils.Error("unable to generate cart token ", err)
+		return nil, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	tokenHash := hashCartToken(token)
+
+	cart := Cart{TokenHash: &tokenHash}
+	if err := cr.db.Create(&cart).Error; err != nil {
+		utils.Error("unable to create guest cart ", err)
+		return nil, "", err
+	}
+	return &cart, token, nil
+}
+
+// GetByToken implements ICartRepo.
+func (cr *cartRepo) GetByToken(token string) (*Cart, error) {
+	var cart Cart
+	err := cr.db.Model(&Cart{}).Where("token_hash = ?", hashCartToken(token)).Last(&cart).Error
+	if err != nil {
+		utils.Error("unable to get guest cart ", err)
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// mergeCartItems returns the lines of the account's cart cartID that change
+// when the guest items are merged into its existing items. Quantities of a
+// product in both are summed; all are capped at the product's stock. Guest
+// items of products that are gone or out of stock are dropped. Existing
+// lines keep their ID and price.
+func mergeCartItems(cartID uint, existing, guest []CartItem) []CartItem {
+	lines := make(map[uint]CartItem, len(existing))
+	for _, item := range existing {
+		lines[item.ProductID] = item
+	}
+
+	merged := []CartItem{}
+	for _, item := range guest {
+		// Deleted products are not loaded
+		if item.Product.ID == 0 || item.Product.Stock == 0 {
+			continue
+		}
+		line, ok := lines[item.ProductID]
+		if !ok {
+			line = CartItem{CartID: cartID, ProductID: item.ProductID, Price: item.Price}
+		}
+		line.Quantity = min(line.Quantity+item.Quantity, item.Product.Stock)
+		merged = append(merged, line)
+	}
+	return merged
+}
+
+// MergeGuest implements ICartRepo, moving a guest cart into the account's
+// cart as mergeCartItems describes. The guest cart is deleted.
+func (cr *cartRepo) MergeGuest(guest *Cart, accountUUID string) error {
+	err := cr.db.Transaction(func(tx *gorm.DB) error {
+		cart, err := cr.getOrCreateWithTx(tx, accountUUID)
+		if err != nil {
+			return err
+		}
+
+		var guestItems []CartItem
+		if err := tx.Where("cart_id = ?", guest.ID).Preload("Product").Order("id").Find(&guestItems).Error; err != nil {
+			return err
+		}
+		productIDs := make([]uint, 0, len(guestItems))
+		for _, item := range guestItems {
+			productIDs = append(productIDs, item.ProductID)
+		}
+
+		// Locked so that items added meanwhile are not overwritten
+		var existing []CartItem
+		if len(productIDs) > 0 {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("cart_id = ? AND product_id IN ?", cart.ID, productIDs).
+				Find(&existing).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var added []CartItem
+		for _, line := range mergeCartItems(cart.ID, existing, guestItems) {
+			if line.ID == 0 {
+				added = append(added, line)
+				continue
+			}
+			if err := tx.Model(&CartItem{}).Where("id = ?", line.ID).Update("quantity", line.Quantity).Error; err != nil {
+				return err
+			}
+		}
+		if len(added) > 0 {
+			// A line added meanwhile is summed with the guest's, as AddItem does
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "cart_id"}, {Name: "product_id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"quantity": gorm.Expr("LEAST(cart_items.quantity + excluded.quantity, " +
+						"(SELECT stock FROM products WHERE products.id = excluded.product_id))"),
+					"updated_at": gorm.Expr("excluded.updated_at"),
+				}),
+			}).Create(&added).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("cart_id = ?", guest.ID).Delete(&CartItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Cart{}, guest.ID).Error
+	})
+	if err != nil {
+		utils.Error("unable to merge guest cart ", err)
+		return err
+	}
+	return nil
+}
+
+// GetItems implements ICartRepo, oldest first with their products loaded. The
+// product of an item is left empty when it has since been deleted.
+func (cr *cartRepo) GetItems(cartID uint) ([]CartItem, error) {
+	var items = []CartItem{}
+
+	err := cr.db.Model(&CartItem{}).
+		Where("cart_id = ?", cartID).
+		Preload("Product").
+		Order("created_at, id").
+		Find(&items).Error
+	if err != nil {
+		utils.Error("unable to get cart items ", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// AddItem implements ICartRepo, adding quantity to the product's line or creating it.
+func (cr *cartRepo) AddItem(cartID, productID, quantity, price uint) error {
+	err := cr.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "cart_id"}, {Name: "product_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":   gorm.Expr("cart_items.quantity + excluded.quantity"),
+			"price":      gorm.Expr("excluded.price"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&CartItem{
+		CartID:    cartID,
+		ProductID: productID,
+		Quantity:  quantity,
+		Price:     price,
+	}).Error
+	if err != nil {
+		utils.Error("unable to add cart item ", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateItem implements ICartRepo, saving the quantity and price of an item.
+func (cr *cartRepo) UpdateItem(item *CartItem) error {
+	err := cr.db.Model(&CartItem{}).
+		Where("id = ?", item.ID).
+		Updates(map[string]interface{}{
+			"quantity": item.Quantity,
+			"price":    item.Price,
+		}).Error
+	if err != nil {
+		utils.Error("unable to update cart item ", err)
+		return err
+	}
+	return nil
+}
+
+// RemoveItem implements ICartRepo, reporting whether the product was in the cart.
+func (cr *cartRepo) RemoveItem(cartID, productID uint) (bool, error) {
+	result := cr.db.Where("cart_id = ? AND product_id = ?", cartID, productID).Delete(&CartItem{})
+	if result.Error != nil {
+		utils.Error("unable to remove cart item ", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RemoveCheckedOutWithTx implements ICartRepo, removing the products of a
+// completed checkout from the account's cart.
+func (cr *cartRepo) RemoveCheckedOutWithTx(tx *gorm.DB, accountUUID string, checkoutID uint) error {
+	err := tx.
+		Where("cart_id IN (?)", tx.Model(&Cart{}).Select("id").Where("account_uuid = ?", accountUUID)).
+		Where("product_id IN (?)", tx.Model(&CheckoutItem{}).Select("product_id").Where("checkout_id = ?", checkoutID)).
+		Delete(&CartItem{}).Error
+	if err != nil {
+		utils.Error("unable to remove checked out cart items ", err)
+		return err
+	}
+	return nil
+}
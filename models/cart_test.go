@@ -0,0 +1,107 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestMergeCartItems(t *testing.T) {
+	const cartID = 9
+
+	guestItem := func(productID, quantity, price, stock uint) CartItem {
+		return CartItem{
+			CartID:    1,
+			ProductID: productID,
+			Quantity:  quantity,
+			Price:     price,
+			Product:   Product{Model: gorm.Model{ID: productID}, Stock: stock},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		existing []CartItem
+		guest    []CartItem
+		want     []CartItem
+	}{
+		{
+			name: "empty guest cart",
+			existing: []CartItem{
+				{ID: 20, CartID: cartID, ProductID: 1, Quantity: 2, Price: 100},
+			},
+			want: []CartItem{},
+		},
+		{
+			name:  "new products are added",
+			guest: []CartItem{guestItem(1, 2, 100, 10), guestItem(2, 1, 250, 10)},
+			want: []CartItem{
+				{CartID: cartID, ProductID: 1, Quantity: 2, Price: 100},
+				{CartID: cartID, ProductID: 2, Quantity: 1, Price: 250},
+			},
+		},
+		{
+			name: "quantities in both carts are summed",
+			existing: []CartItem{
+				{ID: 20, CartID: cartID, ProductID: 1, Quantity: 3, Price: 90},
+			},
+			guest: []CartItem{guestItem(1, 2, 100, 10)},
+			want: []CartItem{
+				{ID: 20, CartID: cartID, ProductID: 1, Quantity: 5, Price: 90},
+			},
+		},
+		{
+			name: "sum is capped at the stock",
+			existing: []CartItem{
+				{ID: 20, CartID: cartID, ProductID: 1, Quantity: 3, Price: 100},
+			},
+			guest: []CartItem{guestItem(1, 4, 100, 5)},
+			want: []CartItem{
+				{ID: 20, CartID: cartID, ProductID: 1, Quantity: 5, Price: 100},
+			},
+		},
+		{
+			name:  "guest quantity is capped at the stock",
+			guest: []CartItem{guestItem(1, 8, 100, 5)},
+			want: []CartItem{
+				{CartID: cartID, ProductID: 1, Quantity: 5, Price: 100},
+			},
+		},
+		{
+			name:  "out of stock products are dropped",
+			guest: []CartItem{guestItem(1, 2, 100, 0), guestItem(2, 1, 250, 10)},
+			want: []CartItem{
+				{CartID: cartID, ProductID: 2, Quantity: 1, Price: 250},
+			},
+		},
+		{
+			name: "deleted products are dropped",
+			existing: []CartItem{
+				{ID: 20, CartID: cartID, ProductID: 1, Quantity: 3, Price: 100},
+			},
+			guest: []CartItem{{CartID: 1, ProductID: 1, Quantity: 2, Price: 100}},
+			want:  []CartItem{},
+		},
+		{
+			name: "untouched account lines are left out",
+			existing: []CartItem{
+				{ID: 20, CartID: cartID, ProductID: 1, Quantity: 3, Price: 100},
+				{ID: 21, CartID: cartID, ProductID: 3, Quantity: 1, Price: 400},
+			},
+			guest: []CartItem{guestItem(3, 1, 450, 10)},
+			want: []CartItem{
+				{ID: 21, CartID: cartID, ProductID: 3, Quantity: 2, Price: 400},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeCartItems(cartID, tt.existing, tt.guest)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mergeCartItems() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Category holds the slug and search metadata of a product category. Rows are
+// created the first time a product uses the category.
+type Category struct {
+	gorm.Model
+	Name            string `json:"name" gorm:"uniqueIndex"`
+	Slug            string `json:"slug" gorm:"uniqueIndex"`
+	MetaTitle       string `json:"meta_title,omitempty"`
+	MetaDescription string `json:"meta_description,omitempty"`
+}
+
+type categoryRepo struct {
+	db *gorm.DB
+}
+
+// AfterSave registers the product's category so it gets a slug
+func (p *Product) AfterSave(tx *gorm.DB) error {
+	if p.Category == "" {
+		return nil
+	}
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	return InitCategoryRepo(tx).EnsureWithTx(tx, p.Category)
+}
+
+// EnsureWithTx implements ICategoryRepo, creating the category when it does not exist yet.
+func (cr *categoryRepo) EnsureWithTx(tx *gorm.DB, name string) error {
+	var count int64
+	if err := tx.Model(&Category{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		utils.Error("unable to check category ", err)
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	base := Slugify(name)
+	taken, err := categorySlugs.taken(tx, []string{base})
+	if err != nil {
+		return err
+	}
+	slug, err := categorySlugs.unique(taken, base)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Create(&Category{Name: name, Slug: slug}).Error
+	if err != nil {
+		utils.Error("unable to create category ", err)
+		return err
+	}
+	return nil
+}
+
+// GetByName implements ICategoryRepo.
+func (cr *categoryRepo) GetByName(name string) (*Category, error) {
+	var category Category
+	err := cr.db.Model(&Category{}).Where("name = ?", name).Last(&category).Error
+	if err != nil {
+		utils.Error("unable to get category ", err)
+		return nil, err
+	}
+	return &category, nil
+}
+
+// FindBySlug implements ICategoryRepo. A retired slug returns the category that
+// used it, whose current slug then differs from the one asked for.
+func (cr *categoryRepo) FindBySlug(slug string) (*Category, error) {
+	var category Category
+	err := cr.db.Model(&Category{}).Where("slug = ?", slug).Last(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var name string
+		if name, err = categorySlugs.redirectTarget(cr.db, slug); err == nil {
+			err = cr.db.Model(&Category{}).Where("name = ?", name).Last(&category).Error
+		}
+	}
+	if err != nil {
+		utils.Error("unable to get category by slug ", err)
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Update implements ICategoryRepo, setting the metadata and moving the category
+// to slug when it differs from the current one.
+func (cr *categoryRepo) Update(category *Category, slug, metaTitle, metaDescription string) error {
+	err := cr.db.Transaction(func(tx *gorm.DB) error {
+		if slug != "" && slug != category.Slug {
+			if err := categorySlugs.change(tx, category.Name, category.Slug, slug); err != nil {
+				return err
+			}
+			category.Slug = slug
+		}
+
+		category.MetaTitle, category.MetaDescription = metaTitle, metaDescription
+		return tx.Model(&Category{}).Where("id = ?", category.ID).Updates(map[string]interface{}{
+			"meta_title":       metaTitle,
+			"meta_description": metaDescription,
+		}).Error
+	})
+	if err != nil && !errors.Is(err, ErrSlugTaken) {
+		utils.Error("unable to update category ", err)
+	}
+	return err
+}
+
+// ListWithLiveProducts implements ICategoryRepo, returning the categories that
+// have at least one live product along with when their newest one changed.
+func (cr *categoryRepo) ListWithLiveProducts(now time.Time) ([]CategorySitemapEntry, error) {
+	var entries []CategorySitemapEntry
+	err := cr.db.Model(&Category{}).
+		Select("categories.slug, MAX(products.updated_at) AS updated_at").
+		Joins("JOIN products ON products.category = categories.name AND products.deleted_at IS NULL").
+		Scopes(LiveProducts(now)).
+		Group("categories.slug").
+		Order("categories.slug").
+		Scan(&entries).Error
+	if err != nil {
+		utils.Error("unable to list categories with live products ", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+type CategorySitemapEntry struct {
+	Slug      string    `json:"slug"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
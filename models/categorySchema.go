@@ -0,0 +1,290 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AttributeType string
+
+const (
+	AttributeTypeString  AttributeType = "string"
+	AttributeTypeNumber  AttributeType = "number"
+	AttributeTypeInteger AttributeType = "integer"
+	AttributeTypeBoolean AttributeType = "boolean"
+)
+
+// SpecificationAttribute describes one allowed key of Product.Specifications
+type SpecificationAttribute struct {
+	Key         string        `json:"key" binding:"required"`
+	Type        AttributeType `json:"type" binding:"required"`
+	Required    bool          `json:"required,omitempty"`
+	Enum        []string      `json:"enum,omitempty"`
+	Unit        string        `json:"unit,omitempty"`
+	Min         *float64      `json:"min,omitempty"`
+	Max         *float64      `json:"max,omitempty"`
+	Description string        `json:"description,omitempty"`
+}
+
+// CategorySchema is the attribute schema products of a category must follow
+type CategorySchema struct {
+	gorm.Model
+	Category             string                                      `json:"category" gorm:"uniqueIndex;not null"`
+	Attributes           datatypes.JSONSlice[SpecificationAttribute] `json:"attributes" gorm:"type:jsonb"`
+	AllowAdditionalAttrs bool                                        `json:"allow_additional_attributes" gorm:"default:false"`
+	// RequiresModeration sends products of the category to admin review before they are published
+	RequiresModeration bool `json:"requires_moderation" gorm:"default:false"`
+}
+
+// SpecificationError is a validation failure for a single specification key
+type SpecificationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type categorySchemaRepo struct {
+	db *gorm.DB
+}
+
+// Validate checks the schema definition itself before it is stored
+func (cs *CategorySchema) Validate() []SpecificationError {
+	var (
+		errs = []SpecificationError{}
+		seen = map[string]bool{}
+	)
+
+	for _, attr := range cs.Attributes {
+		field := "attributes." + attr.Key
+		switch {
+		case !specificationKeyPattern.MatchString(attr.Key):
+			errs = append(errs, SpecificationError{Field: field, Message: "key must only contain letters, digits, '_' or '-'"})
+		case seen[attr.Key]:
+			errs = append(errs, SpecificationError{Field: field, Message: "key is defined more than once"})
+		}
+		seen[attr.Key] = true
+
+		switch attr.Type {
+		case AttributeTypeString, AttributeTypeNumber, AttributeTypeInteger, AttributeTypeBoolean:
+		default:
+			errs = append(errs, SpecificationError{Field: field, Message: "type must be one of string, number, integer, boolean"})
+		}
+
+		if len(attr.Enum) > 0 && attr.Type == AttributeTypeBoolean {
+			errs = append(errs, SpecificationError{Field: field, Message: "enum is not supported for boolean attributes"})
+		}
+	}
+	return errs
+}
+
+// ValidateSpecifications checks specifications against the schema and returns
+// them normalised (e.g. "8 GB" stored as 8 for a number attribute with unit GB).
+func (cs *CategorySchema) ValidateSpecifications(specs datatypes.JSON) (datatypes.JSON, []SpecificationError) {
+	var (
+		errs   = []SpecificationError{}
+		values = map[string]interface{}{}
+	)
+
+	if len(specs) > 0 && string(specs) != "null" {
+		if err := json.Unmarshal(specs, &values); err != nil {
+			return specs, []SpecificationError{{Field: "specifications", Message: "must be a JSON object"}}
+		}
+	}
+
+	attributes := map[string]SpecificationAttribute{}
+	for _, attr := range cs.Attributes {
+		attributes[attr.Key] = attr
+
+		if _, ok := values[attr.Key]; !ok && attr.Required {
+			errs = append(errs, SpecificationError{Field: "specifications." + attr.Key, Message: "is required"})
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := "specifications." + key
+		attr, ok := attributes[key]
+		if !ok {
+			if !cs.AllowAdditionalAttrs {
+				errs = append(errs, SpecificationError{Field: field, Message: "is not defined for category " + cs.Category})
+			}
+			continue
+		}
+
+		value, err := attr.normalize(values[key])
+		if err != nil {
+			errs = append(errs, SpecificationError{Field: field, Message: err.Error()})
+			continue
+		}
+		values[key] = value
+	}
+
+	if len(errs) > 0 {
+		return specs, errs
+	}
+
+	normalized, err := json.Marshal(values)
+	if err != nil {
+		return specs, []SpecificationError{{Field: "specifications", Message: "must be a JSON object"}}
+	}
+	return datatypes.JSON(normalized), nil
+}
+
+var unitValuePattern = regexp.MustCompile(`^\s*(-?[0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z%]*)\s*$`)
+
+// normalize converts a raw JSON value to the attribute type and checks its constraints
+func (attr *SpecificationAttribute) normalize(raw interface{}) (interface{}, error) {
+	switch attr.Type {
+	case AttributeTypeBoolean:
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a boolean")
+
+	case AttributeTypeNumber, AttributeTypeInteger:
+		var number float64
+		switch v := raw.(type) {
+		case float64:
+			number = v
+		case string:
+			match := unitValuePattern.FindStringSubmatch(v)
+			if match == nil {
+				return nil, fmt.Errorf("must be a %s", attr.Type)
+			}
+			if match[2] != "" && !strings.EqualFold(match[2], attr.Unit) {
+				if attr.Unit == "" {
+					return nil, fmt.Errorf("must be a %s without a unit", attr.Type)
+				}
+				return nil, fmt.Errorf("unit must be %s", attr.Unit)
+			}
+			number, _ = strconv.ParseFloat(match[1], 64)
+		default:
+			return nil, fmt.Errorf("must be a %s", attr.Type)
+		}
+
+		if attr.Type == AttributeTypeInteger && number != float64(int64(number)) {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if attr.Min != nil && number < *attr.Min {
+			return nil, fmt.Errorf("must be at least %v", *attr.Min)
+		}
+		if attr.Max != nil && number > *attr.Max {
+			return nil, fmt.Errorf("must be at most %v", *attr.Max)
+		}
+		if len(attr.Enum) > 0 && !attr.allows(strconv.FormatFloat(number, 'f', -1, 64)) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(attr.Enum, ", "))
+		}
+		return number, nil
+
+	default:
+		v, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		if len(attr.Enum) > 0 && !attr.allows(v) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(attr.Enum, ", "))
+		}
+		return v, nil
+	}
+}
+
+func (attr *SpecificationAttribute) allows(value string) bool {
+	for _, allowed := range attr.Enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the schema of a category
+func (csr *categorySchemaRepo) Get(category string) (*CategorySchema, error) {
+	var (
+		schema = CategorySchema{}
+	)
+
+	err := csr.db.Model(&CategorySchema{}).
+		Where("category = ?", category).
+		Last(&schema).Error
+	if err != nil {
+		utils.Error("unable to get category schema ", err)
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// Find returns the schema of a category, or nil when the category has none
+func (csr *categorySchemaRepo) Find(category string) (*CategorySchema, error) {
+	var (
+		schemas []CategorySchema
+	)
+
+	err := csr.db.Model(&CategorySchema{}).
+		Where("category = ?", category).
+		Limit(1).
+		Find(&schemas).Error
+	if err != nil {
+		utils.Error("unable to find category schema ", err)
+		return nil, err
+	}
+	if len(schemas) == 0 {
+		return nil, nil
+	}
+	return &schemas[0], nil
+}
+
+// GetAll returns every category schema
+func (csr *categorySchemaRepo) GetAll() ([]CategorySchema, error) {
+	var (
+		schemas []CategorySchema
+	)
+
+	err := csr.db.Model(&CategorySchema{}).Order("category").Find(&schemas).Error
+	if err != nil {
+		utils.Error("unable to get category schemas ", err)
+		return nil, err
+	}
+	return schemas, nil
+}
+
+// Upsert creates or replaces the schema of a category
+func (csr *categorySchemaRepo) Upsert(schema *CategorySchema) error {
+	err := csr.db.Model(&CategorySchema{}).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "category"}},
+			DoUpdates: clause.AssignmentColumns([]string{"attributes", "allow_additional_attrs", "requires_moderation", "updated_at"}),
+		}).Create(schema).Error
+	if err != nil {
+		utils.Error("unable to upsert category schema ", err)
+		return err
+	}
+	return nil
+}
+
+// Delete removes the schema of a category
+func (csr *categorySchemaRepo) Delete(category string) error {
+	err := csr.db.Unscoped().Where("category = ?", category).Delete(&CategorySchema{}).Error
+	if err != nil {
+		utils.Error("unable to delete category schema ", err)
+		return err
+	}
+	return nil
+}
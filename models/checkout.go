@@ -2,6 +2,9 @@ package models
 
 import (
 	"ecom/backend/utils"
+	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"gorm.io/gorm"
@@ -16,15 +19,31 @@ const (
 	CheckoutStatusFailed    CheckoutStatus = "FAILED"
 )
 
+// ErrInsufficientStock is returned when a product cannot cover the quantity to reserve
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 type Checkout struct {
 	gorm.Model
-	CheckoutID    string         `json:"checkout_id" gorm:"index"`
-	UserID        string         `json:"user_id" gorm:"index"`
-	TotalAmount   int            `json:"total_amount"`
-	Status        CheckoutStatus `json:"status" gorm:"AUDITABLE"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	CheckoutItems []CheckoutItem `json:"checkout_items" foreignKey:"CheckoutID",references:"CheckoutID"`
+	CheckoutID  string         `json:"checkout_id" gorm:"index"`
+	UserID      string         `json:"user_id" gorm:"index"`
+	TotalAmount int            `json:"total_amount"`
+	Status      CheckoutStatus `json:"status" gorm:"AUDITABLE"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	// SubtotalAmount is the price of the items; TotalAmount is what is paid
+	// after the DiscountAmount of the CouponCode
+	SubtotalAmount int    `json:"subtotal_amount"`
+	DiscountAmount int    `json:"discount_amount"`
+	CouponCode     string `json:"coupon_code,omitempty"`
+	// DiscountMerchantID is the merchant giving the discount, empty when the platform gives it
+	DiscountMerchantID string `json:"-"`
+	// ReservedUntil is when the stock held for a pending checkout is released.
+	// Checkouts created before reservations existed have none.
+	ReservedUntil *time.Time `json:"reserved_until,omitempty" gorm:"index"`
+	// PaymentProvider and PaymentIntentID name the payment taken for the checkout
+	PaymentProvider string         `json:"payment_provider,omitempty"`
+	PaymentIntentID string         `json:"payment_intent_id,omitempty" gorm:"index"`
+	CheckoutItems   []CheckoutItem `json:"checkout_items" gorm:"foreignKey:CheckoutID"`
 }
 
 type checkoutRepo struct {
@@ -90,6 +109,7 @@ func (chk *checkoutRepo) GetWithTx(tx *gorm.DB, where *Checkout) (*Checkout, err
 	err := tx.Model(&Checkout{}).
 		Where(where).
 		Scopes(OmitIDToDeletedAtFields).
+		Preload("CheckoutItems").
 		Last(&c).Error
 	if err != nil {
 		utils.Error("unable to query checkout ", err)
@@ -97,3 +117,208 @@ func (chk *checkoutRepo) GetWithTx(tx *gorm.DB, where *Checkout) (*Checkout, err
 	}
 	return &c, nil
 }
+
+// stockToReserve sums the quantities of the items by product and returns the
+// product ids in the order their stock is locked in, ascending
+func stockToReserve(items []CheckoutItem) ([]uint, map[uint]uint) {
+	quantities := map[uint]uint{}
+	ids := []uint{}
+	for _, item := range items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			ids = append(ids, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, quantities
+}
+
+// reserveStockWithTx takes the quantities of the items out of stock, failing
+// with ErrInsufficientStock when a product cannot cover its quantity. Products
+// are locked in id order so concurrent checkouts cannot deadlock.
+func reserveStockWithTx(tx *gorm.DB, items []CheckoutItem) error {
+	ids, quantities := stockToReserve(items)
+	for _, id := range ids {
+		result := tx.Model(&Product{}).
+			Where("id = ? AND stock >= ?", id, quantities[id]).
+			Update("stock", gorm.Expr("stock - ?", quantities[id]))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w for product %d", ErrInsufficientStock, id)
+		}
+	}
+	return nil
+}
+
+// CreateReservedWithTx implements ICheckoutRepo, creating the checkout with
+// its items and reserving their stock until the checkout's ReservedUntil. A
+// coupon discounting the checkout is redeemed with it, failing with
+// ErrCouponUsedUp or ErrCouponCustomerLimit when it cannot be used.
+func (chk *checkoutRepo) CreateReservedWithTx(tx *gorm.DB, c *Checkout, coupon *Coupon) error {
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := reserveStockWithTx(tx, c.CheckoutItems); err != nil {
+			return err
+		}
+		if err := tx.Create(c).Error; err != nil {
+			return err
+		}
+		if coupon == nil {
+			return nil
+		}
+		return redeemCouponWithTx(tx, coupon, c.UserID, c.ID, c.DiscountAmount)
+	})
+	if err != nil {
+		utils.Error("unable to create checkout ", err)
+		return err
+	}
+	return nil
+}
+
+// CompleteWithTx implements ICheckoutRepo, moving a pending checkout to
+// COMPLETED. Its reserved stock becomes a sale; a checkout without a
+// reservation has its stock deducted now. It reports false when the checkout
+// is no longer pending, e.g. because its reservation expired.
+func (chk *checkoutRepo) CompleteWithTx(tx *gorm.DB, c *Checkout) (bool, error) {
+	result := tx.Model(&Checkout{}).
+		Where("id = ? AND status = ?", c.ID, CheckoutStatusPending).
+		Update("status", CheckoutStatusCompleted)
+	if result.Error != nil {
+		utils.Error("unable to complete checkout ", result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if c.ReservedUntil == nil {
+		if err := reserveStockWithTx(tx, c.CheckoutItems); err != nil {
+			utils.Error("unable to deduct checkout stock ", err)
+			return false, err
+		}
+	}
+	for _, item := range c.CheckoutItems {
+		err := tx.Model(&Product{}).
+			Where("id = ?", item.ProductID).
+			Update("sold_count", gorm.Expr("sold_count + ?", item.Quantity)).Error
+		if err != nil {
+			utils.Error("unable to record checkout sale ", err)
+			return false, err
+		}
+	}
+	c.Status = CheckoutStatusCompleted
+	return true, nil
+}
+
+// ListExpired implements ICheckoutRepo, returning pending checkouts whose
+// reservation ran out before now.
+func (chk *checkoutRepo) ListExpired(now time.Time, limit int) ([]Checkout, error) {
+	var checkouts = []Checkout{}
+
+	err := chk.db.Model(&Checkout{}).
+		Where("status = ? AND reserved_until < ?", CheckoutStatusPending, now).
+		Order("reserved_until").
+		Limit(limit).
+		Find(&checkouts).Error
+	if err != nil {
+		utils.Error("unable to list expired checkouts ", err)
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+// SetPaymentIntent implements ICheckoutRepo.
+func (chk *checkoutRepo) SetPaymentIntent(c *Checkout, provider, intentID string) error {
+	err := chk.db.Model(&Checkout{}).
+		Where("id = ?", c.ID).
+		Updates(map[string]interface{}{
+			"payment_provider":  provider,
+			"payment_intent_id": intentID,
+		}).Error
+	if err != nil {
+		utils.Error("unable to set checkout payment ", err)
+		return err
+	}
+	c.PaymentProvider, c.PaymentIntentID = provider, intentID
+	return nil
+}
+
+// Fail implements ICheckoutRepo, marking a pending checkout FAILED and
+// returning its coupon use and its reserved stock, if it has a reservation. It
+// reports false when the checkout was completed or failed in the meantime.
+func (chk *checkoutRepo) Fail(c *Checkout) (bool, error) {
+	failed := false
+	err := chk.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Checkout{}).
+			Where("id = ? AND status = ?", c.ID, CheckoutStatusPending).
+			Update("status", CheckoutStatusFailed)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		failed = true
+		if err := releaseCouponWithTx(tx, c.ID); err != nil {
+			return err
+		}
+		if c.ReservedUntil == nil {
+			return nil
+		}
+
+		var items []CheckoutItem
+		if err := tx.Where("checkout_id = ?", c.ID).Order("product_id").Find(&items).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			err := tx.Model(&Product{}).
+				Where("id = ?", item.ProductID).
+				Update("stock", gorm.Expr("stock + ?", item.Quantity)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Error("unable to fail checkout ", err)
+		return false, err
+	}
+	if failed {
+		c.Status = CheckoutStatusFailed
+	}
+	return failed, nil
+}
+
+// ReservedQuantities implements ICheckoutRepo, summing the stock held by the
+// user's pending checkouts by product id.
+func (chk *checkoutRepo) ReservedQuantities(userID string) (map[uint]uint, error) {
+	var rows []struct {
+		ProductID uint
+		Quantity  uint
+	}
+
+	err := chk.db.Model(&CheckoutItem{}).
+		Select("checkout_items.product_id, SUM(checkout_items.quantity) AS quantity").
+		Joins("JOIN checkouts ON checkouts.id = checkout_items.checkout_id AND checkouts.deleted_at IS NULL").
+		Where("checkouts.user_id = ? AND checkouts.status = ? AND checkouts.reserved_until IS NOT NULL",
+			userID, CheckoutStatusPending).
+		Group("checkout_items.product_id").
+		Scan(&rows).Error
+	if err != nil {
+		utils.Error("unable to get reserved quantities ", err)
+		return nil, err
+	}
+
+	reserved := make(map[uint]uint, len(rows))
+	for _, row := range rows {
+		reserved[row.ProductID] = row.Quantity
+	}
+	return reserved, nil
+}
+
+// backfillCheckoutSubtotals gives checkouts created before coupons existed
+// their subtotal, which is their total as they had no discount
+func backfillCheckoutSubtotals(db *gorm.DB) error {
+	return db.Model(&Checkout{}).
+		Where("subtotal_amount = 0 AND discount_amount = 0 AND total_amount <> 0").
+		Update("subtotal_amount", gorm.Expr("total_amount")).Error
+}
@@ -7,4 +7,6 @@ type CheckoutItem struct {
 	Price      int  `json:"price"`
 	TotalPrice int  `json:"total_price"`
 	CheckoutID uint `json:"checkout_id"`
+	// MerchantOrderID is the merchant's part of the order the item was bought in
+	MerchantOrderID *uint `json:"-" gorm:"index"`
 }
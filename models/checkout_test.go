@@ -0,0 +1,59 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStockToReserve(t *testing.T) {
+	tests := []struct {
+		name           string
+		items          []CheckoutItem
+		wantIDs        []uint
+		wantQuantities map[uint]uint
+	}{
+		{
+			name:           "no items",
+			wantIDs:        []uint{},
+			wantQuantities: map[uint]uint{},
+		},
+		{
+			name:           "one item",
+			items:          []CheckoutItem{{ProductID: 7, Quantity: 2}},
+			wantIDs:        []uint{7},
+			wantQuantities: map[uint]uint{7: 2},
+		},
+		{
+			name: "locked in ascending id order",
+			items: []CheckoutItem{
+				{ProductID: 9, Quantity: 1},
+				{ProductID: 3, Quantity: 4},
+				{ProductID: 5, Quantity: 2},
+			},
+			wantIDs:        []uint{3, 5, 9},
+			wantQuantities: map[uint]uint{3: 4, 5: 2, 9: 1},
+		},
+		{
+			name: "repeated product summed into one reservation",
+			items: []CheckoutItem{
+				{ProductID: 4, Quantity: 1},
+				{ProductID: 2, Quantity: 3},
+				{ProductID: 4, Quantity: 5},
+			},
+			wantIDs:        []uint{2, 4},
+			wantQuantities: map[uint]uint{2: 3, 4: 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, quantities := stockToReserve(tt.items)
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			if !reflect.DeepEqual(quantities, tt.wantQuantities) {
+				t.Errorf("quantities = %v, want %v", quantities, tt.wantQuantities)
+			}
+		})
+	}
+}
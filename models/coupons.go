@@ -0,0 +1,219 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CouponKind string
+
+const (
+	CouponKindPercentage CouponKind = "PERCENTAGE"
+	CouponKindFixed      CouponKind = "FIXED"
+)
+
+var (
+	ErrCouponUsedUp        = errors.New("coupon has been used up")
+	ErrCouponCustomerLimit = errors.New("coupon usage limit reached for this customer")
+)
+
+func (k CouponKind) IsValid() bool {
+	return k == CouponKindPercentage || k == CouponKindFixed
+}
+
+// Coupon is a discount code redeemed at checkout. A merchant's coupon only
+// discounts that merchant's products; a platform coupon, without MerchantID,
+// discounts the whole checkout. Value is a percentage or an amount in minor units.
+type Coupon struct {
+	gorm.Model
+	UUID               string     `gorm:"unique" json:"uuid"`
+	Code               string     `gorm:"uniqueIndex:idx_coupons_code,where:deleted_at IS NULL;not null" json:"code"`
+	MerchantID         string     `gorm:"index" json:"merchant_id,omitempty"`
+	Description        string     `json:"description,omitempty"`
+	Kind               CouponKind `gorm:"not null" json:"kind"`
+	Value              uint       `gorm:"not null" json:"value"`
+	MinCartValue       uint       `json:"min_cart_value"`
+	StartsAt           *time.Time `json:"starts_at,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	MaxUses            *uint      `json:"max_uses,omitempty"`
+	MaxUsesPerCustomer *uint      `json:"max_uses_per_customer,omitempty"`
+	UsedCount          uint       `gorm:"not null;default:0" json:"used_count"`
+	IsActive           *bool      `gorm:"default:true" json:"is_active"`
+}
+
+// CouponRedemption is the use of a coupon by a checkout. It is removed again
+// when the checkout fails, giving the use back.
+type CouponRedemption struct {
+	ID          uint   `gorm:"primaryKey"`
+	CouponID    uint   `gorm:"index;not null"`
+	AccountUUID string `gorm:"index;not null"`
+	CheckoutID  uint   `gorm:"uniqueIndex;not null"`
+	Amount      int    `gorm:"not null"`
+	CreatedAt   time.Time
+}
+
+type couponRepo struct {
+	db *gorm.DB
+}
+
+// NormalizeCouponCode makes codes case and whitespace insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (cp *Coupon) BeforeCreate(tx *gorm.DB) error {
+	if cp.UUID == "" {
+		couponUUID, err := utils.GenerateNanoID(12, "cpn_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		cp.UUID = couponUUID
+	}
+	cp.Code = NormalizeCouponCode(cp.Code)
+	return nil
+}
+
+// IsRedeemable reports whether the coupon is active, inside its validity
+// window and not used up at now
+func (cp *Coupon) IsRedeemable(now time.Time) bool {
+	return (cp.IsActive == nil || *cp.IsActive) &&
+		(cp.StartsAt == nil || !cp.StartsAt.After(now)) &&
+		(cp.ExpiresAt == nil || cp.ExpiresAt.After(now)) &&
+		(cp.MaxUses == nil || cp.UsedCount < *cp.MaxUses)
+}
+
+// Discount returns the discount the coupon gives on subtotal, never more than subtotal
+func (cp *Coupon) Discount(subtotal uint) uint {
+	var discount uint
+	switch cp.Kind {
+	case CouponKindPercentage:
+		discount = uint(uint64(subtotal) * uint64(min(cp.Value, 100)) / 100)
+	case CouponKindFixed:
+		discount = cp.Value
+	}
+	return min(discount, subtotal)
+}
+
+// Create implements ICouponRepo.
+func (cr *couponRepo) Create(coupon *Coupon) error {
+	if err := cr.db.Create(coupon).Error; err != nil {
+		utils.Error("unable to create coupon ", err)
+		return err
+	}
+	return nil
+}
+
+// Get implements ICouponRepo.
+func (cr *couponRepo) Get(where *Coupon) (*Coupon, error) {
+	var coupon Coupon
+	if err := cr.db.Model(&Coupon{}).Where(where).Last(&coupon).Error; err != nil {
+		utils.Error("unable to get coupon ", err)
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetByCode implements ICouponRepo.
+func (cr *couponRepo) GetByCode(code string) (*Coupon, error) {
+	return cr.Get(&Coupon{Code: NormalizeCouponCode(code)})
+}
+
+// List implements ICouponRepo, returning the coupons of a merchant, or the
+// platform coupons for an empty merchantID, newest first.
+func (cr *couponRepo) List(merchantID string, limit, offset int) ([]Coupon, int64, error) {
+	var (
+		coupons = []Coupon{}
+		total   int64
+	)
+
+	query := cr.db.Model(&Coupon{}).Where("merchant_id = ?", merchantID)
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count coupons ", err)
+		return nil, 0, err
+	}
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&coupons).Error; err != nil {
+		utils.Error("unable to list coupons ", err)
+		return nil, 0, err
+	}
+	return coupons, total, nil
+}
+
+// Update implements ICouponRepo, writing the given columns of coupon.
+func (cr *couponRepo) Update(coupon *Coupon, columns []string) error {
+	if err := cr.db.Model(coupon).Select(columns).Updates(coupon).Error; err != nil {
+		utils.Error("unable to update coupon ", err)
+		return err
+	}
+	return nil
+}
+
+// Delete implements ICouponRepo. Redemptions are kept for reporting.
+func (cr *couponRepo) Delete(coupon *Coupon) error {
+	if err := cr.db.Delete(coupon).Error; err != nil {
+		utils.Error("unable to delete coupon ", err)
+		return err
+	}
+	return nil
+}
+
+// redeemCouponWithTx records the use of the coupon by a checkout. The global
+// limit is enforced by the conditional increment, whose row lock also
+// serialises the per-customer count for the coupon.
+func redeemCouponWithTx(tx *gorm.DB, coupon *Coupon, accountUUID string, checkoutID uint, amount int) error {
+	result := tx.Model(&Coupon{}).
+		Where("id = ? AND (max_uses IS NULL OR used_count < max_uses)", coupon.ID).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCouponUsedUp
+	}
+
+	if coupon.MaxUsesPerCustomer != nil {
+		var used int64
+		err := tx.Model(&CouponRedemption{}).
+			Where("coupon_id = ? AND account_uuid = ?", coupon.ID, accountUUID).
+			Count(&used).Error
+		if err != nil {
+			return err
+		}
+		if used >= int64(*coupon.MaxUsesPerCustomer) {
+			return ErrCouponCustomerLimit
+		}
+	}
+
+	return tx.Create(&CouponRedemption{
+		CouponID:    coupon.ID,
+		AccountUUID: accountUUID,
+		CheckoutID:  checkoutID,
+		Amount:      amount,
+	}).Error
+}
+
+// releaseCouponWithTx gives back the coupon use of a failed checkout
+func releaseCouponWithTx(tx *gorm.DB, checkoutID uint) error {
+	var redemptions []CouponRedemption
+	err := tx.Clauses(clause.Returning{}).
+		Where("checkout_id = ?", checkoutID).
+		Delete(&redemptions).Error
+	if err != nil {
+		return err
+	}
+
+	for _, redemption := range redemptions {
+		err := tx.Model(&Coupon{}).
+			Where("id = ? AND used_count > 0", redemption.CouponID).
+			Update("used_count", gorm.Expr("used_count - 1")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeCouponCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "SAVE10", want: "SAVE10"},
+		{code: "save10", want: "SAVE10"},
+		{code: "  Save10\t", want: "SAVE10"},
+		{code: "   ", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeCouponCode(tt.code); got != tt.want {
+			t.Errorf("NormalizeCouponCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCouponIsRedeemable(t *testing.T) {
+	var (
+		now      = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		before   = now.Add(-time.Hour)
+		after    = now.Add(time.Hour)
+		active   = true
+		inactive = false
+		uses     = uint(3)
+	)
+
+	tests := []struct {
+		name   string
+		coupon Coupon
+		want   bool
+	}{
+		{name: "no limits", coupon: Coupon{}, want: true},
+		{name: "active", coupon: Coupon{IsActive: &active}, want: true},
+		{name: "inactive", coupon: Coupon{IsActive: &inactive}, want: false},
+		{name: "started", coupon: Coupon{StartsAt: &before}, want: true},
+		{name: "starts now", coupon: Coupon{StartsAt: &now}, want: true},
+		{name: "not started", coupon: Coupon{StartsAt: &after}, want: false},
+		{name: "not expired", coupon: Coupon{ExpiresAt: &after}, want: true},
+		{name: "expires now", coupon: Coupon{ExpiresAt: &now}, want: false},
+		{name: "expired", coupon: Coupon{ExpiresAt: &before}, want: false},
+		{name: "uses left", coupon: Coupon{MaxUses: &uses, UsedCount: 2}, want: true},
+		{name: "used up", coupon: Coupon{MaxUses: &uses, UsedCount: 3}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.coupon.IsRedeemable(now); got != tt.want {
+				t.Fatalf("IsRedeemable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCouponDiscount(t *testing.T) {
+	tests := []struct {
+		name     string
+		coupon   Coupon
+		subtotal uint
+		want     uint
+	}{
+		{name: "percentage", coupon: Coupon{Kind: CouponKindPercentage, Value: 10}, subtotal: 2500, want: 250},
+		{name: "percentage rounds down", coupon: Coupon{Kind: CouponKindPercentage, Value: 15}, subtotal: 999, want: 149},
+		{name: "percentage capped at 100", coupon: Coupon{Kind: CouponKindPercentage, Value: 150}, subtotal: 2500, want: 2500},
+		{name: "percentage of a large subtotal", coupon: Coupon{Kind: CouponKindPercentage, Value: 50}, subtotal: 1 << 40, want: 1 << 39},
+		{name: "fixed", coupon: Coupon{Kind: CouponKindFixed, Value: 500}, subtotal: 2500, want: 500},
+		{name: "fixed above the subtotal", coupon: Coupon{Kind: CouponKindFixed, Value: 5000}, subtotal: 2500, want: 2500},
+		{name: "empty subtotal", coupon: Coupon{Kind: CouponKindFixed, Value: 500}, subtotal: 0, want: 0},
+		{name: "unknown kind", coupon: Coupon{Kind: "BOGO", Value: 500}, subtotal: 2500, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.coupon.Discount(tt.subtotal); got != tt.want {
+				t.Fatalf("Discount(%d) = %d, want %d", tt.subtotal, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKey records a request made with an Idempotency-Key header and,
+// once it finished, its response. StatusCode is zero while it is in progress.
+type IdempotencyKey struct {
+	ID           uint   `gorm:"primaryKey"`
+	AccountUUID  string `gorm:"not null;uniqueIndex:idx_idempotency_keys_account_key"`
+	Key          string `gorm:"not null;uniqueIndex:idx_idempotency_keys_account_key"`
+	RequestHash  string `gorm:"not null"`
+	StatusCode   int    `gorm:"not null;default:0"`
+	ContentType  string
+	ResponseBody []byte
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type idempotencyKeyRepo struct {
+	db *gorm.DB
+}
+
+// Claim implements IIdempotencyKeyRepo. It records key as in progress and
+// returns it with true, or returns the earlier record of the same key with
+// false. An expired earlier record is replaced.
+func (ir *idempotencyKeyRepo) Claim(key *IdempotencyKey) (*IdempotencyKey, bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := ir.db.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if result.Error != nil {
+			utils.Error("unable to claim idempotency key ", result.Error)
+			return nil, false, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return key, true, nil
+		}
+
+		var existing IdempotencyKey
+		err := ir.db.Where("account_uuid = ? AND key = ?", key.AccountUUID, key.Key).Take(&existing).Error
+		if err != nil {
+			utils.Error("unable to get idempotency key ", err)
+			return nil, false, err
+		}
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, false, nil
+		}
+		if err := ir.db.Where("id = ? AND expires_at = ?", existing.ID, existing.ExpiresAt).Delete(&IdempotencyKey{}).Error; err != nil {
+			utils.Error("unable to delete expired idempotency key ", err)
+			return nil, false, err
+		}
+	}
+	return nil, false, gorm.ErrDuplicatedKey
+}
+
+// Complete implements IIdempotencyKeyRepo, storing the response of the request.
+func (ir *idempotencyKeyRepo) Complete(key *IdempotencyKey) error {
+	err := ir.db.Model(&IdempotencyKey{}).
+		Where("id = ?", key.ID).
+		Updates(map[string]interface{}{
+			"status_code":   key.StatusCode,
+			"content_type":  key.ContentType,
+			"response_body": key.ResponseBody,
+		}).Error
+	if err != nil {
+		utils.Error("unable to complete idempotency key ", err)
+		return err
+	}
+	return nil
+}
+
+// Release implements IIdempotencyKeyRepo, forgetting a request that failed so it can be retried.
+func (ir *idempotencyKeyRepo) Release(key *IdempotencyKey) error {
+	if err := ir.db.Delete(&IdempotencyKey{}, key.ID).Error; err != nil {
+		utils.Error("unable to release idempotency key ", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired implements IIdempotencyKeyRepo.
+func (ir *idempotencyKeyRepo) DeleteExpired(now time.Time) (int64, error) {
+	result := ir.db.Where("expires_at < ?", now).Delete(&IdempotencyKey{})
+	if result.Error != nil {
+		utils.Error("unable to delete expired idempotency keys ", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
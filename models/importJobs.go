@@ -0,0 +1,191 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type ImportJobStatus string
+
+const (
+	ImportJobStatusPending    ImportJobStatus = "PENDING"
+	ImportJobStatusProcessing ImportJobStatus = "PROCESSING"
+	ImportJobStatusCompleted  ImportJobStatus = "COMPLETED"
+	ImportJobStatusFailed     ImportJobStatus = "FAILED"
+)
+
+type ImportMode string
+
+const (
+	// ImportModeCreate inserts every row as a new product
+	ImportModeCreate ImportMode = "create"
+	// ImportModeUpsert updates the product matching the row, or creates it when there is none
+	ImportModeUpsert ImportMode = "upsert"
+)
+
+func (m ImportMode) IsValid() bool {
+	return m == ImportModeCreate || m == ImportModeUpsert
+}
+
+type ImportMatchBy string
+
+const (
+	ImportMatchBySKU  ImportMatchBy = "sku"
+	ImportMatchByUUID ImportMatchBy = "uuid"
+)
+
+func (m ImportMatchBy) IsValid() bool {
+	return m == ImportMatchBySKU || m == ImportMatchByUUID
+}
+
+// ImportJob tracks a bulk product upload processed in the background
+type ImportJob struct {
+	gorm.Model
+	UUID       string          `gorm:"unique" json:"job_id"`
+	MerchantID string          `json:"merchant_id" gorm:"index"`
+	FileName   string          `json:"file_name"`
+	FileKey    string          `json:"-"`
+	Format     string          `json:"format"`
+	Sheet      string          `json:"sheet,omitempty"`
+	Mode       ImportMode      `json:"mode" gorm:"default:create"`
+	MatchBy    ImportMatchBy   `json:"match_by" gorm:"default:sku"`
+	DryRun     bool            `json:"dry_run"`
+	Status     ImportJobStatus `json:"status" gorm:"index"`
+	// TotalRows counts the rows read so far, as the file is streamed
+	TotalRows     int        `json:"total_rows"`
+	ProcessedRows int        `json:"processed_rows"`
+	SucceededRows int        `json:"succeeded_rows"`
+	CreatedRows   int        `json:"created_rows"`
+	UpdatedRows   int        `json:"updated_rows"`
+	FailedRows    int        `json:"failed_rows"`
+	Error         string     `json:"error,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportJobError is a row of an import job that could not be imported
+type ImportJobError struct {
+	ID        uint              `json:"-" gorm:"primaryKey"`
+	JobID     uint              `json:"-" gorm:"index"`
+	RowNumber int               `json:"row"`
+	Record    datatypes.JSONMap `json:"record" gorm:"type:jsonb"`
+}
+
+type importJobRepo struct {
+	db *gorm.DB
+}
+
+func (ij *ImportJob) BeforeCreate(tx *gorm.DB) error {
+	if ij.UUID == "" {
+		jobUUID, err := utils.GenerateNanoID(12, "imp_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		ij.UUID = jobUUID
+	}
+	return nil
+}
+
+// Create implements IImportJobRepo.
+func (ijr *importJobRepo) Create(job *ImportJob) error {
+	err := ijr.db.Model(&ImportJob{}).Create(job).Error
+	if err != nil {
+		utils.Error("unable to create import job ", err)
+		return err
+	}
+	return nil
+}
+
+// Get implements IImportJobRepo.
+func (ijr *importJobRepo) Get(where *ImportJob) (*ImportJob, error) {
+	var (
+		job = ImportJob{}
+	)
+
+	err := ijr.db.Model(&ImportJob{}).Where(where).Last(&job).Error
+	if err != nil {
+		utils.Error("unable to get import job ", err)
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetUnfinished implements IImportJobRepo, returning jobs interrupted by a restart.
+func (ijr *importJobRepo) GetUnfinished() ([]ImportJob, error) {
+	var (
+		jobs []ImportJob
+	)
+
+	err := ijr.db.Model(&ImportJob{}).
+		Where("status IN ?", []ImportJobStatus{ImportJobStatusPending, ImportJobStatusProcessing}).
+		Order("id").
+		Find(&jobs).Error
+	if err != nil {
+		utils.Error("unable to get unfinished import jobs ", err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Update implements IImportJobRepo.
+func (ijr *importJobRepo) Update(job *ImportJob, values map[string]interface{}) error {
+	err := ijr.db.Model(&ImportJob{}).Where("id = ?", job.ID).Updates(values).Error
+	if err != nil {
+		utils.Error("unable to update import job ", err)
+		return err
+	}
+	return nil
+}
+
+// Claim implements IImportJobRepo, moving a pending job to processing. It
+// reports false when the job is no longer pending (e.g. another worker took it).
+func (ijr *importJobRepo) Claim(job *ImportJob) (bool, error) {
+	now := time.Now()
+	result := ijr.db.Model(&ImportJob{}).
+		Where("id = ? AND status = ?", job.ID, ImportJobStatusPending).
+		Updates(map[string]interface{}{
+			"status":     ImportJobStatusProcessing,
+			"started_at": now,
+		})
+	if result.Error != nil {
+		utils.Error("unable to claim import job ", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// AddErrors implements IImportJobRepo.
+func (ijr *importJobRepo) AddErrors(errs []*ImportJobError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	err := ijr.db.Model(&ImportJobError{}).CreateInBatches(errs, 100).Error
+	if err != nil {
+		utils.Error("unable to create import job errors ", err)
+		return err
+	}
+	return nil
+}
+
+// GetErrors implements IImportJobRepo. A limit of 0 returns every error.
+func (ijr *importJobRepo) GetErrors(jobID uint, limit int) ([]ImportJobError, error) {
+	var (
+		errs = []ImportJobError{}
+	)
+
+	query := ijr.db.Model(&ImportJobError{}).Where("job_id = ?", jobID).Order("row_number, id")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if err := query.Find(&errs).Error; err != nil {
+		utils.Error("unable to get import job errors ", err)
+		return nil, err
+	}
+	return errs, nil
+}
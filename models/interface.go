@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -90,6 +92,124 @@ type IProductRepo interface {
 	Get(where *Product) (*Product, error)
 	GetWithTx(tx *gorm.DB, where *Product) (*Product, error)
 	CreateInBatches(products []*Product, batchSize int, merchantID string) error
+	GetByMerchantKeys(merchantID string, column string, keys []string) ([]Product, error)
+	UpdateColumns(id uint, p *Product, columns []string) error
+	UpdateColumnsWithTx(tx *gorm.DB, id uint, p *Product, columns []string) error
+	FindByMerchantInBatches(merchantID string, batchSize int, fn func(products []Product) error) error
+	SpecificationKeys(merchantID string) ([]string, error)
+	List(filter *ProductListFilter) ([]Product, *ProductCursor, error)
+	Count(filter *ProductListFilter) (int64, error)
+	Facets(filter *ProductListFilter) ([]SpecificationFacet, error)
+	UpdateStatus(id uint, values map[string]interface{}) error
+	GetPendingReview(limit, offset int) ([]Product, int64, error)
+	FindBySlug(slug string) (*Product, error)
+	UpdateSlugWithTx(tx *gorm.DB, p *Product, slug string) error
+	CountLive(now time.Time) (int64, error)
+	FindLiveInBatches(offset, limit, batchSize int, fn func(products []Product) error) error
+	FindFeedInBatches(batchSize int, fn func(products []Product) error) error
+}
+
+type IProductImageRepo interface {
+	Create(images []*ProductImage) error
+	CreateWithTx(tx *gorm.DB, images []*ProductImage) error
+	GetAll(productID uint) ([]ProductImage, error)
+	Get(where *ProductImage) (*ProductImage, error)
+	Append(productID uint, images []*ProductImage, maxImages int) error
+	FirstURLs(productIDs []uint) (map[uint]string, error)
+	UpdatePositionsWithTx(tx *gorm.DB, productID uint, orderedIDs []uint) error
+	Delete(where *ProductImage) error
+}
+
+type IImportJobRepo interface {
+	Create(job *ImportJob) error
+	Get(where *ImportJob) (*ImportJob, error)
+	GetUnfinished() ([]ImportJob, error)
+	Update(job *ImportJob, values map[string]interface{}) error
+	Claim(job *ImportJob) (bool, error)
+	AddErrors(errs []*ImportJobError) error
+	GetErrors(jobID uint, limit int) ([]ImportJobError, error)
+}
+
+type IProductReviewRepo interface {
+	Create(review *ProductReview) error
+	Get(where *ProductReview) (*ProductReview, error)
+	List(productID uint, sort ReviewSort, limit, offset int) ([]ProductReview, int64, error)
+	Update(review *ProductReview, values map[string]interface{}) error
+	Delete(review *ProductReview) error
+	HasPurchased(accountUUID string, productID uint) (bool, error)
+	Vote(review *ProductReview, accountUUID string, helpful bool) (uint, error)
+}
+
+type IProductQuestionRepo interface {
+	CreateQuestion(question *ProductQuestion) error
+	GetQuestion(where *ProductQuestion) (*ProductQuestion, error)
+	ListQuestions(productID uint, answeredOnly bool, limit, offset int) ([]ProductQuestion, int64, error)
+	TopAnswered(productID uint, limit int) ([]ProductQuestion, error)
+	CreateAnswer(answer *ProductAnswer) error
+	GetAnswer(where *ProductAnswer) (*ProductAnswer, error)
+	Upvote(answer *ProductAnswer, accountUUID string, upvote bool) (uint, error)
+}
+
+type IPriceHistoryRepo interface {
+	RecordWithTx(tx *gorm.DB, productID uint, oldPrice *uint, price uint, source PriceChangeSource, scheduleID *uint) error
+	List(productID uint, since time.Time) ([]ProductPriceHistory, error)
+	LowestSince(productID uint, since time.Time) (uint, error)
+	CreateSchedule(schedule *PriceSchedule) error
+	GetSchedule(where *PriceSchedule) (*PriceSchedule, error)
+	ListSchedules(productID uint) ([]PriceSchedule, error)
+	HasOverlappingSchedule(productID uint, startsAt time.Time, endsAt *time.Time) (bool, error)
+	UpdateSchedule(schedule *PriceSchedule, values map[string]interface{}) error
+	DueSchedules(now time.Time) ([]PriceSchedule, error)
+	ApplySchedule(schedule *PriceSchedule, now time.Time) (bool, error)
+}
+
+type ICategorySchemaRepo interface {
+	Get(category string) (*CategorySchema, error)
+	Find(category string) (*CategorySchema, error)
+	GetAll() ([]CategorySchema, error)
+	Upsert(schema *CategorySchema) error
+	Delete(category string) error
+}
+
+type ICartRepo interface {
+	GetOrCreate(accountUUID string) (*Cart, error)
+	CreateGuest() (*Cart, string, error)
+	GetByToken(token string) (*Cart, error)
+	MergeGuest(guest *Cart, accountUUID string) error
+	GetItems(cartID uint) ([]CartItem, error)
+	AddItem(cartID, productID, quantity, price uint) error
+	UpdateItem(item *CartItem) error
+	RemoveItem(cartID, productID uint) (bool, error)
+	RemoveCheckedOutWithTx(tx *gorm.DB, accountUUID string, checkoutID uint) error
+}
+
+type IProductRecommendationRepo interface {
+	Refresh(perProduct int) error
+	List(productID uint, kind RecommendationKind, limit int) ([]Product, error)
+}
+
+type IWishlistRepo interface {
+	Create(wishlist *Wishlist) error
+	Get(where *Wishlist) (*Wishlist, error)
+	List(accountUUID string) ([]Wishlist, error)
+	GetSavedForLater(accountUUID string) (*Wishlist, error)
+	Delete(wishlist *Wishlist) error
+	GetItems(wishlistID uint) ([]WishlistItem, error)
+	AddItem(wishlistID uint, product *Product, price uint) error
+	RemoveItem(wishlistID, productID uint) (bool, error)
+	Share(wishlist *Wishlist) error
+	Unshare(wishlist *Wishlist) error
+	PendingAlerts(limit int) ([]WishlistAlert, error)
+	ClaimAlert(alert *WishlistAlert) (bool, error)
+	SyncSeen() error
+}
+
+type ICategoryRepo interface {
+	EnsureWithTx(tx *gorm.DB, name string) error
+	GetByName(name string) (*Category, error)
+	FindBySlug(slug string) (*Category, error)
+	Update(category *Category, slug, metaTitle, metaDescription string) error
+	ListWithLiveProducts(now time.Time) ([]CategorySitemapEntry, error)
 }
 
 type ICheckoutRepo interface {
@@ -98,6 +218,55 @@ type ICheckoutRepo interface {
 	GetByID(checkoutId string) (*Checkout, error)
 	Get(where *Checkout) (*Checkout, error)
 	GetWithTx(tx *gorm.DB, where *Checkout) (*Checkout, error)
+	CreateReservedWithTx(tx *gorm.DB, c *Checkout, coupon *Coupon) error
+	CompleteWithTx(tx *gorm.DB, c *Checkout) (bool, error)
+	ListExpired(now time.Time, limit int) ([]Checkout, error)
+	SetPaymentIntent(c *Checkout, provider, intentID string) error
+	Fail(c *Checkout) (bool, error)
+	ReservedQuantities(userID string) (map[uint]uint, error)
+}
+
+type IMerchantOrderRepo interface {
+	CreateForOrderWithTx(tx *gorm.DB, order *Order, checkout *Checkout) ([]MerchantOrder, error)
+	Get(where *MerchantOrder) (*MerchantOrder, error)
+	ListByMerchant(merchantID string, status MerchantOrderStatus, limit, offset int) ([]MerchantOrder, int64, error)
+	UpdateStatus(merchantOrder *MerchantOrder, status MerchantOrderStatus) (bool, error)
+}
+
+type IPaymentEventRepo interface {
+	Create(event *PaymentEvent) (bool, error)
+	Get(where *PaymentEvent) (*PaymentEvent, error)
+	List(status PaymentEventStatus, limit, offset int) ([]PaymentEvent, int64, error)
+	GetUnfinished() ([]PaymentEvent, error)
+	Claim(event *PaymentEvent) (bool, error)
+	Finish(event *PaymentEvent, status PaymentEventStatus, lastError string) error
+	Requeue(event *PaymentEvent, interrupted bool) (bool, error)
+}
+
+type IOfferRepo interface {
+	Create(offer *Offer) error
+	GetForMerchant(offerUUID, merchantID string) (*Offer, error)
+	ListByMerchant(merchantID string, limit, offset int) ([]Offer, int64, error)
+	ListActive(now time.Time, limit, offset int) ([]Offer, int64, error)
+	Update(offer *Offer, columns []string) error
+	Delete(offer *Offer) error
+	ActiveDiscounts(productIDs []uint, now time.Time) (map[uint]float64, error)
+}
+
+type ICouponRepo interface {
+	Create(coupon *Coupon) error
+	Get(where *Coupon) (*Coupon, error)
+	GetByCode(code string) (*Coupon, error)
+	List(merchantID string, limit, offset int) ([]Coupon, int64, error)
+	Update(coupon *Coupon, columns []string) error
+	Delete(coupon *Coupon) error
+}
+
+type IIdempotencyKeyRepo interface {
+	Claim(key *IdempotencyKey) (*IdempotencyKey, bool, error)
+	Complete(key *IdempotencyKey) error
+	Release(key *IdempotencyKey) error
+	DeleteExpired(now time.Time) (int64, error)
 }
 
 type IOrderRepo interface {
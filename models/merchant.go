@@ -4,6 +4,7 @@ import (
 	"ecom/backend/utils"
 	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -43,7 +44,11 @@ type Merchant struct {
 
 	ApplicationCurrentStatus MerchantOnboardingState `json:"application_current_status" gorm:"AUDITABLE"`
 	IsBlocked                *bool                   `json:"is_blocked,omitempty" gorm:"default:false"`
+	FeedOptOut               *bool                   `json:"feed_opt_out,omitempty" gorm:"default:false"`
 	Account                  Account                 `json:"account,omitempty" gorm:"foreignKey:AccountUUID;references:AccountId"`
+
+	// LogoStorageKeys are the blobs of the logo, removed when it is replaced
+	LogoStorageKeys datatypes.JSONSlice[string] `json:"-" gorm:"type:jsonb"`
 }
 
 type merchantRepo struct {
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MerchantOrderStatus string
+
+const (
+	MerchantOrderStatusPlaced    MerchantOrderStatus = "PLACED"
+	MerchantOrderStatusShipped   MerchantOrderStatus = "SHIPPED"
+	MerchantOrderStatusDelivered MerchantOrderStatus = "DELIVERED"
+	MerchantOrderStatusCancelled MerchantOrderStatus = "CANCELLED"
+)
+
+var ErrInvalidMerchantOrderTransition = errors.New("invalid merchant order status transition")
+
+// merchantOrderTransitions lists the statuses a merchant can move their part of an order to
+var merchantOrderTransitions = map[MerchantOrderStatus][]MerchantOrderStatus{
+	MerchantOrderStatusPlaced:  {MerchantOrderStatusShipped, MerchantOrderStatusCancelled},
+	MerchantOrderStatusShipped: {MerchantOrderStatusDelivered},
+}
+
+// CanTransition reports whether a merchant order can move from s to to
+func (s MerchantOrderStatus) CanTransition(to MerchantOrderStatus) bool {
+	for _, allowed := range merchantOrderTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// MerchantOrder is the part of an order one merchant fulfils and gets paid
+// for. Its items are the checkout items of the merchant's products.
+type MerchantOrder struct {
+	ID            uint                `json:"-" gorm:"primaryKey"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt      `json:"-" gorm:"index"`
+	UUID          string              `gorm:"unique" json:"uuid"`
+	OrderID       uint                `json:"-" gorm:"index"`
+	MerchantID    string              `json:"merchant_id" gorm:"index"`
+	Status        MerchantOrderStatus `json:"status" gorm:"index;default:PLACED"`
+	ItemCount     uint                `json:"item_count"`
+	TotalAmount   int                 `json:"total_amount"`
+	BankAccountID string              `json:"-"`
+	Items         []CheckoutItem      `json:"items,omitempty" gorm:"foreignKey:MerchantOrderID"`
+	// DiscountAmount is the part of the merchant's coupon discount taken off TotalAmount
+	DiscountAmount int `json:"discount_amount"`
+}
+
+type merchantOrderRepo struct {
+	db *gorm.DB
+}
+
+func (mo *MerchantOrder) BeforeCreate(tx *gorm.DB) error {
+	if mo.UUID == "" {
+		merchantOrderUUID, err := utils.GenerateNanoID(12, "mord_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		mo.UUID = merchantOrderUUID
+	}
+	return nil
+}
+
+// merchantItemRow is a checkout item with the merchant of its product
+type merchantItemRow struct {
+	ID         uint
+	Quantity   uint
+	TotalPrice int
+	MerchantID string
+	WalletID   string
+}
+
+// splitByMerchant groups rows, ordered by merchant, into one merchant order
+// per merchant along with the ids of its items. The checkout's discount comes
+// off the total of the merchant whose coupon it was.
+func splitByMerchant(rows []merchantItemRow, order *Order, checkout *Checkout) ([]MerchantOrder, [][]uint) {
+	var (
+		merchantOrders []MerchantOrder
+		itemIDs        [][]uint
+	)
+	for _, row := range rows {
+		last := len(merchantOrders) - 1
+		if last < 0 || merchantOrders[last].MerchantID != row.MerchantID {
+			merchantOrders = append(merchantOrders, MerchantOrder{
+				OrderID:       order.ID,
+				MerchantID:    row.MerchantID,
+				Status:        MerchantOrderStatusPlaced,
+				BankAccountID: row.WalletID,
+			})
+			itemIDs = append(itemIDs, nil)
+			last++
+		}
+		merchantOrders[last].ItemCount += row.Quantity
+		merchantOrders[last].TotalAmount += row.TotalPrice
+		itemIDs[last] = append(itemIDs[last], row.ID)
+	}
+	for i := range merchantOrders {
+		if checkout.DiscountMerchantID != "" && merchantOrders[i].MerchantID == checkout.DiscountMerchantID {
+			merchantOrders[i].DiscountAmount = checkout.DiscountAmount
+			merchantOrders[i].TotalAmount -= checkout.DiscountAmount
+		}
+	}
+	return merchantOrders, itemIDs
+}
+
+// CreateForOrderWithTx implements IMerchantOrderRepo, splitting the items of
+// the order's checkout by the merchant of their product into one merchant
+// order each. Payouts go to the merchant's wallet. A merchant's coupon
+// discount comes off their own total; platform discounts do not.
+func (mr *merchantOrderRepo) CreateForOrderWithTx(tx *gorm.DB, order *Order, checkout *Checkout) ([]MerchantOrder, error) {
+	var rows []merchantItemRow
+
+	// Products deleted since the checkout still belong to their merchant
+	err := tx.Table("checkout_items").
+		Select("checkout_items.id, checkout_items.quantity, checkout_items.total_price, products.merchant_id, merchants.wallet_id").
+		Joins("JOIN products ON products.id = checkout_items.product_id").
+		Joins("LEFT JOIN merchants ON merchants.uuid = products.merchant_id").
+		Where("checkout_items.checkout_id = ?", checkout.ID).
+		Order("products.merchant_id, checkout_items.id").
+		Scan(&rows).Error
+	if err != nil {
+		utils.Error("unable to get checkout items by merchant ", err)
+		return nil, err
+	}
+
+	merchantOrders, itemIDs := splitByMerchant(rows, order, checkout)
+	if len(merchantOrders) == 0 {
+		return merchantOrders, nil
+	}
+
+	if err := tx.Create(&merchantOrders).Error; err != nil {
+		utils.Error("unable to create merchant orders ", err)
+		return nil, err
+	}
+	for i := range merchantOrders {
+		err := tx.Model(&CheckoutItem{}).
+			Where("id IN ?", itemIDs[i]).
+			Update("merchant_order_id", merchantOrders[i].ID).Error
+		if err != nil {
+			utils.Error("unable to assign checkout items to merchant order ", err)
+			return nil, err
+		}
+	}
+	return merchantOrders, nil
+}
+
+// Get implements IMerchantOrderRepo, with the items loaded.
+func (mr *merchantOrderRepo) Get(where *MerchantOrder) (*MerchantOrder, error) {
+	var merchantOrder MerchantOrder
+	err := mr.db.Model(&MerchantOrder{}).
+		Where(where).
+		Preload("Items").
+		Last(&merchantOrder).Error
+	if err != nil {
+		utils.Error("unable to get merchant order ", err)
+		return nil, err
+	}
+	return &merchantOrder, nil
+}
+
+// ListByMerchant implements IMerchantOrderRepo, newest first with the items
+// loaded, optionally of one status.
+func (mr *merchantOrderRepo) ListByMerchant(merchantID string, status MerchantOrderStatus, limit, offset int) ([]MerchantOrder, int64, error) {
+	var (
+		merchantOrders = []MerchantOrder{}
+		total          int64
+	)
+
+	query := mr.db.Model(&MerchantOrder{}).Where("merchant_id = ?", merchantID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count merchant orders ", err)
+		return nil, 0, err
+	}
+	err := query.Preload("Items").Order("id DESC").Limit(limit).Offset(offset).Find(&merchantOrders).Error
+	if err != nil {
+		utils.Error("unable to list merchant orders ", err)
+		return nil, 0, err
+	}
+	return merchantOrders, total, nil
+}
+
+// UpdateStatus implements IMerchantOrderRepo, moving the merchant order to
+// status if it is still in the status it was read with. It reports false when
+// the status changed in the meantime.
+func (mr *merchantOrderRepo) UpdateStatus(merchantOrder *MerchantOrder, status MerchantOrderStatus) (bool, error) {
+	result := mr.db.Model(&MerchantOrder{}).
+		Where("id = ? AND status = ?", merchantOrder.ID, merchantOrder.Status).
+		Update("status", status)
+	if result.Error != nil {
+		utils.Error("unable to update merchant order status ", result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		merchantOrder.Status = status
+	}
+	return result.RowsAffected == 1, nil
+}
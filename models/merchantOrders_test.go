@@ -0,0 +1,138 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitByMerchant(t *testing.T) {
+	var (
+		order = &Order{ID: 7}
+		rows  = []merchantItemRow{
+			{ID: 1, Quantity: 2, TotalPrice: 2000, MerchantID: "mer_a", WalletID: "wal_a"},
+			{ID: 3, Quantity: 1, TotalPrice: 500, MerchantID: "mer_a", WalletID: "wal_a"},
+			{ID: 2, Quantity: 4, TotalPrice: 4000, MerchantID: "mer_b", WalletID: "wal_b"},
+		}
+	)
+
+	merchantOrder := func(merchantID, walletID string, itemCount uint, total, discount int) MerchantOrder {
+		return MerchantOrder{
+			OrderID:        order.ID,
+			MerchantID:     merchantID,
+			Status:         MerchantOrderStatusPlaced,
+			ItemCount:      itemCount,
+			TotalAmount:    total,
+			BankAccountID:  walletID,
+			DiscountAmount: discount,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		rows        []merchantItemRow
+		checkout    *Checkout
+		wantOrders  []MerchantOrder
+		wantItemIDs [][]uint
+	}{
+		{
+			name:     "no items",
+			checkout: &Checkout{},
+		},
+		{
+			name:     "one merchant",
+			rows:     rows[:2],
+			checkout: &Checkout{},
+			wantOrders: []MerchantOrder{
+				merchantOrder("mer_a", "wal_a", 3, 2500, 0),
+			},
+			wantItemIDs: [][]uint{{1, 3}},
+		},
+		{
+			name:     "one order per merchant",
+			rows:     rows,
+			checkout: &Checkout{},
+			wantOrders: []MerchantOrder{
+				merchantOrder("mer_a", "wal_a", 3, 2500, 0),
+				merchantOrder("mer_b", "wal_b", 4, 4000, 0),
+			},
+			wantItemIDs: [][]uint{{1, 3}, {2}},
+		},
+		{
+			name:     "merchant discount comes off its own total",
+			rows:     rows,
+			checkout: &Checkout{DiscountAmount: 300, DiscountMerchantID: "mer_b"},
+			wantOrders: []MerchantOrder{
+				merchantOrder("mer_a", "wal_a", 3, 2500, 0),
+				merchantOrder("mer_b", "wal_b", 4, 3700, 300),
+			},
+			wantItemIDs: [][]uint{{1, 3}, {2}},
+		},
+		{
+			name:     "platform discount is not attributed",
+			rows:     rows,
+			checkout: &Checkout{DiscountAmount: 300},
+			wantOrders: []MerchantOrder{
+				merchantOrder("mer_a", "wal_a", 3, 2500, 0),
+				merchantOrder("mer_b", "wal_b", 4, 4000, 0),
+			},
+			wantItemIDs: [][]uint{{1, 3}, {2}},
+		},
+		{
+			name:     "discount of a merchant without items",
+			rows:     rows[:2],
+			checkout: &Checkout{DiscountAmount: 300, DiscountMerchantID: "mer_c"},
+			wantOrders: []MerchantOrder{
+				merchantOrder("mer_a", "wal_a", 3, 2500, 0),
+			},
+			wantItemIDs: [][]uint{{1, 3}},
+		},
+		{
+			name: "merchant without a wallet",
+			rows: []merchantItemRow{
+				{ID: 5, Quantity: 1, TotalPrice: 100, MerchantID: "mer_a"},
+			},
+			checkout: &Checkout{},
+			wantOrders: []MerchantOrder{
+				merchantOrder("mer_a", "", 1, 100, 0),
+			},
+			wantItemIDs: [][]uint{{5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOrders, gotItemIDs := splitByMerchant(tt.rows, order, tt.checkout)
+			if !reflect.DeepEqual(gotOrders, tt.wantOrders) {
+				t.Errorf("splitByMerchant() orders = %+v, want %+v", gotOrders, tt.wantOrders)
+			}
+			if !reflect.DeepEqual(gotItemIDs, tt.wantItemIDs) {
+				t.Errorf("splitByMerchant() item ids = %v, want %v", gotItemIDs, tt.wantItemIDs)
+			}
+		})
+	}
+}
+
+func TestMerchantOrderStatusCanTransition(t *testing.T) {
+	tests := []struct {
+		from MerchantOrderStatus
+		to   MerchantOrderStatus
+		want bool
+	}{
+		{MerchantOrderStatusPlaced, MerchantOrderStatusShipped, true},
+		{MerchantOrderStatusPlaced, MerchantOrderStatusCancelled, true},
+		{MerchantOrderStatusPlaced, MerchantOrderStatusDelivered, false},
+		{MerchantOrderStatusShipped, MerchantOrderStatusDelivered, true},
+		{MerchantOrderStatusShipped, MerchantOrderStatusCancelled, false},
+		{MerchantOrderStatusDelivered, MerchantOrderStatusPlaced, false},
+		{MerchantOrderStatusCancelled, MerchantOrderStatusPlaced, false},
+		{MerchantOrderStatusPlaced, MerchantOrderStatusPlaced, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransition(tt.to); got != tt.want {
+				t.Fatalf("CanTransition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
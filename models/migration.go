@@ -1,5 +1,7 @@
 package models
 
+import "gorm.io/gorm"
+
 // Add list of model add for migrations
 var migrationModels = []interface{}{
 	&Account{},
@@ -10,12 +12,46 @@ var migrationModels = []interface{}{
 	&Merchant{},
 	&OTP{},
 	&Product{},
+	&CategorySchema{},
+	&Category{},
+	&SlugRedirect{},
+	&ProductImage{},
+	&ImportJob{},
+	&ImportJobError{},
+	&ProductReview{},
+	&ReviewVote{},
+	&ProductQuestion{},
+	&ProductAnswer{},
+	&AnswerVote{},
+	&ProductPriceHistory{},
+	&PriceSchedule{},
+	&ProductRecommendation{},
 	&Offer{},
+	&Coupon{},
+	&CouponRedemption{},
+	&Cart{},
+	&CartItem{},
+	&Wishlist{},
+	&WishlistItem{},
 	&Checkout{},
 	&CheckoutItem{},
 	&Order{},
+	&MerchantOrder{},
+	&IdempotencyKey{},
+	&PaymentEvent{},
+}
+
+// dataMigrations run after the schema migration and must be safe to run on every start
+var dataMigrations = []func(db *gorm.DB) error{
+	backfillProductStatus,
+	backfillSlugs,
+	backfillCheckoutSubtotals,
 }
 
 func GetMigrationModels() []interface{} {
 	return migrationModels
 }
+
+func GetDataMigrations() []func(db *gorm.DB) error {
+	return dataMigrations
+}
@@ -1,17 +1,187 @@
 package models
 
 import (
+	"ecom/backend/utils"
+	"math"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Offer is a merchant's percentage discount on one of their products. It
+// applies while it is active and not expired.
 type Offer struct {
 	gorm.Model
 	UUID        string    `gorm:"unique" json:"uuid,omitempty"`
-	ProductID   uint      `json:"product_id" gorm:"index"`
+	ProductID   uint      `json:"-" gorm:"index"`
 	Discount    float64   `json:"discount" gorm:"not null"` // Discount percentage
 	ExpiresAt   time.Time `json:"expires_at,omitempty"`
 	Description string    `json:"description,omitempty"`
 	IsActive    bool      `json:"is_active" gorm:"default:false"`
+	Product     *Product  `json:"-" gorm:"foreignKey:ProductID"`
+}
+
+type offerRepo struct {
+	db *gorm.DB
+}
+
+func (o *Offer) BeforeCreate(tx *gorm.DB) error {
+	if o.UUID == "" {
+		offerUUID, err := utils.GenerateNanoID(12, "off_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		o.UUID = offerUUID
+	}
+	return nil
+}
+
+// DiscountedPrice returns price less a percentage discount, rounded to the
+// nearest minor unit
+func DiscountedPrice(price uint, discount float64) uint {
+	if discount <= 0 {
+		return price
+	}
+	return uint(math.Round(float64(price) * (100 - min(discount, 100)) / 100))
+}
+
+// activeOffers limits an offer query to active offers that have not expired
+func activeOffers(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("offers.is_active = ? AND offers.expires_at > ?", true, now)
+	}
+}
+
+// bestOfferJoinSQL joins the discount of the best offer applying at its
+// parameter to each product as best_offer.discount, NULL without one
+const bestOfferJoinSQL = `LEFT JOIN LATERAL (
+		SELECT MAX(offers.discount) AS discount FROM offers
+		WHERE offers.product_id = products.id AND offers.deleted_at IS NULL
+			AND offers.is_active AND offers.expires_at > ?
+	) best_offer ON true`
+
+// effectivePriceSQL is products.price after best_offer.discount, rounded like DiscountedPrice
+const effectivePriceSQL = `COALESCE(ROUND((products.price * (100 - LEAST(best_offer.discount, 100)) / 100)::numeric)::bigint, products.price)`
+
+// Create implements IOfferRepo.
+func (ofr *offerRepo) Create(offer *Offer) error {
+	if err := ofr.db.Create(offer).Error; err != nil {
+		utils.Error("unable to create offer ", err)
+		return err
+	}
+	return nil
+}
+
+// GetForMerchant implements IOfferRepo, returning the offer only if it is on
+// one of the merchant's products, with the product loaded.
+func (ofr *offerRepo) GetForMerchant(offerUUID, merchantID string) (*Offer, error) {
+	var offer Offer
+	err := ofr.db.Model(&Offer{}).
+		Joins("JOIN products ON products.id = offers.product_id").
+		Where("offers.uuid = ? AND products.merchant_id = ?", offerUUID, merchantID).
+		Preload("Product").
+		Last(&offer).Error
+	if err != nil {
+		utils.Error("unable to get offer ", err)
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// ListByMerchant implements IOfferRepo, returning the offers on the
+// merchant's products newest first, with the products loaded.
+func (ofr *offerRepo) ListByMerchant(merchantID string, limit, offset int) ([]Offer, int64, error) {
+	var (
+		offers = []Offer{}
+		total  int64
+	)
+
+	query := ofr.db.Model(&Offer{}).
+		Joins("JOIN products ON products.id = offers.product_id").
+		Where("products.merchant_id = ?", merchantID)
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count offers ", err)
+		return nil, 0, err
+	}
+	err := query.Preload("Product").Order("offers.id DESC").Limit(limit).Offset(offset).Find(&offers).Error
+	if err != nil {
+		utils.Error("unable to list offers ", err)
+		return nil, 0, err
+	}
+	return offers, total, nil
+}
+
+// ListActive implements IOfferRepo, returning the offers applying at now on
+// live products, ending soonest first, with the products loaded.
+func (ofr *offerRepo) ListActive(now time.Time, limit, offset int) ([]Offer, int64, error) {
+	var (
+		offers = []Offer{}
+		total  int64
+	)
+
+	query := ofr.db.Model(&Offer{}).
+		Joins("JOIN products ON products.id = offers.product_id AND products.deleted_at IS NULL").
+		Scopes(activeOffers(now), LiveProducts(now))
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count active offers ", err)
+		return nil, 0, err
+	}
+	err := query.Preload("Product").
+		Order("offers.expires_at, offers.id").
+		Limit(limit).Offset(offset).
+		Find(&offers).Error
+	if err != nil {
+		utils.Error("unable to list active offers ", err)
+		return nil, 0, err
+	}
+	return offers, total, nil
+}
+
+// Update implements IOfferRepo, writing the given columns of offer.
+func (ofr *offerRepo) Update(offer *Offer, columns []string) error {
+	if err := ofr.db.Model(offer).Select(columns).Updates(offer).Error; err != nil {
+		utils.Error("unable to update offer ", err)
+		return err
+	}
+	return nil
+}
+
+// Delete implements IOfferRepo.
+func (ofr *offerRepo) Delete(offer *Offer) error {
+	if err := ofr.db.Delete(offer).Error; err != nil {
+		utils.Error("unable to delete offer ", err)
+		return err
+	}
+	return nil
+}
+
+// ActiveDiscounts implements IOfferRepo, returning the largest discount of the
+// offers applying at now by product id, for the products that have one.
+func (ofr *offerRepo) ActiveDiscounts(productIDs []uint, now time.Time) (map[uint]float64, error) {
+	var rows []struct {
+		ProductID uint
+		Discount  float64
+	}
+
+	discounts := make(map[uint]float64)
+	if len(productIDs) == 0 {
+		return discounts, nil
+	}
+
+	err := ofr.db.Model(&Offer{}).
+		Select("offers.product_id, MAX(offers.discount) AS discount").
+		Where("offers.product_id IN ?", productIDs).
+		Scopes(activeOffers(now)).
+		Group("offers.product_id").
+		Scan(&rows).Error
+	if err != nil {
+		utils.Error("unable to get active offer discounts ", err)
+		return nil, err
+	}
+
+	for _, row := range rows {
+		discounts[row.ProductID] = row.Discount
+	}
+	return discounts, nil
 }
@@ -24,7 +24,8 @@ type Order struct {
 	BankAccountID     string `json:"bank_account_id"`
 	// OfferID            *int   `json:"-"`
 
-	Checkout Checkout `gorm:"foreignKey:CheckoutID;references:CheckoutID" json:"checkout,omitempty"`
+	Checkout       Checkout        `gorm:"foreignKey:CheckoutID;references:CheckoutID" json:"checkout,omitempty"`
+	MerchantOrders []MerchantOrder `gorm:"foreignKey:OrderID" json:"merchant_orders,omitempty"`
 	// User     Account  `gorm:"foreignKey:UserID;references:AccountId" json:"-"`
 	// Offer    *Offer   `gorm:"foreignKey:OfferID" json:"offer"`
 }
@@ -116,16 +117,17 @@ func (d *OrderRepo) GetCount(where *Order) (int, error) {
 
 }
 
-// GetTotalOfferAmount implements IOrderRepo.
+// GetTotalOfferAmount implements IOrderRepo, summing the coupon discounts of
+// the orders' checkouts.
 func (d *OrderRepo) GetTotalOfferAmount(where *Order) (*int64, error) {
 	var (
 		totalOfferAmountInCents *int64
 	)
 
 	err := d.db.Model(&Order{}).
-		Joins("INNER JOIN d2c_checkouts ON d2c_checkouts.id = d2c_orders.checkout_id").
+		Joins("INNER JOIN checkouts ON checkouts.checkout_id = orders.checkout_id").
 		Where(where).
-		Select("COALESCE(SUM(d2c_checkouts.offer_amount_in_cents), 0)").
+		Select("COALESCE(SUM(checkouts.discount_amount), 0)").
 		Scan(&totalOfferAmountInCents).Error
 	if err != nil {
 		utils.Error("unable to total offer amount for the user ", err)
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PaymentEventStatus string
+
+const (
+	PaymentEventStatusReceived   PaymentEventStatus = "RECEIVED"
+	PaymentEventStatusProcessing PaymentEventStatus = "PROCESSING"
+	PaymentEventStatusProcessed  PaymentEventStatus = "PROCESSED"
+	PaymentEventStatusFailed     PaymentEventStatus = "FAILED"
+)
+
+// PaymentEvent is a webhook event received from a payment provider. Each
+// provider event is stored once, so redelivered events are ignored.
+type PaymentEvent struct {
+	ID          uint               `gorm:"primaryKey" json:"id"`
+	Provider    string             `json:"provider" gorm:"not null;uniqueIndex:idx_payment_events_provider_event"`
+	EventID     string             `json:"event_id" gorm:"not null;uniqueIndex:idx_payment_events_provider_event"`
+	Type        string             `json:"type"`
+	IntentID    string             `json:"intent_id" gorm:"index"`
+	Payload     datatypes.JSON     `json:"payload"`
+	Status      PaymentEventStatus `json:"status" gorm:"index;default:RECEIVED"`
+	Attempts    int                `json:"attempts"`
+	LastError   string             `json:"last_error,omitempty"`
+	ProcessedAt *time.Time         `json:"processed_at,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+type paymentEventRepo struct {
+	db *gorm.DB
+}
+
+// Create implements IPaymentEventRepo. It reports false, leaving event
+// unsaved, when the provider's event was already received.
+func (pr *paymentEventRepo) Create(event *PaymentEvent) (bool, error) {
+	result := pr.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		utils.Error("unable to create payment event ", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Get implements IPaymentEventRepo.
+func (pr *paymentEventRepo) Get(where *PaymentEvent) (*PaymentEvent, error) {
+	var event PaymentEvent
+	if err := pr.db.Model(&PaymentEvent{}).Where(where).Last(&event).Error; err != nil {
+		utils.Error("unable to get payment event ", err)
+		return nil, err
+	}
+	return &event, nil
+}
+
+// List implements IPaymentEventRepo, newest first, optionally of one status.
+func (pr *paymentEventRepo) List(status PaymentEventStatus, limit, offset int) ([]PaymentEvent, int64, error) {
+	var (
+		events = []PaymentEvent{}
+		total  int64
+	)
+
+	query := pr.db.Model(&PaymentEvent{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count payment events ", err)
+		return nil, 0, err
+	}
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		utils.Error("unable to list payment events ", err)
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// GetUnfinished implements IPaymentEventRepo, returning events not yet
+// processed, e.g. because of a restart.
+func (pr *paymentEventRepo) GetUnfinished() ([]PaymentEvent, error) {
+	var events []PaymentEvent
+
+	err := pr.db.Model(&PaymentEvent{}).
+		Where("status IN ?", []PaymentEventStatus{PaymentEventStatusReceived, PaymentEventStatusProcessing}).
+		Order("id").
+		Find(&events).Error
+	if err != nil {
+		utils.Error("unable to get unfinished payment events ", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// Claim implements IPaymentEventRepo, moving a received event to processing.
+// It reports false when the event is not waiting to be processed.
+func (pr *paymentEventRepo) Claim(event *PaymentEvent) (bool, error) {
+	result := pr.db.Model(&PaymentEvent{}).
+		Where("id = ? AND status = ?", event.ID, PaymentEventStatusReceived).
+		Updates(map[string]interface{}{
+			"status":   PaymentEventStatusProcessing,
+			"attempts": gorm.Expr("attempts + 1"),
+		})
+	if result.Error != nil {
+		utils.Error("unable to claim payment event ", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Finish implements IPaymentEventRepo, recording the outcome of processing the event.
+func (pr *paymentEventRepo) Finish(event *PaymentEvent, status PaymentEventStatus, lastError string) error {
+	now := time.Now()
+	err := pr.db.Model(&PaymentEvent{}).
+		Where("id = ?", event.ID).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"last_error":   lastError,
+			"processed_at": now,
+		}).Error
+	if err != nil {
+		utils.Error("unable to finish payment event ", err)
+		return err
+	}
+	event.Status, event.LastError, event.ProcessedAt = status, lastError, &now
+	return nil
+}
+
+// Requeue implements IPaymentEventRepo, marking an event to be processed
+// again. It reports false while the event is being processed, and with
+// interrupted it also takes back events left processing by a restart.
+func (pr *paymentEventRepo) Requeue(event *PaymentEvent, interrupted bool) (bool, error) {
+	statuses := []PaymentEventStatus{PaymentEventStatusReceived, PaymentEventStatusProcessed, PaymentEventStatusFailed}
+	if interrupted {
+		statuses = append(statuses, PaymentEventStatusProcessing)
+	}
+
+	result := pr.db.Model(&PaymentEvent{}).
+		Where("id = ? AND status IN ?", event.ID, statuses).
+		Update("status", PaymentEventStatusReceived)
+	if result.Error != nil {
+		utils.Error("unable to requeue payment event ", result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		event.Status = PaymentEventStatusReceived
+	}
+	return result.RowsAffected == 1, nil
+}
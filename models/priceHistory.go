@@ -0,0 +1,294 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PriceChangeSource string
+
+const (
+	PriceChangeSourceInitial  PriceChangeSource = "initial"
+	PriceChangeSourceManual   PriceChangeSource = "manual"
+	PriceChangeSourceImport   PriceChangeSource = "import"
+	PriceChangeSourceSchedule PriceChangeSource = "schedule"
+)
+
+type PriceScheduleStatus string
+
+const (
+	// PriceScheduleStatusScheduled waits for StartsAt
+	PriceScheduleStatusScheduled PriceScheduleStatus = "SCHEDULED"
+	// PriceScheduleStatusActive has been applied and waits for EndsAt to restore the previous price
+	PriceScheduleStatusActive    PriceScheduleStatus = "ACTIVE"
+	PriceScheduleStatusCompleted PriceScheduleStatus = "COMPLETED"
+	PriceScheduleStatusCancelled PriceScheduleStatus = "CANCELLED"
+)
+
+// ProductPriceHistory records one change of a product's price
+type ProductPriceHistory struct {
+	ID              uint              `json:"-" gorm:"primaryKey"`
+	ProductID       uint              `json:"-" gorm:"not null;index:idx_price_history_product_changed"`
+	OldPrice        *uint             `json:"old_price,omitempty"`
+	Price           uint              `json:"price" gorm:"not null"`
+	Source          PriceChangeSource `json:"source"`
+	PriceScheduleID *uint             `json:"-"`
+	ChangedAt       time.Time         `json:"changed_at" gorm:"not null;index:idx_price_history_product_changed"`
+}
+
+// PriceSchedule is a future price change set by a merchant. Without EndsAt the
+// change is permanent; otherwise the previous price is restored at EndsAt.
+type PriceSchedule struct {
+	gorm.Model
+	UUID          string              `gorm:"unique" json:"schedule_id"`
+	ProductID     uint                `json:"-" gorm:"not null;index"`
+	Price         uint                `json:"price" gorm:"not null"`
+	StartsAt      time.Time           `json:"starts_at" gorm:"not null;index"`
+	EndsAt        *time.Time          `json:"ends_at,omitempty" gorm:"index"`
+	Status        PriceScheduleStatus `json:"status" gorm:"index"`
+	PreviousPrice *uint               `json:"previous_price,omitempty"`
+	AppliedAt     *time.Time          `json:"applied_at,omitempty"`
+	FinishedAt    *time.Time          `json:"finished_at,omitempty"`
+}
+
+type priceHistoryRepo struct {
+	db *gorm.DB
+}
+
+func (ps *PriceSchedule) BeforeCreate(tx *gorm.DB) error {
+	if ps.UUID == "" {
+		scheduleUUID, err := utils.GenerateNanoID(12, "ps_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		ps.UUID = scheduleUUID
+	}
+	return nil
+}
+
+// AfterCreate records the starting price of every new product, whichever way it was created
+func (p *Product) AfterCreate(tx *gorm.DB) error {
+	return InitPriceHistoryRepo(tx).RecordWithTx(tx, p.ID, nil, p.Price, PriceChangeSourceInitial, nil)
+}
+
+// RecordWithTx implements IPriceHistoryRepo. Nothing is recorded when the price did not change.
+func (phr *priceHistoryRepo) RecordWithTx(tx *gorm.DB, productID uint, oldPrice *uint, price uint, source PriceChangeSource, scheduleID *uint) error {
+	if oldPrice != nil && *oldPrice == price {
+		return nil
+	}
+
+	err := tx.Model(&ProductPriceHistory{}).Create(&ProductPriceHistory{
+		ProductID:       productID,
+		OldPrice:        oldPrice,
+		Price:           price,
+		Source:          source,
+		PriceScheduleID: scheduleID,
+		ChangedAt:       time.Now(),
+	}).Error
+	if err != nil {
+		utils.Error("unable to record price change ", err)
+		return err
+	}
+	return nil
+}
+
+// List implements IPriceHistoryRepo, newest first.
+func (phr *priceHistoryRepo) List(productID uint, since time.Time) ([]ProductPriceHistory, error) {
+	var (
+		history = []ProductPriceHistory{}
+	)
+
+	err := phr.db.Model(&ProductPriceHistory{}).
+		Where("product_id = ? AND changed_at >= ?", productID, since).
+		Order("changed_at DESC, id DESC").
+		Find(&history).Error
+	if err != nil {
+		utils.Error("unable to get price history ", err)
+		return nil, err
+	}
+	return history, nil
+}
+
+// LowestSince implements IPriceHistoryRepo. It returns the lowest price in effect
+// at any point since the given time: the price that applied at that moment, every
+// change after it and the current price.
+func (phr *priceHistoryRepo) LowestSince(productID uint, since time.Time) (uint, error) {
+	var (
+		lowest uint
+	)
+
+	err := phr.db.Raw(`SELECT MIN(price) FROM (
+			SELECT price FROM product_price_histories WHERE product_id = ? AND changed_at >= ?
+			UNION ALL
+			(SELECT price FROM product_price_histories WHERE product_id = ? AND changed_at < ?
+				ORDER BY changed_at DESC, id DESC LIMIT 1)
+			UNION ALL
+			SELECT price FROM products WHERE id = ?
+		) prices`, productID, since, productID, since, productID).
+		Scan(&lowest).Error
+	if err != nil {
+		utils.Error("unable to get lowest price ", err)
+		return 0, err
+	}
+	return lowest, nil
+}
+
+// CreateSchedule implements IPriceHistoryRepo.
+func (phr *priceHistoryRepo) CreateSchedule(schedule *PriceSchedule) error {
+	err := phr.db.Model(&PriceSchedule{}).Create(schedule).Error
+	if err != nil {
+		utils.Error("unable to create price schedule ", err)
+		return err
+	}
+	return nil
+}
+
+// GetSchedule implements IPriceHistoryRepo.
+func (phr *priceHistoryRepo) GetSchedule(where *PriceSchedule) (*PriceSchedule, error) {
+	var (
+		schedule = PriceSchedule{}
+	)
+
+	err := phr.db.Model(&PriceSchedule{}).Where(where).Last(&schedule).Error
+	if err != nil {
+		utils.Error("unable to get price schedule ", err)
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ListSchedules implements IPriceHistoryRepo, ordered by start time.
+func (phr *priceHistoryRepo) ListSchedules(productID uint) ([]PriceSchedule, error) {
+	var (
+		schedules = []PriceSchedule{}
+	)
+
+	err := phr.db.Model(&PriceSchedule{}).
+		Where("product_id = ?", productID).
+		Order("starts_at, id").
+		Find(&schedules).Error
+	if err != nil {
+		utils.Error("unable to list price schedules ", err)
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// HasOverlappingSchedule implements IPriceHistoryRepo. A nil end means the window never closes.
+func (phr *priceHistoryRepo) HasOverlappingSchedule(productID uint, startsAt time.Time, endsAt *time.Time) (bool, error) {
+	var (
+		count int64
+	)
+
+	query := phr.db.Model(&PriceSchedule{}).
+		Where("product_id = ? AND status IN ?", productID,
+			[]PriceScheduleStatus{PriceScheduleStatusScheduled, PriceScheduleStatusActive}).
+		Where("ends_at IS NULL OR ends_at > ?", startsAt)
+	if endsAt != nil {
+		query = query.Where("starts_at < ?", *endsAt)
+	}
+
+	if err := query.Count(&count).Error; err != nil {
+		utils.Error("unable to check price schedules ", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// UpdateSchedule implements IPriceHistoryRepo.
+func (phr *priceHistoryRepo) UpdateSchedule(schedule *PriceSchedule, values map[string]interface{}) error {
+	err := phr.db.Model(&PriceSchedule{}).Where("id = ?", schedule.ID).Updates(values).Error
+	if err != nil {
+		utils.Error("unable to update price schedule ", err)
+		return err
+	}
+	return nil
+}
+
+// DueSchedules implements IPriceHistoryRepo, returning schedules that should
+// start or end by now.
+func (phr *priceHistoryRepo) DueSchedules(now time.Time) ([]PriceSchedule, error) {
+	var (
+		schedules = []PriceSchedule{}
+	)
+
+	err := phr.db.Model(&PriceSchedule{}).
+		Where("(status = ? AND starts_at <= ?) OR (status = ? AND ends_at <= ?)",
+			PriceScheduleStatusScheduled, now, PriceScheduleStatusActive, now).
+		Order("starts_at, id").
+		Find(&schedules).Error
+	if err != nil {
+		utils.Error("unable to get due price schedules ", err)
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// ApplySchedule implements IPriceHistoryRepo. A scheduled change sets the new
+// price; an active one whose window closed restores the previous price, unless
+// the price was changed by hand in the meantime. It reports false when another
+// worker already moved the schedule on.
+func (phr *priceHistoryRepo) ApplySchedule(schedule *PriceSchedule, now time.Time) (bool, error) {
+	applied := false
+
+	err := phr.db.Transaction(func(tx *gorm.DB) error {
+		product := Product{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "price").
+			First(&product, schedule.ProductID).Error; err != nil {
+			return err
+		}
+
+		var (
+			values   = map[string]interface{}{}
+			newPrice = product.Price
+		)
+		switch schedule.Status {
+		case PriceScheduleStatusScheduled:
+			newPrice = schedule.Price
+			values["previous_price"] = product.Price
+			values["applied_at"] = now
+			values["status"] = PriceScheduleStatusActive
+			if schedule.EndsAt == nil {
+				values["status"] = PriceScheduleStatusCompleted
+				values["finished_at"] = now
+			}
+		case PriceScheduleStatusActive:
+			if product.Price == schedule.Price && schedule.PreviousPrice != nil {
+				newPrice = *schedule.PreviousPrice
+			}
+			values["status"] = PriceScheduleStatusCompleted
+			values["finished_at"] = now
+		default:
+			return nil
+		}
+
+		result := tx.Model(&PriceSchedule{}).
+			Where("id = ? AND status = ?", schedule.ID, schedule.Status).
+			Updates(values)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		if newPrice != product.Price {
+			if err := tx.Model(&Product{}).Where("id = ?", product.ID).Update("price", newPrice).Error; err != nil {
+				return err
+			}
+		}
+		if err := phr.RecordWithTx(tx, product.ID, &product.Price, newPrice, PriceChangeSourceSchedule, &schedule.ID); err != nil {
+			return err
+		}
+
+		applied = true
+		return nil
+	})
+	if err != nil {
+		utils.Error("unable to apply price schedule ", err)
+		return false, err
+	}
+	return applied, nil
+}
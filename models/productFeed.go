@@ -0,0 +1,53 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FindFeedInBatches walks the live products of merchants that syndicate their
+// catalogue, with the merchant loaded, batch by batch
+func (pr *productRepo) FindFeedInBatches(batchSize int, fn func(products []Product) error) error {
+	var products []Product
+
+	err := pr.db.Model(&Product{}).
+		Select("products.*").
+		Joins("JOIN merchants ON merchants.uuid = products.merchant_id AND merchants.deleted_at IS NULL").
+		Where("merchants.feed_opt_out IS NOT TRUE AND merchants.is_blocked IS NOT TRUE").
+		Scopes(LiveProducts(time.Now())).
+		Preload("Merchant").
+		FindInBatches(&products, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(products)
+		}).Error
+	if err != nil {
+		utils.Error("unable to walk feed products ", err)
+		return err
+	}
+	return nil
+}
+
+// FirstURLs implements IProductImageRepo, returning the URL of the first image of each product
+func (pir *productImageRepo) FirstURLs(productIDs []uint) (map[uint]string, error) {
+	var rows []struct {
+		ProductID uint
+		URL       string
+	}
+
+	err := pir.db.Model(&ProductImage{}).
+		Select("DISTINCT ON (product_id) product_id, url").
+		Where("product_id IN ?", productIDs).
+		Order("product_id, position").
+		Scan(&rows).Error
+	if err != nil {
+		utils.Error("unable to get first product images ", err)
+		return nil, err
+	}
+
+	urls := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		urls[row.ProductID] = row.URL
+	}
+	return urls, nil
+}
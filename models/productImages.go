@@ -0,0 +1,153 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"errors"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTooManyProductImages is returned when appending images would take a product over its limit
+var ErrTooManyProductImages = errors.New("too many product images")
+
+type ProductImage struct {
+	gorm.Model
+	UUID        string                      `gorm:"unique" json:"uuid"`
+	ProductID   uint                        `json:"-" gorm:"index;not null"`
+	Position    int                         `json:"position"`
+	URL         string                      `json:"url"`
+	Thumbnails  datatypes.JSONMap           `json:"thumbnails,omitempty" gorm:"type:jsonb"`
+	ContentType string                      `json:"content_type"`
+	SizeBytes   int64                       `json:"size_bytes"`
+	Width       int                         `json:"width"`
+	Height      int                         `json:"height"`
+	StorageKeys datatypes.JSONSlice[string] `json:"-" gorm:"type:jsonb"`
+}
+
+type productImageRepo struct {
+	db *gorm.DB
+}
+
+func (pi *ProductImage) BeforeCreate(tx *gorm.DB) error {
+	if pi.UUID == "" {
+		imageUUID, err := utils.GenerateNanoID(12, "img_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		pi.UUID = imageUUID
+	}
+	return nil
+}
+
+// Create implements IProductImageRepo.
+func (pir *productImageRepo) Create(images []*ProductImage) error {
+	return pir.CreateWithTx(pir.db, images)
+}
+
+// CreateWithTx implements IProductImageRepo.
+func (pir *productImageRepo) CreateWithTx(tx *gorm.DB, images []*ProductImage) error {
+	err := tx.Model(&ProductImage{}).Create(images).Error
+	if err != nil {
+		utils.Error("unable to create product images ", err)
+		return err
+	}
+	return nil
+}
+
+// Append implements IProductImageRepo, adding the images after the product's
+// existing ones. The product row is locked while the positions are assigned,
+// so concurrent uploads cannot take the same position or exceed maxImages.
+func (pir *productImageRepo) Append(productID uint, images []*ProductImage, maxImages int) error {
+	err := pir.db.Transaction(func(tx *gorm.DB) error {
+		var product Product
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			First(&product, productID).Error
+		if err != nil {
+			return err
+		}
+
+		var existing struct {
+			Count        int
+			NextPosition int
+		}
+		err = tx.Model(&ProductImage{}).
+			Where("product_id = ?", productID).
+			Select("COUNT(*) AS count, COALESCE(MAX(position) + 1, 0) AS next_position").
+			Scan(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing.Count+len(images) > maxImages {
+			return ErrTooManyProductImages
+		}
+
+		for i, image := range images {
+			image.Position = existing.NextPosition + i
+		}
+		return tx.Model(&ProductImage{}).Create(images).Error
+	})
+	if err != nil {
+		utils.Error("unable to append product images ", err)
+		return err
+	}
+	return nil
+}
+
+// GetAll implements IProductImageRepo, ordered by position.
+func (pir *productImageRepo) GetAll(productID uint) ([]ProductImage, error) {
+	var (
+		images = []ProductImage{}
+	)
+
+	err := pir.db.Model(&ProductImage{}).
+		Where("product_id = ?", productID).
+		Order("position, id").
+		Find(&images).Error
+	if err != nil {
+		utils.Error("unable to get product images ", err)
+		return nil, err
+	}
+	return images, nil
+}
+
+// Get implements IProductImageRepo.
+func (pir *productImageRepo) Get(where *ProductImage) (*ProductImage, error) {
+	var (
+		image = ProductImage{}
+	)
+
+	err := pir.db.Model(&ProductImage{}).Where(where).Last(&image).Error
+	if err != nil {
+		utils.Error("unable to get product image ", err)
+		return nil, err
+	}
+	return &image, nil
+}
+
+// UpdatePositionsWithTx implements IProductImageRepo.
+func (pir *productImageRepo) UpdatePositionsWithTx(tx *gorm.DB, productID uint, orderedIDs []uint) error {
+	for position, id := range orderedIDs {
+		err := tx.Model(&ProductImage{}).
+			Where("id = ? AND product_id = ?", id, productID).
+			Update("position", position).Error
+		if err != nil {
+			utils.Error("unable to update image position ", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete implements IProductImageRepo.
+func (pir *productImageRepo) Delete(where *ProductImage) error {
+	err := pir.db.Where(where).Delete(&ProductImage{}).Error
+	if err != nil {
+		utils.Error("unable to delete product image ", err)
+		return err
+	}
+	return nil
+}
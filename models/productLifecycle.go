@@ -0,0 +1,133 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ProductStatus string
+
+const (
+	ProductStatusDraft         ProductStatus = "DRAFT"
+	ProductStatusPendingReview ProductStatus = "PENDING_REVIEW"
+	ProductStatusPublished     ProductStatus = "PUBLISHED"
+	ProductStatusArchived      ProductStatus = "ARCHIVED"
+)
+
+var ErrInvalidProductTransition = errors.New("invalid product status transition")
+
+func (s ProductStatus) IsValid() bool {
+	switch s {
+	case ProductStatusDraft, ProductStatusPendingReview, ProductStatusPublished, ProductStatusArchived:
+		return true
+	}
+	return false
+}
+
+// merchantTransitions lists the statuses a merchant can move a product to.
+// Asking to publish in a moderated category leads to PENDING_REVIEW instead.
+var merchantTransitions = map[ProductStatus][]ProductStatus{
+	ProductStatusDraft:         {ProductStatusPublished, ProductStatusArchived},
+	ProductStatusPendingReview: {ProductStatusDraft, ProductStatusArchived},
+	ProductStatusPublished:     {ProductStatusDraft, ProductStatusArchived},
+	ProductStatusArchived:      {ProductStatusDraft},
+}
+
+// ResolveProductTransition returns the status a merchant's request to move a
+// product from `from` to `to` results in
+func ResolveProductTransition(from, to ProductStatus, moderated bool) (ProductStatus, error) {
+	if from == "" {
+		from = ProductStatusDraft
+	}
+	if from == to {
+		return to, nil
+	}
+	// Asking for review is the same as asking to publish
+	if to == ProductStatusPendingReview {
+		to = ProductStatusPublished
+	}
+
+	for _, allowed := range merchantTransitions[from] {
+		if allowed != to {
+			continue
+		}
+		if to == ProductStatusPublished && moderated {
+			return ProductStatusPendingReview, nil
+		}
+		return to, nil
+	}
+	return "", ErrInvalidProductTransition
+}
+
+// StatusValues returns the columns to write for a new status, keeping the
+// legacy is_active flag in step
+func StatusValues(status ProductStatus, now time.Time) map[string]interface{} {
+	values := map[string]interface{}{
+		"status":    status,
+		"is_active": status == ProductStatusPublished,
+	}
+	if status == ProductStatusPublished {
+		values["published_at"] = now
+	}
+	return values
+}
+
+// IsLive reports whether the product is published and inside its publishing window
+func (p *Product) IsLive(now time.Time) bool {
+	return p.Status == ProductStatusPublished &&
+		(p.PublishAt == nil || !p.PublishAt.After(now)) &&
+		(p.UnpublishAt == nil || p.UnpublishAt.After(now))
+}
+
+// LiveProducts limits a product query to published products inside their publishing window
+func LiveProducts(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("products.status = ?", ProductStatusPublished).
+			Where("products.publish_at IS NULL OR products.publish_at <= ?", now).
+			Where("products.unpublish_at IS NULL OR products.unpublish_at > ?", now)
+	}
+}
+
+// UpdateStatus implements IProductRepo.
+func (pr *productRepo) UpdateStatus(id uint, values map[string]interface{}) error {
+	err := pr.db.Model(&Product{}).Where("id = ?", id).Updates(values).Error
+	if err != nil {
+		utils.Error("unable to update product status ", err)
+		return err
+	}
+	return nil
+}
+
+// GetPendingReview implements IProductRepo, oldest submissions first.
+func (pr *productRepo) GetPendingReview(limit, offset int) ([]Product, int64, error) {
+	var (
+		products = []Product{}
+		total    int64
+	)
+
+	query := pr.db.Model(&Product{}).Where("status = ?", ProductStatusPendingReview)
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count products pending review ", err)
+		return nil, 0, err
+	}
+
+	if err := query.Order("updated_at, id").Limit(limit).Offset(offset).Find(&products).Error; err != nil {
+		utils.Error("unable to get products pending review ", err)
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+// backfillProductStatus gives products created before the lifecycle existed a
+// status matching their is_active flag
+func backfillProductStatus(db *gorm.DB) error {
+	return db.Model(&Product{}).
+		Where("status IS NULL OR status = ''").
+		Updates(map[string]interface{}{
+			"status": gorm.Expr("CASE WHEN is_active THEN ? ELSE ? END",
+				ProductStatusPublished, ProductStatusDraft),
+		}).Error
+}
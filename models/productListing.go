@@ -0,0 +1,338 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ProductSort string
+
+const (
+	ProductSortNewest     ProductSort = "newest"
+	ProductSortPriceAsc   ProductSort = "price_asc"
+	ProductSortPriceDesc  ProductSort = "price_desc"
+	ProductSortPopularity ProductSort = "popularity"
+	ProductSortRating     ProductSort = "rating"
+)
+
+var ErrInvalidProductCursor = errors.New("invalid product cursor")
+
+// IsValid reports whether the sort is one of the supported keys
+func (s ProductSort) IsValid() bool {
+	switch s {
+	case ProductSortNewest, ProductSortPriceAsc, ProductSortPriceDesc, ProductSortPopularity, ProductSortRating:
+		return true
+	}
+	return false
+}
+
+// column returns the keyset column for the sort and whether it is descending.
+// Prices sort by the price after offers, which is the one listings show.
+func (s ProductSort) column() (string, bool) {
+	switch s {
+	case ProductSortPriceAsc:
+		return effectivePriceSQL, false
+	case ProductSortPriceDesc:
+		return effectivePriceSQL, true
+	case ProductSortPopularity:
+		return "sold_count", true
+	case ProductSortRating:
+		return "rating_average", true
+	default:
+		return "created_at", true
+	}
+}
+
+// cursorValue extracts the keyset value of the product for the sort, given
+// the discount of its best offer
+func (s ProductSort) cursorValue(p *Product, discount float64) string {
+	switch s {
+	case ProductSortPriceAsc, ProductSortPriceDesc:
+		return strconv.FormatUint(uint64(DiscountedPrice(p.Price, discount)), 10)
+	case ProductSortPopularity:
+		return strconv.FormatUint(uint64(p.SoldCount), 10)
+	case ProductSortRating:
+		return strconv.FormatFloat(p.RatingAverage, 'g', -1, 64)
+	default:
+		return p.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// parseCursorValue converts a cursor value back to the column type
+func (s ProductSort) parseCursorValue(value string) (interface{}, error) {
+	switch s {
+	case ProductSortPriceAsc, ProductSortPriceDesc, ProductSortPopularity:
+		return strconv.ParseUint(value, 10, 64)
+	case ProductSortRating:
+		return strconv.ParseFloat(value, 64)
+	default:
+		return time.Parse(time.RFC3339Nano, value)
+	}
+}
+
+// ProductCursor points at the last product of a page for keyset pagination
+type ProductCursor struct {
+	Sort  ProductSort `json:"s"`
+	Value string      `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+// Encode returns the opaque cursor string handed to clients
+func (pc *ProductCursor) Encode() string {
+	raw, _ := json.Marshal(pc)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeProductCursor parses a cursor produced by Encode
+func DecodeProductCursor(cursor string) (*ProductCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidProductCursor
+	}
+
+	pc := ProductCursor{}
+	if err := json.Unmarshal(raw, &pc); err != nil || !pc.Sort.IsValid() {
+		return nil, ErrInvalidProductCursor
+	}
+
+	if _, err := pc.Sort.parseCursorValue(pc.Value); err != nil {
+		return nil, ErrInvalidProductCursor
+	}
+	return &pc, nil
+}
+
+// ProductListFilter holds the filters, ordering and page window for listing products
+type ProductListFilter struct {
+	Category string
+	MinPrice *uint64
+	MaxPrice *uint64
+	MinStock *uint64
+	Specs    []SpecificationFilter
+
+	Sort   ProductSort
+	Cursor *ProductCursor
+	Limit  int
+}
+
+// Scope applies the filters (but not the page window) to a product query.
+// Prices are filtered after offers, through the best_offer join.
+func (f *ProductListFilter) Scope(db *gorm.DB) *gorm.DB {
+	db = db.Scopes(f.scopeWithoutSpecs)
+	for i := range f.Specs {
+		db = db.Scopes(f.Specs[i].Scope)
+	}
+	return db
+}
+
+// scopeWithoutSpecs applies every filter but the specification ones
+func (f *ProductListFilter) scopeWithoutSpecs(db *gorm.DB) *gorm.DB {
+	now := time.Now()
+	db = db.Joins(bestOfferJoinSQL, now).Scopes(LiveProducts(now))
+
+	if f.Category != "" {
+		db = db.Where("category = ?", f.Category)
+	}
+	if f.MinPrice != nil {
+		db = db.Where(effectivePriceSQL+" >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		db = db.Where(effectivePriceSQL+" <= ?", *f.MaxPrice)
+	}
+	if f.MinStock != nil {
+		db = db.Where("stock >= ?", *f.MinStock)
+	}
+	return db
+}
+
+// List returns one page of active products and the cursor of the next page, if any
+func (pr *productRepo) List(filter *ProductListFilter) ([]Product, *ProductCursor, error) {
+	var (
+		products []Product
+	)
+
+	column, desc := filter.Sort.column()
+	direction, operator := "ASC", ">"
+	if desc {
+		direction, operator = "DESC", "<"
+	}
+
+	query := pr.db.Model(&Product{}).Scopes(filter.Scope)
+
+	if filter.Cursor != nil {
+		if filter.Cursor.Sort != filter.Sort {
+			return nil, nil, ErrInvalidProductCursor
+		}
+
+		value, err := filter.Sort.parseCursorValue(filter.Cursor.Value)
+		if err != nil {
+			return nil, nil, ErrInvalidProductCursor
+		}
+		query = query.Where(fmt.Sprintf("(%s, products.id) %s (?, ?)", column, operator), value, filter.Cursor.ID)
+	}
+
+	// Fetch one extra row to know whether another page exists
+	err := query.
+		Order(fmt.Sprintf("%s %s, products.id %s", column, direction, direction)).
+		Limit(filter.Limit + 1).
+		Find(&products).Error
+	if err != nil {
+		utils.Error("unable to list products ", err)
+		return nil, nil, err
+	}
+
+	if len(products) <= filter.Limit {
+		return products, nil, nil
+	}
+
+	products = products[:filter.Limit]
+	last := &products[len(products)-1]
+	discounts, err := (&offerRepo{db: pr.db}).ActiveDiscounts([]uint{last.ID}, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	return products, &ProductCursor{
+		Sort:  filter.Sort,
+		Value: filter.Sort.cursorValue(last, discounts[last.ID]),
+		ID:    last.ID,
+	}, nil
+}
+
+// Count returns the number of active products matching the filter
+func (pr *productRepo) Count(filter *ProductListFilter) (int64, error) {
+	var (
+		count int64
+	)
+
+	err := pr.db.Model(&Product{}).Scopes(filter.Scope).Count(&count).Error
+	if err != nil {
+		utils.Error("unable to count products ", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+type SpecificationOperator string
+
+const (
+	SpecificationOperatorEq  SpecificationOperator = "="
+	SpecificationOperatorGte SpecificationOperator = ">="
+	SpecificationOperatorLte SpecificationOperator = "<="
+)
+
+var specificationKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-]{1,64}$`)
+
+// SpecificationFilter matches a key of Product.Specifications, e.g. spec.color=red or spec.ram_gb>=8
+type SpecificationFilter struct {
+	Key      string
+	Operator SpecificationOperator
+	Values   []string
+}
+
+// NewSpecificationFilter validates the key and values of a specification filter
+func NewSpecificationFilter(key string, operator SpecificationOperator, values []string) (*SpecificationFilter, error) {
+	if !specificationKeyPattern.MatchString(key) {
+		return nil, fmt.Errorf("invalid specification key %q", key)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("specification %q needs a value", key)
+	}
+
+	if operator != SpecificationOperatorEq {
+		if len(values) > 1 {
+			return nil, fmt.Errorf("specification %q accepts a single value for %s", key, operator)
+		}
+		if _, err := strconv.ParseFloat(values[0], 64); err != nil {
+			return nil, fmt.Errorf("specification %q needs a numeric value for %s", key, operator)
+		}
+	}
+	return &SpecificationFilter{Key: key, Operator: operator, Values: values}, nil
+}
+
+// Scope restricts a product query to the specification filter
+func (sf *SpecificationFilter) Scope(db *gorm.DB) *gorm.DB {
+	condition, args := sf.condition()
+	return db.Where(condition, args...)
+}
+
+// condition is the SQL condition of the filter. Equality uses jsonb
+// containment so that the GIN index on specifications is used.
+func (sf *SpecificationFilter) condition() (string, []interface{}) {
+	if sf.Operator != SpecificationOperatorEq {
+		number, _ := strconv.ParseFloat(sf.Values[0], 64)
+		return fmt.Sprintf(
+			"(CASE WHEN jsonb_typeof(specifications -> ?) = 'number' THEN (specifications ->> ?)::numeric END) %s ?",
+			sf.Operator), []interface{}{sf.Key, sf.Key, number}
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	for _, value := range sf.Values {
+		for _, candidate := range specificationCandidates(value) {
+			document, _ := json.Marshal(map[string]interface{}{sf.Key: candidate})
+			conditions = append(conditions, "specifications @> ?::jsonb")
+			args = append(args, string(document))
+		}
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// specificationCandidates returns the JSON values a query string value may have been stored as
+func specificationCandidates(value string) []interface{} {
+	candidates := []interface{}{value}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		candidates = append(candidates, number)
+	}
+	if boolean, err := strconv.ParseBool(value); err == nil {
+		candidates = append(candidates, boolean)
+	}
+	return candidates
+}
+
+// SpecificationFacet is the number of products sharing a value for a specification key
+type SpecificationFacet struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facets counts the distinct scalar specification values of the products
+// matching the filter. Values are grouped by their text, so "8" and 8 are one
+// bucket, and a key is counted without its own specification filters so that
+// selecting one value still shows the others.
+func (pr *productRepo) Facets(filter *ProductListFilter) ([]SpecificationFacet, error) {
+	var (
+		facets []SpecificationFacet
+	)
+
+	query := pr.db.Model(&Product{}).
+		Scopes(filter.scopeWithoutSpecs).
+		Joins(`CROSS JOIN LATERAL jsonb_each(CASE WHEN jsonb_typeof(products.specifications) = 'object'
+			THEN products.specifications ELSE '{}'::jsonb END) AS spec`).
+		Where("jsonb_typeof(spec.value) IN ('string', 'number', 'boolean')")
+	for i := range filter.Specs {
+		condition, args := filter.Specs[i].condition()
+		query = query.Where("(spec.key = ? OR "+condition+")", append([]interface{}{filter.Specs[i].Key}, args...)...)
+	}
+
+	err := query.
+		Select("spec.key AS key, spec.value #>> '{}' AS value, COUNT(*) AS count").
+		Group("spec.key, spec.value #>> '{}'").
+		Order("spec.key, count DESC").
+		Scan(&facets).Error
+	if err != nil {
+		utils.Error("unable to get specification facets ", err)
+		return nil, err
+	}
+	return facets, nil
+}
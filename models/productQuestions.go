@@ -0,0 +1,216 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProductQuestion is a pre-sale question asked by a customer about a product
+type ProductQuestion struct {
+	gorm.Model
+	UUID        string          `gorm:"unique" json:"uuid"`
+	ProductID   uint            `json:"-" gorm:"not null;index"`
+	AccountUUID string          `json:"account_uuid" gorm:"not null"`
+	Body        string          `json:"body" gorm:"not null"`
+	AnswerCount uint            `json:"answer_count" gorm:"default:0"`
+	Answers     []ProductAnswer `json:"answers,omitempty" gorm:"foreignKey:QuestionID"`
+}
+
+// ProductAnswer answers a question; only the product's merchant and verified buyers can answer
+type ProductAnswer struct {
+	gorm.Model
+	UUID            string `gorm:"unique" json:"uuid"`
+	QuestionID      uint   `json:"-" gorm:"not null;index"`
+	AccountUUID     string `json:"account_uuid" gorm:"not null"`
+	Body            string `json:"body" gorm:"not null"`
+	IsMerchant      bool   `json:"is_merchant"`
+	IsVerifiedBuyer bool   `json:"is_verified_buyer"`
+	UpvoteCount     uint   `json:"upvote_count" gorm:"default:0"`
+}
+
+// AnswerVote records that an account upvoted an answer
+type AnswerVote struct {
+	ID          uint      `gorm:"primaryKey"`
+	AnswerID    uint      `gorm:"not null;uniqueIndex:idx_answer_votes_answer_account"`
+	AccountUUID string    `gorm:"not null;uniqueIndex:idx_answer_votes_answer_account"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type productQuestionRepo struct {
+	db *gorm.DB
+}
+
+func (pq *ProductQuestion) BeforeCreate(tx *gorm.DB) error {
+	if pq.UUID == "" {
+		questionUUID, err := utils.GenerateNanoID(12, "q_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		pq.UUID = questionUUID
+	}
+	return nil
+}
+
+func (pa *ProductAnswer) BeforeCreate(tx *gorm.DB) error {
+	if pa.UUID == "" {
+		answerUUID, err := utils.GenerateNanoID(12, "ans_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		pa.UUID = answerUUID
+	}
+	return nil
+}
+
+// preloadAnswers orders answers with the merchant's first, then by upvotes
+func preloadAnswers(db *gorm.DB) *gorm.DB {
+	return db.Order("is_merchant DESC, upvote_count DESC, id")
+}
+
+// CreateQuestion implements IProductQuestionRepo.
+func (pqr *productQuestionRepo) CreateQuestion(question *ProductQuestion) error {
+	err := pqr.db.Model(&ProductQuestion{}).Create(question).Error
+	if err != nil {
+		utils.Error("unable to create product question ", err)
+		return err
+	}
+	return nil
+}
+
+// GetQuestion implements IProductQuestionRepo.
+func (pqr *productQuestionRepo) GetQuestion(where *ProductQuestion) (*ProductQuestion, error) {
+	var (
+		question = ProductQuestion{}
+	)
+
+	err := pqr.db.Model(&ProductQuestion{}).
+		Preload("Answers", preloadAnswers).
+		Where(where).Last(&question).Error
+	if err != nil {
+		utils.Error("unable to get product question ", err)
+		return nil, err
+	}
+	return &question, nil
+}
+
+// ListQuestions implements IProductQuestionRepo, newest first with their answers.
+func (pqr *productQuestionRepo) ListQuestions(productID uint, answeredOnly bool, limit, offset int) ([]ProductQuestion, int64, error) {
+	var (
+		questions = []ProductQuestion{}
+		total     int64
+	)
+
+	query := pqr.db.Model(&ProductQuestion{}).Where("product_id = ?", productID)
+	if answeredOnly {
+		query = query.Where("answer_count > 0")
+	}
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count product questions ", err)
+		return nil, 0, err
+	}
+
+	err := query.Preload("Answers", preloadAnswers).
+		Order("id DESC").Limit(limit).Offset(offset).
+		Find(&questions).Error
+	if err != nil {
+		utils.Error("unable to list product questions ", err)
+		return nil, 0, err
+	}
+	return questions, total, nil
+}
+
+// TopAnswered implements IProductQuestionRepo, ranking answered questions by
+// their best answer's upvotes and then by how many answers they have.
+func (pqr *productQuestionRepo) TopAnswered(productID uint, limit int) ([]ProductQuestion, error) {
+	var (
+		questions = []ProductQuestion{}
+	)
+
+	err := pqr.db.Model(&ProductQuestion{}).
+		Where("product_id = ? AND answer_count > 0", productID).
+		Order(`(SELECT MAX(upvote_count) FROM product_answers
+			WHERE product_answers.question_id = product_questions.id AND product_answers.deleted_at IS NULL) DESC`).
+		Order("answer_count DESC, id DESC").
+		Limit(limit).
+		Preload("Answers", preloadAnswers).
+		Find(&questions).Error
+	if err != nil {
+		utils.Error("unable to get top product questions ", err)
+		return nil, err
+	}
+	return questions, nil
+}
+
+// CreateAnswer implements IProductQuestionRepo, keeping the question's answer count in step.
+func (pqr *productQuestionRepo) CreateAnswer(answer *ProductAnswer) error {
+	err := pqr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ProductAnswer{}).Create(answer).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ProductQuestion{}).Where("id = ?", answer.QuestionID).
+			Update("answer_count", gorm.Expr("answer_count + 1")).Error
+	})
+	if err != nil {
+		utils.Error("unable to create product answer ", err)
+		return err
+	}
+	return nil
+}
+
+// GetAnswer implements IProductQuestionRepo.
+func (pqr *productQuestionRepo) GetAnswer(where *ProductAnswer) (*ProductAnswer, error) {
+	var (
+		answer = ProductAnswer{}
+	)
+
+	err := pqr.db.Model(&ProductAnswer{}).Where(where).Last(&answer).Error
+	if err != nil {
+		utils.Error("unable to get product answer ", err)
+		return nil, err
+	}
+	return &answer, nil
+}
+
+// Upvote implements IProductQuestionRepo. Upvoting is idempotent per account;
+// the returned count is the answer's upvote count afterwards.
+func (pqr *productQuestionRepo) Upvote(answer *ProductAnswer, accountUUID string, upvote bool) (uint, error) {
+	var (
+		count uint
+	)
+
+	err := pqr.db.Transaction(func(tx *gorm.DB) error {
+		var result *gorm.DB
+		if upvote {
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&AnswerVote{AnswerID: answer.ID, AccountUUID: accountUUID})
+		} else {
+			result = tx.Where("answer_id = ? AND account_uuid = ?", answer.ID, accountUUID).Delete(&AnswerVote{})
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		delta := int(result.RowsAffected)
+		if !upvote {
+			delta = -delta
+		}
+		if delta != 0 {
+			if err := tx.Model(&ProductAnswer{}).Where("id = ?", answer.ID).
+				Update("upvote_count", gorm.Expr("upvote_count + ?", delta)).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&ProductAnswer{}).Where("id = ?", answer.ID).Select("upvote_count").Scan(&count).Error
+	})
+	if err != nil {
+		utils.Error("unable to upvote product answer ", err)
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RecommendationKind string
+
+const (
+	RecommendationFrequentlyBoughtTogether RecommendationKind = "FREQUENTLY_BOUGHT_TOGETHER"
+	RecommendationSimilar                  RecommendationKind = "SIMILAR"
+
+	// recommendationRefreshLock serialises refreshes across instances
+	recommendationRefreshLock = 740040
+
+	// similarCandidates is how many products on each side of a product's price
+	// are compared with it, so a refresh stays linear in the category size
+	similarCandidates = 25
+)
+
+// ProductRecommendation is a precomputed recommendation of RecommendedID on the
+// page of ProductID. Rows are rebuilt by Refresh.
+type ProductRecommendation struct {
+	ID            uint               `gorm:"primaryKey" json:"-"`
+	ProductID     uint               `json:"-" gorm:"uniqueIndex:idx_product_recommendations_pair"`
+	Kind          RecommendationKind `json:"kind" gorm:"uniqueIndex:idx_product_recommendations_pair"`
+	RecommendedID uint               `json:"-" gorm:"uniqueIndex:idx_product_recommendations_pair"`
+	Score         float64            `json:"score"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+type productRecommendationRepo struct {
+	db *gorm.DB
+}
+
+// frequentlyBoughtTogetherSQL ranks, for every product, the products bought in
+// the same completed checkouts by the number of such checkouts
+const frequentlyBoughtTogetherSQL = `
+INSERT INTO product_recommendations (product_id, kind, recommended_id, score, created_at)
+SELECT product_id, ?, recommended_id, score, NOW() FROM (
+	SELECT a.product_id, b.product_id AS recommended_id, COUNT(DISTINCT a.checkout_id) AS score,
+		ROW_NUMBER() OVER (PARTITION BY a.product_id ORDER BY COUNT(DISTINCT a.checkout_id) DESC, b.product_id) AS rank
+	FROM checkout_items a
+	JOIN checkout_items b ON b.checkout_id = a.checkout_id AND b.product_id <> a.product_id
+	JOIN checkouts ON checkouts.id = a.checkout_id AND checkouts.status = ? AND checkouts.deleted_at IS NULL
+	GROUP BY a.product_id, b.product_id
+) pairs
+WHERE rank <= ?`
+
+// similarProductsSQL ranks, for every published product, the other published
+// products of its category by the number of identical specifications, closest
+// price first on ties. Only the products closest in price are candidates,
+// found through idx_products_category_price.
+const similarProductsSQL = `
+INSERT INTO product_recommendations (product_id, kind, recommended_id, score, created_at)
+SELECT product_id, @kind, recommended_id, score, NOW() FROM (
+	SELECT p.id AS product_id, q.id AS recommended_id, overlap.score,
+		ROW_NUMBER() OVER (PARTITION BY p.id ORDER BY overlap.score DESC, ABS(q.price - p.price), q.id) AS rank
+	FROM products p
+	CROSS JOIN LATERAL (
+		(SELECT id, price, specifications FROM products
+			WHERE category = p.category AND price >= p.price AND id <> p.id AND status = @status AND deleted_at IS NULL
+			ORDER BY price, id LIMIT @candidates)
+		UNION ALL
+		(SELECT id, price, specifications FROM products
+			WHERE category = p.category AND price < p.price AND status = @status AND deleted_at IS NULL
+			ORDER BY price DESC, id LIMIT @candidates)
+	) q
+	CROSS JOIN LATERAL (
+		SELECT COUNT(*) AS score FROM jsonb_each(CASE WHEN jsonb_typeof(p.specifications) = 'object'
+			THEN p.specifications ELSE '{}'::jsonb END) spec
+		WHERE q.specifications -> spec.key = spec.value
+	) overlap
+	WHERE p.status = @status AND p.deleted_at IS NULL AND p.category <> ''
+) ranked
+WHERE rank <= @perProduct`
+
+// Refresh implements IProductRecommendationRepo, rebuilding every
+// recommendation with at most perProduct of each kind per product.
+func (rr *productRecommendationRepo) Refresh(perProduct int) error {
+	err := rr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", recommendationRefreshLock).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM product_recommendations").Error; err != nil {
+			return err
+		}
+		err := tx.Exec(frequentlyBoughtTogetherSQL,
+			RecommendationFrequentlyBoughtTogether, CheckoutStatusCompleted, perProduct).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(similarProductsSQL, map[string]interface{}{
+			"kind":       RecommendationSimilar,
+			"status":     ProductStatusPublished,
+			"candidates": similarCandidates,
+			"perProduct": perProduct,
+		}).Error
+	})
+	if err != nil {
+		utils.Error("unable to refresh product recommendations ", err)
+		return err
+	}
+	return nil
+}
+
+// List implements IProductRecommendationRepo, returning the live recommended
+// products of the kind, best first.
+func (rr *productRecommendationRepo) List(productID uint, kind RecommendationKind, limit int) ([]Product, error) {
+	var products = []Product{}
+
+	err := rr.db.Model(&Product{}).
+		Joins("JOIN product_recommendations ON product_recommendations.recommended_id = products.id").
+		Where("product_recommendations.product_id = ? AND product_recommendations.kind = ?", productID, kind).
+		Scopes(LiveProducts(time.Now())).
+		Order("product_recommendations.score DESC, product_recommendations.id").
+		Limit(limit).
+		Find(&products).Error
+	if err != nil {
+		utils.Error("unable to list product recommendations ", err)
+		return nil, err
+	}
+	return products, nil
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MinReviewRating = 1
+	MaxReviewRating = 5
+)
+
+type ReviewSort string
+
+const (
+	ReviewSortNewest  ReviewSort = "newest"
+	ReviewSortHelpful ReviewSort = "helpful"
+	ReviewSortRating  ReviewSort = "rating"
+)
+
+func (s ReviewSort) IsValid() bool {
+	return s == ReviewSortNewest || s == ReviewSortHelpful || s == ReviewSortRating
+}
+
+// ProductReview is a customer's rating of a product they bought. A customer
+// can review each product once; posting again edits the review.
+type ProductReview struct {
+	gorm.Model
+	UUID              string                      `gorm:"unique" json:"uuid"`
+	ProductID         uint                        `json:"-" gorm:"not null;uniqueIndex:idx_product_reviews_product_account"`
+	AccountUUID       string                      `json:"account_uuid" gorm:"not null;uniqueIndex:idx_product_reviews_product_account;index"`
+	Rating            uint                        `json:"rating" gorm:"not null"`
+	Title             string                      `json:"title,omitempty"`
+	Body              string                      `json:"body,omitempty"`
+	Images            datatypes.JSONSlice[string] `json:"images,omitempty" gorm:"type:jsonb"`
+	StorageKeys       datatypes.JSONSlice[string] `json:"-" gorm:"type:jsonb"`
+	HelpfulCount      uint                        `json:"helpful_count" gorm:"default:0"`
+	MerchantReply     string                      `json:"merchant_reply,omitempty"`
+	MerchantRepliedAt *time.Time                  `json:"merchant_replied_at,omitempty"`
+}
+
+// ReviewVote records that an account found a review helpful
+type ReviewVote struct {
+	ID          uint      `gorm:"primaryKey"`
+	ReviewID    uint      `gorm:"not null;uniqueIndex:idx_review_votes_review_account"`
+	AccountUUID string    `gorm:"not null;uniqueIndex:idx_review_votes_review_account"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type productReviewRepo struct {
+	db *gorm.DB
+}
+
+func (pr *ProductReview) BeforeCreate(tx *gorm.DB) error {
+	if pr.UUID == "" {
+		reviewUUID, err := utils.GenerateNanoID(12, "rev_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		pr.UUID = reviewUUID
+	}
+	return nil
+}
+
+// Create implements IProductReviewRepo, refreshing the product rating in the same transaction.
+func (prr *productReviewRepo) Create(review *ProductReview) error {
+	return prr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ProductReview{}).Create(review).Error; err != nil {
+			utils.Error("unable to create product review ", err)
+			return err
+		}
+		return refreshProductRating(tx, review.ProductID)
+	})
+}
+
+// Get implements IProductReviewRepo.
+func (prr *productReviewRepo) Get(where *ProductReview) (*ProductReview, error) {
+	var (
+		review = ProductReview{}
+	)
+
+	err := prr.db.Model(&ProductReview{}).Where(where).Last(&review).Error
+	if err != nil {
+		utils.Error("unable to get product review ", err)
+		return nil, err
+	}
+	return &review, nil
+}
+
+// List implements IProductReviewRepo, returning a page of the product's reviews and their total.
+func (prr *productReviewRepo) List(productID uint, sort ReviewSort, limit, offset int) ([]ProductReview, int64, error) {
+	var (
+		reviews = []ProductReview{}
+		total   int64
+	)
+
+	query := prr.db.Model(&ProductReview{}).Where("product_id = ?", productID)
+	if err := query.Count(&total).Error; err != nil {
+		utils.Error("unable to count product reviews ", err)
+		return nil, 0, err
+	}
+
+	switch sort {
+	case ReviewSortHelpful:
+		query = query.Order("helpful_count DESC, id DESC")
+	case ReviewSortRating:
+		query = query.Order("rating DESC, id DESC")
+	default:
+		query = query.Order("id DESC")
+	}
+
+	if err := query.Limit(limit).Offset(offset).Find(&reviews).Error; err != nil {
+		utils.Error("unable to list product reviews ", err)
+		return nil, 0, err
+	}
+	return reviews, total, nil
+}
+
+// Update implements IProductReviewRepo. The product rating is refreshed when the rating changes.
+func (prr *productReviewRepo) Update(review *ProductReview, values map[string]interface{}) error {
+	return prr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ProductReview{}).Where("id = ?", review.ID).Updates(values).Error; err != nil {
+			utils.Error("unable to update product review ", err)
+			return err
+		}
+		if _, ok := values["rating"]; ok {
+			return refreshProductRating(tx, review.ProductID)
+		}
+		return nil
+	})
+}
+
+// Delete implements IProductReviewRepo.
+func (prr *productReviewRepo) Delete(review *ProductReview) error {
+	return prr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("review_id = ?", review.ID).Delete(&ReviewVote{}).Error; err != nil {
+			utils.Error("unable to delete review votes ", err)
+			return err
+		}
+		if err := tx.Unscoped().Delete(&ProductReview{}, review.ID).Error; err != nil {
+			utils.Error("unable to delete product review ", err)
+			return err
+		}
+		return refreshProductRating(tx, review.ProductID)
+	})
+}
+
+// HasPurchased implements IProductReviewRepo, checking for a completed checkout containing the product.
+func (prr *productReviewRepo) HasPurchased(accountUUID string, productID uint) (bool, error) {
+	var (
+		count int64
+	)
+
+	err := prr.db.Model(&CheckoutItem{}).
+		Joins("JOIN checkouts ON checkouts.id = checkout_items.checkout_id").
+		Where("checkouts.user_id = ? AND checkouts.status = ? AND checkout_items.product_id = ?",
+			accountUUID, CheckoutStatusCompleted, productID).
+		Count(&count).Error
+	if err != nil {
+		utils.Error("unable to check product purchase ", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Vote implements IProductReviewRepo. Voting is idempotent per account; the
+// returned count is the review's helpful count after the vote.
+func (prr *productReviewRepo) Vote(review *ProductReview, accountUUID string, helpful bool) (uint, error) {
+	var (
+		count uint
+	)
+
+	err := prr.db.Transaction(func(tx *gorm.DB) error {
+		var result *gorm.DB
+		if helpful {
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&ReviewVote{ReviewID: review.ID, AccountUUID: accountUUID})
+		} else {
+			result = tx.Where("review_id = ? AND account_uuid = ?", review.ID, accountUUID).Delete(&ReviewVote{})
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		delta := int(result.RowsAffected)
+		if !helpful {
+			delta = -delta
+		}
+		if delta != 0 {
+			if err := tx.Model(&ProductReview{}).Where("id = ?", review.ID).
+				Update("helpful_count", gorm.Expr("helpful_count + ?", delta)).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&ProductReview{}).Where("id = ?", review.ID).Select("helpful_count").Scan(&count).Error
+	})
+	if err != nil {
+		utils.Error("unable to vote on product review ", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// refreshProductRating recomputes the rating aggregates stored on the product
+func refreshProductRating(tx *gorm.DB, productID uint) error {
+	err := tx.Exec(`UPDATE products SET
+		rating_count = (SELECT COUNT(*) FROM product_reviews WHERE product_id = ? AND deleted_at IS NULL),
+		rating_average = (SELECT COALESCE(ROUND(AVG(rating), 2), 0) FROM product_reviews WHERE product_id = ? AND deleted_at IS NULL)
+		WHERE id = ?`, productID, productID, productID).Error
+	if err != nil {
+		utils.Error("unable to refresh product rating ", err)
+		return err
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package models
 
 import (
 	utils "ecom/backend/utils"
+	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -11,16 +13,28 @@ import (
 
 type Product struct {
 	gorm.Model
-	UUID           string         `gorm:"unique" json:"uuid,omitempty"`
-	MerchantID     string         `json:"merchant_id" gorm:"index"`
-	Title          string         `json:"title" gorm:"not null"`
-	Description    string         `json:"description,omitempty"`
-	Price          uint           `json:"price" gorm:"not null"`
-	Stock          uint           `json:"stock" gorm:"default:0"`
-	Category       string         `json:"category"`
-	ImageURL       string         `json:"image_url,omitempty"`
-	IsActive       *bool          `json:"is_active" gorm:"default:false"`
-	Specifications datatypes.JSON `json:"specifications" gorm:"type:jsonb"`
+	UUID            string         `gorm:"unique" json:"uuid,omitempty"`
+	MerchantID      string         `json:"merchant_id" gorm:"index;uniqueIndex:idx_products_merchant_sku"`
+	SKU             *string        `json:"sku,omitempty" gorm:"uniqueIndex:idx_products_merchant_sku"`
+	Slug            string         `json:"slug" gorm:"uniqueIndex"`
+	Title           string         `json:"title" gorm:"not null"`
+	Description     string         `json:"description,omitempty"`
+	Price           uint           `json:"price" gorm:"not null;index;index:idx_products_category_price,priority:2"`
+	Stock           uint           `json:"stock" gorm:"default:0"`
+	SoldCount       uint           `json:"sold_count" gorm:"default:0;index"`
+	RatingAverage   float64        `json:"rating_average" gorm:"default:0;index"`
+	RatingCount     uint           `json:"rating_count" gorm:"default:0"`
+	Category        string         `json:"category" gorm:"index;index:idx_products_category_price,priority:1"`
+	ImageURL        string         `json:"image_url,omitempty"`
+	IsActive        *bool          `json:"is_active" gorm:"default:false"`
+	Status          ProductStatus  `json:"status" gorm:"index"`
+	PublishAt       *time.Time     `json:"publish_at,omitempty"`
+	UnpublishAt     *time.Time     `json:"unpublish_at,omitempty"`
+	PublishedAt     *time.Time     `json:"published_at,omitempty"`
+	ModerationNote  string         `json:"moderation_note,omitempty"`
+	MetaTitle       string         `json:"meta_title,omitempty"`
+	MetaDescription string         `json:"meta_description,omitempty"`
+	Specifications  datatypes.JSON `json:"specifications" gorm:"type:jsonb;index:idx_products_specifications,type:gin"`
 	// Offers      []Offer  `json:"offers,omitempty" gorm:"foreignKey:UUID;references:ProductID"`
 	Merchant Merchant `json:"merchant,omitempty" gorm:"foreignKey:MerchantID;references:UUID"`
 }
@@ -38,6 +52,12 @@ func (p *Product) BeforeCreate(tx *gorm.DB) error {
 	}
 	p.UUID = productId
 
+	if p.Status == "" {
+		p.Status = ProductStatusDraft
+	}
+	isActive := p.Status == ProductStatusPublished
+	p.IsActive = &isActive
+
 	tx.Statement.AddClause(clause.Returning{Columns: []clause.Column{
 		{Name: "uuid"},
 		{Name: "id"},
@@ -54,6 +74,10 @@ func (pr *productRepo) Create(p *Product) error {
 
 // Create a product within a transaction
 func (pr *productRepo) CreateWithTx(tx *gorm.DB, p *Product) error {
+	if err := assignProductSlugs(tx, []*Product{p}); err != nil {
+		return err
+	}
+
 	err := tx.Model(&Product{}).
 		Clauses(clause.Returning{Columns: []clause.Column{
 			{Name: "uuid"},
@@ -155,6 +179,132 @@ func (pr *productRepo) GetWithTx(tx *gorm.DB, where *Product) (*Product, error)
 	return &p, nil
 }
 
+// FindBySlug returns the product with the slug. A retired slug returns the
+// product that used it, whose current slug then differs from the one asked for.
+func (pr *productRepo) FindBySlug(slug string) (*Product, error) {
+	var product Product
+	err := pr.db.Model(&Product{}).Where("slug = ?", slug).Last(&product).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var uuid string
+		if uuid, err = productSlugs.redirectTarget(pr.db, slug); err == nil {
+			err = pr.db.Model(&Product{}).Where("uuid = ?", uuid).Last(&product).Error
+		}
+	}
+	if err != nil {
+		utils.Error("unable to get product by slug ", err)
+		return nil, err
+	}
+	return &product, nil
+}
+
+// UpdateSlugWithTx moves the product to a new slug, redirecting the old one
+func (pr *productRepo) UpdateSlugWithTx(tx *gorm.DB, p *Product, slug string) error {
+	if slug == p.Slug {
+		return nil
+	}
+	err := productSlugs.change(tx, p.UUID, p.Slug, slug)
+	if err != nil && !errors.Is(err, ErrSlugTaken) {
+		utils.Error("unable to update product slug ", err)
+	}
+	return err
+}
+
+// CountLive returns how many products are live at now
+func (pr *productRepo) CountLive(now time.Time) (int64, error) {
+	var count int64
+	if err := pr.db.Model(&Product{}).Scopes(LiveProducts(now)).Count(&count).Error; err != nil {
+		utils.Error("unable to count live products ", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// FindLiveInBatches walks limit live products from offset in id order, batch by batch
+func (pr *productRepo) FindLiveInBatches(offset, limit, batchSize int, fn func(products []Product) error) error {
+	var products []Product
+
+	err := pr.db.Model(&Product{}).
+		Scopes(LiveProducts(time.Now())).
+		Order("id").
+		Offset(offset).Limit(limit).
+		FindInBatches(&products, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(products)
+		}).Error
+	if err != nil {
+		utils.Error("unable to walk live products ", err)
+		return err
+	}
+	return nil
+}
+
+// GetByMerchantKeys returns the merchant's products whose sku or uuid is in keys
+func (pr *productRepo) GetByMerchantKeys(merchantID string, column string, keys []string) ([]Product, error) {
+	var products []Product
+	if column != "sku" && column != "uuid" {
+		return nil, fmt.Errorf("unsupported product key %s", column)
+	}
+
+	err := pr.db.Model(&Product{}).
+		Where("merchant_id = ?", merchantID).
+		Where(fmt.Sprintf("%s IN ?", column), keys).
+		Find(&products).Error
+	if err != nil {
+		utils.Error("unable to get products by keys ", err)
+		return nil, err
+	}
+	return products, nil
+}
+
+// UpdateColumns updates only the given columns of the product with id
+func (pr *productRepo) UpdateColumns(id uint, p *Product, columns []string) error {
+	return pr.UpdateColumnsWithTx(pr.db, id, p, columns)
+}
+
+// UpdateColumnsWithTx updates only the given columns within a transaction
+func (pr *productRepo) UpdateColumnsWithTx(tx *gorm.DB, id uint, p *Product, columns []string) error {
+	err := tx.Model(&Product{}).
+		Where("id = ?", id).
+		Select(columns).
+		Updates(p).Error
+	if err != nil {
+		utils.Error("error in updating product columns ", err)
+		return err
+	}
+	return nil
+}
+
+// FindByMerchantInBatches walks all products of a merchant in id order, batch by batch
+func (pr *productRepo) FindByMerchantInBatches(merchantID string, batchSize int, fn func(products []Product) error) error {
+	var products []Product
+
+	err := pr.db.Model(&Product{}).
+		Where("merchant_id = ?", merchantID).
+		Order("id").
+		FindInBatches(&products, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(products)
+		}).Error
+	if err != nil {
+		utils.Error("unable to walk merchant products ", err)
+		return err
+	}
+	return nil
+}
+
+// SpecificationKeys returns the distinct specification keys used by a merchant's products
+func (pr *productRepo) SpecificationKeys(merchantID string) ([]string, error) {
+	var keys []string
+
+	err := pr.db.Raw(`SELECT DISTINCT jsonb_object_keys(specifications) AS key FROM products
+		WHERE merchant_id = ? AND deleted_at IS NULL AND jsonb_typeof(specifications) = 'object'
+		ORDER BY key`, merchantID).
+		Scan(&keys).Error
+	if err != nil {
+		utils.Error("unable to get specification keys ", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
 func (pr *productRepo) CreateInBatches(products []*Product, batchSize int, merchantID string) error {
 	return pr.CreateInBatchesWithTx(pr.db, products, batchSize, merchantID)
 }
@@ -169,6 +319,10 @@ func (pr *productRepo) CreateInBatchesWithTx(tx *gorm.DB, products []*Product, b
 		p.MerchantID = merchantID
 	}
 
+	if err := assignProductSlugs(tx, products); err != nil {
+		return err
+	}
+
 	err := tx.Model(&Product{}).
 		Clauses(clause.Returning{Columns: []clause.Column{
 			{Name: "uuid"},
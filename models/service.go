@@ -44,6 +44,96 @@ func InitProductsRepo(db *gorm.DB) IProductRepo {
 	}
 }
 
+func InitProductImageRepo(db *gorm.DB) IProductImageRepo {
+	return &productImageRepo{
+		db: db,
+	}
+}
+
+func InitImportJobRepo(db *gorm.DB) IImportJobRepo {
+	return &importJobRepo{
+		db: db,
+	}
+}
+
+func InitProductReviewRepo(db *gorm.DB) IProductReviewRepo {
+	return &productReviewRepo{
+		db: db,
+	}
+}
+
+func InitProductQuestionRepo(db *gorm.DB) IProductQuestionRepo {
+	return &productQuestionRepo{
+		db: db,
+	}
+}
+
+func InitPriceHistoryRepo(db *gorm.DB) IPriceHistoryRepo {
+	return &priceHistoryRepo{
+		db: db,
+	}
+}
+
+func InitCategorySchemaRepo(db *gorm.DB) ICategorySchemaRepo {
+	return &categorySchemaRepo{
+		db: db,
+	}
+}
+
+func InitCartRepo(db *gorm.DB) ICartRepo {
+	return &cartRepo{
+		db: db,
+	}
+}
+
+func InitProductRecommendationRepo(db *gorm.DB) IProductRecommendationRepo {
+	return &productRecommendationRepo{
+		db: db,
+	}
+}
+
+func InitMerchantOrderRepo(db *gorm.DB) IMerchantOrderRepo {
+	return &merchantOrderRepo{
+		db: db,
+	}
+}
+
+func InitPaymentEventRepo(db *gorm.DB) IPaymentEventRepo {
+	return &paymentEventRepo{
+		db: db,
+	}
+}
+
+func InitOfferRepo(db *gorm.DB) IOfferRepo {
+	return &offerRepo{
+		db: db,
+	}
+}
+
+func InitCouponRepo(db *gorm.DB) ICouponRepo {
+	return &couponRepo{
+		db: db,
+	}
+}
+
+func InitIdempotencyKeyRepo(db *gorm.DB) IIdempotencyKeyRepo {
+	return &idempotencyKeyRepo{
+		db: db,
+	}
+}
+
+func InitWishlistRepo(db *gorm.DB) IWishlistRepo {
+	return &wishlistRepo{
+		db: db,
+	}
+}
+
+func InitCategoryRepo(db *gorm.DB) ICategoryRepo {
+	return &categoryRepo{
+		db: db,
+	}
+}
+
 func InitCheckoutrepo(db *gorm.DB) ICheckoutRepo {
 	return &checkoutRepo{
 		db: db,
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"ecom/backend/utils"
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+const (
+	SlugEntityProduct  = "product"
+	SlugEntityCategory = "category"
+
+	maxSlugLength    = 80
+	slugSuffixLength = 6
+)
+
+var ErrSlugTaken = errors.New("slug is already in use")
+
+// SlugRedirect keeps a retired slug pointing at the entity that used it, so old
+// links can be redirected to the current slug
+type SlugRedirect struct {
+	gorm.Model
+	EntityType string `json:"entity_type" gorm:"uniqueIndex:idx_slug_redirects_entity_slug"`
+	Slug       string `json:"slug" gorm:"uniqueIndex:idx_slug_redirects_entity_slug"`
+	// Target is the product UUID or the category name
+	Target string `json:"target" gorm:"index"`
+}
+
+// Slugify lowercases s, strips accents and apostrophes, and joins the
+// remaining ASCII letters and digits with hyphens
+func Slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		if unicode.Is(unicode.Mn, r) || r == '\'' || r == '’' {
+			continue
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		hyphen = true
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	return slug
+}
+
+// ValidSlug reports whether s is already in slug form
+func ValidSlug(s string) bool {
+	return s != "" && Slugify(s) == s
+}
+
+// slugTable describes a table whose rows own a slug, identified by keyColumn
+type slugTable struct {
+	model      interface{}
+	entityType string
+	keyColumn  string
+}
+
+var (
+	productSlugs  = slugTable{model: &Product{}, entityType: SlugEntityProduct, keyColumn: "uuid"}
+	categorySlugs = slugTable{model: &Category{}, entityType: SlugEntityCategory, keyColumn: "name"}
+)
+
+// taken returns which of the slugs are used, now or in the past, by any row
+func (t slugTable) taken(tx *gorm.DB, slugs []string) (map[string]bool, error) {
+	var current, retired []string
+
+	if err := tx.Unscoped().Model(t.model).Where("slug IN ?", slugs).Pluck("slug", &current).Error; err != nil {
+		utils.Error("unable to check slugs ", err)
+		return nil, err
+	}
+	err := tx.Model(&SlugRedirect{}).
+		Where("entity_type = ? AND slug IN ?", t.entityType, slugs).
+		Pluck("slug", &retired).Error
+	if err != nil {
+		utils.Error("unable to check slug redirects ", err)
+		return nil, err
+	}
+
+	taken := map[string]bool{}
+	for _, slug := range append(current, retired...) {
+		taken[slug] = true
+	}
+	return taken, nil
+}
+
+// unique returns base, or base with a random suffix when base is already taken
+func (t slugTable) unique(taken map[string]bool, base string) (string, error) {
+	if base == "" {
+		base = t.entityType
+	}
+
+	slug := base
+	for taken[slug] {
+		suffix, err := utils.GenerateNanoID(slugSuffixLength, "")
+		if err != nil {
+			return "", err
+		}
+		slug = Slugify(base + "-" + suffix)
+	}
+	taken[slug] = true
+	return slug, nil
+}
+
+// change moves the row identified by key from oldSlug to newSlug, keeping
+// oldSlug as a redirect. A row may take back one of its own retired slugs.
+func (t slugTable) change(tx *gorm.DB, key, oldSlug, newSlug string) error {
+	var used int64
+
+	err := tx.Unscoped().Model(t.model).
+		Where("slug = ? AND "+t.keyColumn+" <> ?", newSlug, key).
+		Count(&used).Error
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrSlugTaken
+	}
+
+	err = tx.Model(&SlugRedirect{}).
+		Where("entity_type = ? AND slug = ? AND target <> ?", t.entityType, newSlug, key).
+		Count(&used).Error
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrSlugTaken
+	}
+
+	err = tx.Unscoped().
+		Where("entity_type = ? AND slug = ?", t.entityType, newSlug).
+		Delete(&SlugRedirect{}).Error
+	if err != nil {
+		return err
+	}
+
+	if oldSlug != "" {
+		err = tx.Create(&SlugRedirect{EntityType: t.entityType, Slug: oldSlug, Target: key}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(t.model).Where(t.keyColumn+" = ?", key).Update("slug", newSlug).Error
+}
+
+// redirectTarget returns the key of the row that used to own slug
+func (t slugTable) redirectTarget(tx *gorm.DB, slug string) (string, error) {
+	var redirect SlugRedirect
+	err := tx.Model(&SlugRedirect{}).
+		Where("entity_type = ? AND slug = ?", t.entityType, slug).
+		Last(&redirect).Error
+	if err != nil {
+		return "", err
+	}
+	return redirect.Target, nil
+}
+
+// assignProductSlugs gives every product without a slug one derived from its
+// title, and rejects slugs chosen by the merchant that are already in use
+func assignProductSlugs(tx *gorm.DB, products []*Product) error {
+	candidates := make([]string, 0, len(products))
+	for _, p := range products {
+		if p.Slug == "" {
+			candidates = append(candidates, Slugify(p.Title))
+		} else {
+			candidates = append(candidates, p.Slug)
+		}
+	}
+
+	taken, err := productSlugs.taken(tx, candidates)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range products {
+		if p.Slug != "" {
+			if taken[p.Slug] {
+				return ErrSlugTaken
+			}
+			taken[p.Slug] = true
+			continue
+		}
+		if p.Slug, err = productSlugs.unique(taken, candidates[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillSlugs gives products and categories created before slugs existed
+// their slug, and registers the categories already used by products
+func backfillSlugs(db *gorm.DB) error {
+	var products []*Product
+	err := db.Model(&Product{}).
+		Where("slug IS NULL OR slug = ''").
+		FindInBatches(&products, 500, func(tx *gorm.DB, batch int) error {
+			if err := assignProductSlugs(db, products); err != nil {
+				return err
+			}
+			for _, p := range products {
+				if err := db.Model(&Product{}).Where("id = ?", p.ID).Update("slug", p.Slug).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	var categories []string
+	err = db.Model(&Product{}).
+		Where("category <> '' AND category NOT IN (?)", db.Model(&Category{}).Select("name")).
+		Distinct().Pluck("category", &categories).Error
+	if err != nil {
+		return err
+	}
+
+	categoryRepo := InitCategoryRepo(db)
+	for _, name := range categories {
+		if err := categoryRepo.EnsureWithTx(db, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
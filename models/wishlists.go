@@ -0,0 +1,285 @@
+package models
+
+import (
+	"crypto/rand"
+	"ecom/backend/utils"
+	"encoding/base64"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WishlistKind string
+
+const (
+	WishlistKindWishlist      WishlistKind = "WISHLIST"
+	WishlistKindSavedForLater WishlistKind = "SAVED_FOR_LATER"
+
+	savedForLaterName = "Saved for later"
+	shareTokenBytes   = 16
+)
+
+type WishlistAlertKind string
+
+const (
+	WishlistAlertPriceDrop   WishlistAlertKind = "PRICE_DROP"
+	WishlistAlertBackInStock WishlistAlertKind = "BACK_IN_STOCK"
+)
+
+// Wishlist is a named list of products bookmarked by a customer. Each customer
+// also has one SAVED_FOR_LATER list that cart items are moved to.
+type Wishlist struct {
+	gorm.Model
+	UUID        string         `gorm:"unique" json:"uuid"`
+	AccountUUID string         `json:"-" gorm:"index"`
+	Name        string         `json:"name"`
+	Kind        WishlistKind   `json:"kind" gorm:"default:WISHLIST"`
+	ShareToken  *string        `json:"share_token,omitempty" gorm:"uniqueIndex"`
+	Items       []WishlistItem `json:"items,omitempty" gorm:"foreignKey:WishlistID"`
+}
+
+// WishlistItem is a product on a wishlist. LastSeenPrice and LastSeenInStock
+// are what the customer was last told about, to detect drops and restocks.
+type WishlistItem struct {
+	ID              uint      `gorm:"primaryKey" json:"-"`
+	WishlistID      uint      `json:"-" gorm:"not null;uniqueIndex:idx_wishlist_items_wishlist_product"`
+	ProductID       uint      `json:"-" gorm:"not null;uniqueIndex:idx_wishlist_items_wishlist_product"`
+	PriceWhenAdded  uint      `json:"price_when_added"`
+	LastSeenPrice   uint      `json:"-"`
+	LastSeenInStock bool      `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	Product         Product   `json:"-" gorm:"foreignKey:ProductID"`
+}
+
+// WishlistAlert is a wishlisted product that got cheaper or came back in stock
+type WishlistAlert struct {
+	ItemID        uint              `json:"-"`
+	Kind          WishlistAlertKind `json:"kind"`
+	AccountUUID   string            `json:"account_uuid"`
+	WishlistUUID  string            `json:"wishlist_uuid"`
+	ProductUUID   string            `json:"product_uuid"`
+	ProductTitle  string            `json:"product_title"`
+	LastSeenPrice uint              `json:"last_seen_price"`
+	Price         uint              `json:"price"`
+	Stock         uint              `json:"stock"`
+	WasInStock    bool              `json:"-"`
+}
+
+type wishlistRepo struct {
+	db *gorm.DB
+}
+
+func (w *Wishlist) BeforeCreate(tx *gorm.DB) error {
+	if w.UUID == "" {
+		wishlistUUID, err := utils.GenerateNanoID(12, "wl_")
+		if err != nil {
+			utils.Error("unable to generate nano id ", err)
+			return err
+		}
+		w.UUID = wishlistUUID
+	}
+	return nil
+}
+
+// Create implements IWishlistRepo.
+func (wr *wishlistRepo) Create(wishlist *Wishlist) error {
+	if err := wr.db.Create(wishlist).Error; err != nil {
+		utils.Error("unable to create wishlist ", err)
+		return err
+	}
+	return nil
+}
+
+// Get implements IWishlistRepo.
+func (wr *wishlistRepo) Get(where *Wishlist) (*Wishlist, error) {
+	var wishlist Wishlist
+	if err := wr.db.Model(&Wishlist{}).Where(where).Last(&wishlist).Error; err != nil {
+		utils.Error("unable to get wishlist ", err)
+		return nil, err
+	}
+	return &wishlist, nil
+}
+
+// List implements IWishlistRepo, returning the account's lists oldest first.
+func (wr *wishlistRepo) List(accountUUID string) ([]Wishlist, error) {
+	var wishlists = []Wishlist{}
+
+	err := wr.db.Model(&Wishlist{}).
+		Where("account_uuid = ?", accountUUID).
+		Order("created_at, id").
+		Find(&wishlists).Error
+	if err != nil {
+		utils.Error("unable to list wishlists ", err)
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+// GetSavedForLater implements IWishlistRepo, creating the account's saved for later list on first use.
+func (wr *wishlistRepo) GetSavedForLater(accountUUID string) (*Wishlist, error) {
+	wishlist := Wishlist{}
+	err := wr.db.Where(Wishlist{AccountUUID: accountUUID, Kind: WishlistKindSavedForLater}).
+		Attrs(Wishlist{Name: savedForLaterName}).
+		FirstOrCreate(&wishlist).Error
+	if err != nil {
+		utils.Error("unable to get saved for later list ", err)
+		return nil, err
+	}
+	return &wishlist, nil
+}
+
+// Delete implements IWishlistRepo, deleting the list with its items.
+func (wr *wishlistRepo) Delete(wishlist *Wishlist) error {
+	err := wr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id = ?", wishlist.ID).Delete(&WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(wishlist).Error
+	})
+	if err != nil {
+		utils.Error("unable to delete wishlist ", err)
+		return err
+	}
+	return nil
+}
+
+// GetItems implements IWishlistRepo, newest first with their products loaded.
+func (wr *wishlistRepo) GetItems(wishlistID uint) ([]WishlistItem, error) {
+	var items = []WishlistItem{}
+
+	err := wr.db.Model(&WishlistItem{}).
+		Where("wishlist_id = ?", wishlistID).
+		Preload("Product").
+		Order("created_at DESC, id DESC").
+		Find(&items).Error
+	if err != nil {
+		utils.Error("unable to get wishlist items ", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// AddItem implements IWishlistRepo. Adding a product already on the list does nothing.
+func (wr *wishlistRepo) AddItem(wishlistID uint, product *Product, price uint) error {
+	err := wr.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&WishlistItem{
+		WishlistID:      wishlistID,
+		ProductID:       product.ID,
+		PriceWhenAdded:  price,
+		LastSeenPrice:   price,
+		LastSeenInStock: product.Stock > 0,
+	}).Error
+	if err != nil {
+		utils.Error("unable to add wishlist item ", err)
+		return err
+	}
+	return nil
+}
+
+// RemoveItem implements IWishlistRepo, reporting whether the product was on the list.
+func (wr *wishlistRepo) RemoveItem(wishlistID, productID uint) (bool, error) {
+	result := wr.db.Where("wishlist_id = ? AND product_id = ?", wishlistID, productID).Delete(&WishlistItem{})
+	if result.Error != nil {
+		utils.Error("unable to remove wishlist item ", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Share implements IWishlistRepo, giving the list a share token unless it already has one.
+func (wr *wishlistRepo) Share(wishlist *Wishlist) error {
+	if wishlist.ShareToken != nil {
+		return nil
+	}
+
+	raw := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		utils.Error("unable to generate share token ", err)
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := wr.db.Model(wishlist).Update("share_token", token).Error; err != nil {
+		utils.Error("unable to share wishlist ", err)
+		return err
+	}
+	wishlist.ShareToken = &token
+	return nil
+}
+
+// Unshare implements IWishlistRepo, invalidating the list's share link.
+func (wr *wishlistRepo) Unshare(wishlist *Wishlist) error {
+	if err := wr.db.Model(wishlist).Update("share_token", nil).Error; err != nil {
+		utils.Error("unable to unshare wishlist ", err)
+		return err
+	}
+	wishlist.ShareToken = nil
+	return nil
+}
+
+// PendingAlerts implements IWishlistRepo, returning items whose live product is
+// cheaper than last seen or back in stock since last seen. Prices are after
+// offers, so an offer starting is a price drop.
+func (wr *wishlistRepo) PendingAlerts(limit int) ([]WishlistAlert, error) {
+	var (
+		alerts []WishlistAlert
+		now    = time.Now()
+	)
+
+	err := wr.db.Model(&WishlistItem{}).
+		Select(`wishlist_items.id AS item_id,
+			CASE WHEN `+effectivePriceSQL+` < wishlist_items.last_seen_price THEN ? ELSE ? END AS kind,
+			wishlists.account_uuid, wishlists.uuid AS wishlist_uuid,
+			products.uuid AS product_uuid, products.title AS product_title,
+			wishlist_items.last_seen_price, `+effectivePriceSQL+` AS price, products.stock,
+			wishlist_items.last_seen_in_stock AS was_in_stock`,
+			WishlistAlertPriceDrop, WishlistAlertBackInStock).
+		Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id AND wishlists.deleted_at IS NULL").
+		Joins("JOIN products ON products.id = wishlist_items.product_id AND products.deleted_at IS NULL").
+		Joins(bestOfferJoinSQL, now).
+		Scopes(LiveProducts(now)).
+		Where("products.stock > 0").
+		Where(effectivePriceSQL + " < wishlist_items.last_seen_price OR NOT wishlist_items.last_seen_in_stock").
+		Order("wishlist_items.id").
+		Limit(limit).
+		Scan(&alerts).Error
+	if err != nil {
+		utils.Error("unable to get wishlist alerts ", err)
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// ClaimAlert implements IWishlistRepo, recording the alerted price and stock on
+// the item. It reports false when another worker already claimed the alert.
+func (wr *wishlistRepo) ClaimAlert(alert *WishlistAlert) (bool, error) {
+	result := wr.db.Model(&WishlistItem{}).
+		Where("id = ? AND last_seen_price = ? AND last_seen_in_stock = ?", alert.ItemID, alert.LastSeenPrice, alert.WasInStock).
+		Updates(map[string]interface{}{
+			"last_seen_price":    alert.Price,
+			"last_seen_in_stock": true,
+		})
+	if result.Error != nil {
+		utils.Error("unable to claim wishlist alert ", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// SyncSeen implements IWishlistRepo, catching up items whose product got more
+// expensive, e.g. because an offer ended, or ran out of stock, so the next drop
+// or restock is measured from there.
+func (wr *wishlistRepo) SyncSeen() error {
+	err := wr.db.Exec(`UPDATE wishlist_items SET
+			last_seen_price = GREATEST(wishlist_items.last_seen_price, `+effectivePriceSQL+`),
+			last_seen_in_stock = wishlist_items.last_seen_in_stock AND products.stock > 0
+		FROM products `+bestOfferJoinSQL+`
+		WHERE products.id = wishlist_items.product_id
+			AND (`+effectivePriceSQL+` > wishlist_items.last_seen_price
+				OR (products.stock = 0 AND wishlist_items.last_seen_in_stock))`, time.Now()).Error
+	if err != nil {
+		utils.Error("unable to sync wishlist items ", err)
+		return err
+	}
+	return nil
+}
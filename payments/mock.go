@@ -0,0 +1,225 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Payment methods understood by MockProvider.Confirm
+const (
+	MockPaymentSuccess = "pm_mock_success"
+	MockPaymentFailure = "pm_mock_failure"
+	MockPaymentPending = "pm_mock_pending"
+)
+
+// MockProvider is an in-memory payment gateway for local development and
+// tests. Intents live as long as the process, and the customer's side of a
+// payment is simulated with Confirm. When a webhook URL is set, state changes
+// are also sent there as signed webhooks.
+type MockProvider struct {
+	mu            sync.Mutex
+	intents       map[string]*Intent
+	webhookSecret string
+	webhookURL    string
+}
+
+func NewMockProvider(webhookSecret, webhookURL string) *MockProvider {
+	return &MockProvider{
+		intents:       map[string]*Intent{},
+		webhookSecret: webhookSecret,
+		webhookURL:    webhookURL,
+	}
+}
+
+func mockID(prefix string) (string, error) {
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(raw), nil
+}
+
+// Name implements PaymentProvider.
+func (mp *MockProvider) Name() string {
+	return "mock"
+}
+
+// CreateIntent implements PaymentProvider.
+func (mp *MockProvider) CreateIntent(_ context.Context, request CreateIntentRequest) (*Intent, error) {
+	if request.Amount <= 0 {
+		return nil, fmt.Errorf("invalid amount %d", request.Amount)
+	}
+
+	id, err := mockID("pi_mock_")
+	if err != nil {
+		return nil, err
+	}
+	secret, err := mockID("secret_")
+	if err != nil {
+		return nil, err
+	}
+
+	intent := &Intent{
+		ID:           id,
+		Reference:    request.Reference,
+		Amount:       request.Amount,
+		Currency:     request.Currency,
+		Status:       IntentRequiresPaymentMethod,
+		ClientSecret: secret,
+	}
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.intents[id] = intent
+
+	snapshot := *intent
+	return &snapshot, nil
+}
+
+// Verify implements PaymentProvider.
+func (mp *MockProvider) Verify(_ context.Context, intentID string) (*Intent, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	intent, ok := mp.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	snapshot := *intent
+	snapshot.ClientSecret = ""
+	return &snapshot, nil
+}
+
+// Confirm simulates the customer paying the intent with one of the mock
+// payment methods: success authorizes it, failure declines it and pending
+// leaves it processing until it is confirmed again.
+func (mp *MockProvider) Confirm(intentID, paymentMethod string) (*Intent, error) {
+	intent, err := mp.update(intentID, func(intent *Intent) error {
+		if intent.Status != IntentRequiresPaymentMethod && intent.Status != IntentProcessing {
+			return ErrInvalidTransition
+		}
+		switch paymentMethod {
+		case MockPaymentSuccess:
+			intent.Status = IntentRequiresCapture
+		case MockPaymentFailure:
+			intent.Status = IntentFailed
+		case MockPaymentPending:
+			intent.Status = IntentProcessing
+		default:
+			return fmt.Errorf("unknown mock payment method %q", paymentMethod)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch intent.Status {
+	case IntentRequiresCapture:
+		mp.sendWebhook(EventIntentRequiresCapture, intent)
+	case IntentFailed:
+		mp.sendWebhook(EventIntentFailed, intent)
+	case IntentProcessing:
+		mp.sendWebhook(EventIntentProcessing, intent)
+	}
+	return intent, nil
+}
+
+// Capture implements PaymentProvider.
+func (mp *MockProvider) Capture(_ context.Context, intentID string) (*Intent, error) {
+	intent, err := mp.update(intentID, func(intent *Intent) error {
+		if intent.Status != IntentRequiresCapture {
+			return ErrInvalidTransition
+		}
+		intent.Status = IntentSucceeded
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	mp.sendWebhook(EventIntentSucceeded, intent)
+	return intent, nil
+}
+
+// Refund implements PaymentProvider.
+func (mp *MockProvider) Refund(_ context.Context, intentID string, amount int64) (*Intent, error) {
+	return mp.update(intentID, func(intent *Intent) error {
+		if intent.Status != IntentSucceeded {
+			return ErrInvalidTransition
+		}
+		if amount <= 0 || intent.RefundedAmount+amount > intent.Amount {
+			return fmt.Errorf("invalid refund amount %d", amount)
+		}
+		intent.RefundedAmount += amount
+		return nil
+	})
+}
+
+// ParseWebhook implements PaymentProvider.
+func (mp *MockProvider) ParseWebhook(header http.Header, payload []byte) (*Event, error) {
+	if err := VerifySignature(mp.webhookSecret, header.Get(SignatureHeader), payload, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if event.ID == "" || event.IntentID == "" {
+		return nil, fmt.Errorf("invalid webhook payload: missing event or intent id")
+	}
+	return &event, nil
+}
+
+// sendWebhook posts a signed event about the intent to the webhook URL, in the background
+func (mp *MockProvider) sendWebhook(eventType string, intent *Intent) {
+	if mp.webhookURL == "" {
+		return
+	}
+
+	id, err := mockID("evt_mock_")
+	if err != nil {
+		return
+	}
+	payload, err := json.Marshal(Event{ID: id, Type: eventType, IntentID: intent.ID, Created: time.Now().Unix()})
+	if err != nil {
+		return
+	}
+
+	go func() {
+		request, err := http.NewRequest(http.MethodPost, mp.webhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(SignatureHeader, Sign(mp.webhookSecret, payload, time.Now()))
+
+		client := http.Client{Timeout: 10 * time.Second}
+		if response, err := client.Do(request); err == nil {
+			response.Body.Close()
+		}
+	}()
+}
+
+func (mp *MockProvider) update(intentID string, fn func(intent *Intent) error) (*Intent, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	intent, ok := mp.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if err := fn(intent); err != nil {
+		return nil, err
+	}
+	snapshot := *intent
+	snapshot.ClientSecret = ""
+	return &snapshot, nil
+}
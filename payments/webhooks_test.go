@@ -0,0 +1,53 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	var (
+		secret  = "whsec_test"
+		payload = []byte(`{"id":"evt_1","type":"payment_intent.succeeded","intent_id":"pi_1"}`)
+		now     = time.Unix(1700000000, 0)
+		valid   = Sign(secret, payload, now)
+	)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		payload []byte
+		wantErr bool
+	}{
+		{name: "valid", secret: secret, header: valid, payload: payload},
+		{name: "valid with extra signatures and spaces", secret: secret, header: "v1=deadbeef, " + valid, payload: payload},
+		{name: "valid at the edge of the tolerance", secret: secret, header: Sign(secret, payload, now.Add(-SignatureTolerance)), payload: payload},
+		{name: "stale", secret: secret, header: Sign(secret, payload, now.Add(-SignatureTolerance-time.Second)), payload: payload, wantErr: true},
+		{name: "from the future", secret: secret, header: Sign(secret, payload, now.Add(SignatureTolerance+time.Second)), payload: payload, wantErr: true},
+		{name: "tampered payload", secret: secret, header: valid, payload: []byte(`{"id":"evt_1","type":"payment_intent.succeeded","intent_id":"pi_2"}`), wantErr: true},
+		{name: "tampered timestamp", secret: secret, header: "t=1700000001,v1=" + signature(secret, "1700000000", payload), payload: payload, wantErr: true},
+		{name: "wrong secret", secret: "whsec_other", header: valid, payload: payload, wantErr: true},
+		{name: "missing secret", secret: "", header: Sign("", payload, now), payload: payload, wantErr: true},
+		{name: "missing header", secret: secret, header: "", payload: payload, wantErr: true},
+		{name: "missing signature", secret: secret, header: "t=1700000000", payload: payload, wantErr: true},
+		{name: "missing timestamp", secret: secret, header: "v1=" + signature(secret, "", payload), payload: payload, wantErr: true},
+		{name: "malformed timestamp", secret: secret, header: "t=soon,v1=" + signature(secret, "soon", payload), payload: payload, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.secret, tt.header, tt.payload, now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("VerifySignature() = %v, want ErrInvalidSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifySignature() = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BlobStore stores uploaded files (product images, merchant logos) and
+// resolves the public URL they are served from.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+var Store BlobStore
+
+// NewFromEnv builds the blob store selected by BLOB_STORE ("local" or "s3")
+func NewFromEnv() (BlobStore, error) {
+	switch strings.ToLower(os.Getenv("BLOB_STORE")) {
+	case "", "local":
+		return NewLocalStore(
+			getEnv("LOCAL_STORAGE_DIR", "./uploads"),
+			getEnv("LOCAL_STORAGE_URL_PATH", "/uploads"),
+			os.Getenv("PUBLIC_ASSET_BASE_URL"),
+		)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          getEnv("S3_REGION", "us-east-1"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicBaseURL:   os.Getenv("S3_PUBLIC_BASE_URL"),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported BLOB_STORE %q", os.Getenv("BLOB_STORE"))
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var AllowedImageTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// MaxImagePixels bounds width×height of a decoded image, as a small file can
+// declare huge dimensions and make decoding allocate gigabytes
+const MaxImagePixels = 40_000_000
+
+var (
+	ErrImageTooLarge      = errors.New("image exceeds the maximum upload size")
+	ErrImageTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// ReadImage reads at most maxBytes from r, sniffs the MIME type and decodes
+// the image, after checking its declared dimensions against MaxImagePixels
+func ReadImage(r io.Reader, maxBytes int64) ([]byte, string, image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", nil, ErrImageTooLarge
+	}
+
+	// Trust the file content, not the client supplied Content-Type
+	contentType := http.DetectContentType(data)
+	if _, ok := AllowedImageTypes[contentType]; !ok {
+		return nil, "", nil, fmt.Errorf("unsupported image type %s", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to decode image")
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return nil, "", nil, ErrImageTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to decode image")
+	}
+	return data, contentType, img, nil
+}
+
+// ResizeToFit scales the image down (never up) so that neither side exceeds maxSide
+func ResizeToFit(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSide && height <= maxSide {
+		return src
+	}
+
+	newWidth, newHeight := maxSide, height*maxSide/width
+	if height > width {
+		newWidth, newHeight = width*maxSide/height, maxSide
+	}
+	newWidth, newHeight = max(newWidth, 1), max(newHeight, 1)
+
+	// Box filter: every destination pixel is the average of the source pixels it covers
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0 := bounds.Min.Y + y*height/newHeight
+		y1 := max(bounds.Min.Y+(y+1)*height/newHeight, y0+1)
+
+		for x := 0; x < newWidth; x++ {
+			x0 := bounds.Min.X + x*width/newWidth
+			x1 := max(bounds.Min.X+(x+1)*width/newWidth, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// EncodeImage encodes the image in the given MIME type; GIFs are re-encoded as PNG
+func EncodeImage(img image.Image, contentType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch contentType {
+	case "image/jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), contentType, nil
+	default:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+}